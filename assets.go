@@ -0,0 +1,9 @@
+package main
+
+import "embed"
+
+// The default assets are baked into the binary, so the game can be run from any directory.
+// Anything in the -assets directory takes precedence over these.
+//
+//go:embed sound font images shaders
+var defaultAssets embed.FS
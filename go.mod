@@ -1,9 +1,11 @@
 module github.com/nathanKramer/starship-kepler
 
-go 1.14
+go 1.16
 
 require (
 	github.com/faiface/beep v1.1.0
+	github.com/faiface/glhf v0.0.0-20181018222622-82a6317ac380
+	github.com/faiface/mainthread v0.0.0-20171120011319-8b78f0a41ae3
 	github.com/faiface/pixel v0.10.0
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	golang.org/x/image v0.15.0
@@ -63,19 +63,17 @@ func run() {
 	}
 
 	draw := starshipkepler.NewDrawContext(cfg)
+	if *listAssets {
+		starshipkepler.PrintAssetReport(os.Stdout)
+	}
 	data := starshipkepler.ReadLocalData()
 	game := starshipkepler.NewGame(data)
 	game.PlayGameMusic()
 	uiContext := starshipkepler.NewUi(win)
 
 	for !win.Closed() {
-		// TODO: Put this scaled mouse position code in either ui or game.
-		// Can probably ditch the depenency on the canvas?
-		scaledX := (win.MousePosition().X - (win.Bounds().W() / 2)) *
-			(draw.PrimaryCanvas.Bounds().W() / win.Bounds().W())
-		scaledY := (win.MousePosition().Y - (win.Bounds().H() / 2)) *
-			(draw.PrimaryCanvas.Bounds().H() / win.Bounds().H())
-		uiContext.MousePos = pixel.V(scaledX, scaledY).Add(game.CamPos)
+		// the primary canvas is stretched over the window, and the camera looks at the world through that
+		uiContext.MousePos = game.Camera.WindowToWorld(win.MousePosition(), win.Bounds(), draw.PrimaryCanvas.Bounds())
 
 		starshipkepler.UpdateGame(win, game, uiContext)
 		if win.Bounds().W() > 0 && win.Bounds().W() != draw.PrimaryCanvas.Bounds().W() {
@@ -93,6 +91,32 @@ func run() {
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 var memprofile = flag.String("memprofile", "", "write memory profile to this file")
 
+var assetDir = flag.String("assets", "", "directory of assets that override the built in ones")
+var listAssets = flag.Bool("list-assets", false, "print where each asset was loaded from")
+
+var musicDir = flag.String("music", "", "directory of your own music, with a folder of tracks for each mode")
+
+var synthSounds = flag.Bool("synth", false, "synthesise sound effects instead of playing samples")
+
+var serialUpdates = flag.Bool("serial", false, "update particles and the grid on one core")
+
+var audioBackend = flag.String("audio", "speaker", "where to send audio: speaker, none, or capture")
+var capturePath = flag.String("capture", "capture.wav", "file to write audio to with -audio capture")
+
+func newAudioBackend() starshipkepler.AudioBackend {
+	switch *audioBackend {
+	case "none":
+		return starshipkepler.NewNullBackend()
+	case "capture":
+		return starshipkepler.NewCaptureBackend(*capturePath)
+	case "speaker":
+		return starshipkepler.NewSpeakerBackend()
+	default:
+		log.Fatalf("Unknown audio backend: %s", *audioBackend)
+		return nil
+	}
+}
+
 func main() {
 	flag.Parse()
 	if *cpuprofile != "" {
@@ -104,7 +128,16 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	starshipkepler.SetSerialUpdates(*serialUpdates)
+
+	starshipkepler.InitAssets(*assetDir, defaultAssets)
+
+	starshipkepler.SetMusicFolder(*musicDir)
+	starshipkepler.SetSynthOnly(*synthSounds)
+	starshipkepler.InitAudio(newAudioBackend())
+
 	pixelgl.Run(run)
+	starshipkepler.CloseAudio()
 
 	if *memprofile != "" {
 		f, err := os.Create(*memprofile)
@@ -10,6 +10,10 @@ out vec4 fragColor;
 uniform vec4      uTexBounds;
 uniform sampler2D uTexture;
 
+// How far out to sample, in pixels, and how bright the result is
+uniform float uRadius;
+uniform float uIntensity;
+
 vec2 Circle(float Start, float Points, float Point) 
 {
     float Rad = (3.141592 * 2.0 * (1.0 / Points)) * (Point + Start);
@@ -18,17 +22,14 @@ vec2 Circle(float Start, float Points, float Point)
 
 void main()
 {
-    // It is often very useful to normalize the fragment coordinate. Usually
-    // represented as "uv" we do so here:
-    //
-    // Normalize the fragments's position, this is the location we use to sample
-    // our two textures/buffers. Note: Pixel passes resolution info through
-    // uTexBounds.zw (x, y)
-	vec2 uv = gl_FragCoord.xy / uTexBounds.zw;
+    // Normalize the texture coordinate, this is the location we use to sample
+    // the texture. Pixel passes the texture's position and size through uTexBounds,
+    // and it works whatever size the canvas being drawn to is.
+	vec2 uv = (vTexCoords - uTexBounds.xy) / uTexBounds.zw;
 
     vec2  PixelOffset = 1.0 / uTexBounds.zw;
     float Start = 4.0 / 14.0;
-	vec2  Scale = 0.66 * 4.0 * 2.0 * PixelOffset.xy;
+	vec2  Scale = uRadius * PixelOffset.xy;
     
     vec3 N0 = texture(uTexture, uv + Circle(Start, 14.0, 0.0) * Scale).rgb;
     vec3 N1 = texture(uTexture, uv + Circle(Start, 14.0, 1.0) * Scale).rgb;
@@ -67,5 +68,5 @@ void main()
 		(N13 * W) +
 		(N14 * W);
 
-    fragColor = vec4(color.rgb, 1.0);
+    fragColor = vec4(color.rgb * uIntensity, 1.0);
 }
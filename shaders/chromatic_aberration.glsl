@@ -0,0 +1,23 @@
+#version 330 core
+in vec4  vColor;
+in vec2  vTexCoords;
+
+out vec4 fragColor;
+
+uniform sampler2D uTexture;
+uniform vec4      uTexBounds;
+
+// How many pixels red and blue are pulled apart at the edges of the screen
+uniform float uAmount;
+
+void main() {
+	vec2 uv = (vTexCoords - uTexBounds.xy) / uTexBounds.zw;
+
+	// nothing in the middle, the most in the corners
+	vec2 offset = (uv - 0.5) * 2.0 * uAmount / uTexBounds.zw;
+
+	vec4 c = texture(uTexture, uv);
+	c.r = texture(uTexture, uv + offset).r;
+	c.b = texture(uTexture, uv - offset).b;
+	fragColor = c;
+}
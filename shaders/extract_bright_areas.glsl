@@ -6,15 +6,18 @@ out vec4 fragColor;
 
 uniform sampler2D uTexture;
 uniform vec4      uTexBounds;
+
+// Anything less bright than this is dimmed, anything brighter is boosted
+uniform float uThreshold;
+
 void main() {
-	vec2 uv = gl_FragCoord.xy / uTexBounds.zw;
-	vec2  PixelOffset = 1.0 / uTexBounds.zw;
+	vec2 uv = (vTexCoords - uTexBounds.xy) / uTexBounds.zw;
 
 	vec4 c = texture(uTexture, uv);
 	float brightness = (c.r + c.g + c.b + c.a) / 4.0;
 
 	fragColor = c;
-	if (brightness < 0.4) {
+	if (brightness < uThreshold) {
 		fragColor = c * brightness;
 	} else {
 		fragColor = c * (1 + (1 - brightness));
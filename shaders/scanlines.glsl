@@ -0,0 +1,29 @@
+#version 330 core
+in vec4  vColor;
+in vec2  vTexCoords;
+
+out vec4 fragColor;
+
+uniform sampler2D uTexture;
+uniform vec4      uTexBounds;
+
+// Lines per pixel of the source, and how dark the gaps between them get
+uniform float uDensity;
+uniform float uStrength;
+// How much the picture bows out like an old CRT
+uniform float uCurvature;
+
+void main() {
+	vec2 uv = (vTexCoords - uTexBounds.xy) / uTexBounds.zw;
+
+	vec2 centred = uv - 0.5;
+	uv = 0.5 + centred * (1.0 + uCurvature * dot(centred, centred));
+	if (uv.x < 0.0 || uv.x > 1.0 || uv.y < 0.0 || uv.y > 1.0) {
+		fragColor = vec4(0.0, 0.0, 0.0, 1.0);
+		return;
+	}
+
+	vec4 c = texture(uTexture, uv);
+	float line = 0.5 + 0.5 * sin(uv.y * uTexBounds.w * uDensity * 3.141592);
+	fragColor = vec4(c.rgb * (1.0 - uStrength * line), c.a);
+}
@@ -0,0 +1,21 @@
+#version 330 core
+in vec4  vColor;
+in vec2  vTexCoords;
+
+out vec4 fragColor;
+
+uniform sampler2D uTexture;
+uniform vec4      uTexBounds;
+
+// How far from the middle (0.5 is the edge) the darkening starts, and how dark the corners get
+uniform float uRadius;
+uniform float uStrength;
+
+void main() {
+	vec2 uv = (vTexCoords - uTexBounds.xy) / uTexBounds.zw;
+
+	vec4 c = texture(uTexture, uv);
+	float dist = length(uv - 0.5);
+	float dark = smoothstep(uRadius, uRadius + 0.5, dist) * uStrength;
+	fragColor = vec4(c.rgb * (1.0 - dark), c.a);
+}
@@ -0,0 +1,308 @@
+package starshipkepler
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/faiface/pixel"
+)
+
+// Arena is the area play happens in. Everything that has to stay inside, or bounce off the
+// edges, or spawn somewhere in it, goes through here rather than assuming a rectangle.
+type Arena struct {
+	name   string
+	shape  string     // rect, circle or polygon
+	bounds pixel.Rect // the rectangle, or the box around the other shapes
+	radius float64    // for circles, centred on the origin
+	points []pixel.Vec
+
+	obstacles []*obstacle
+}
+
+// How many sides a circle gets when it's drawn
+const arenaCircleSegments = 96
+
+// NewRectArena is a width x height rectangle centred on the origin
+func NewRectArena(width float64, height float64) *Arena {
+	return &Arena{shape: "rect", bounds: pixel.R(-width/2, -height/2, width/2, height/2)}
+}
+
+func NewCircleArena(radius float64) *Arena {
+	return &Arena{shape: "circle", bounds: pixel.R(-radius, -radius, radius, radius), radius: radius}
+}
+
+// NewPolygonArena takes the corners of a convex polygon, in either direction
+func NewPolygonArena(points ...pixel.Vec) *Arena {
+	a := &Arena{shape: "polygon", points: points}
+	a.bounds = pixel.R(points[0].X, points[0].Y, points[0].X, points[0].Y)
+	for _, p := range points[1:] {
+		a.bounds = a.bounds.Union(pixel.R(p.X, p.Y, p.X, p.Y))
+	}
+	// keep them anticlockwise, so inward is always to the left of each edge
+	area := 0.0
+	for i, p := range points {
+		q := points[(i+1)%len(points)]
+		area += p.X*q.Y - q.X*p.Y
+	}
+	if area < 0 {
+		for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+			points[i], points[j] = points[j], points[i]
+		}
+	}
+	return a
+}
+
+// NewRegularArena is a polygon with that many equal sides, its corners radius from the middle
+func NewRegularArena(sides int, radius float64) *Arena {
+	points := make([]pixel.Vec, sides)
+	for i := range points {
+		points[i] = pixel.V(0, radius).Rotated(2 * math.Pi * float64(i) / float64(sides))
+	}
+	return NewPolygonArena(points...)
+}
+
+// Arenas modes can pick by name. Classic is the one every mode has had so far,
+// small ones make for claustrophobic fights and large ones scroll around.
+// The last few have obstacles to hide behind.
+var arenaNames = []string{"classic", "small", "large", "circle", "octagon", "pillars", "walls", "windmill"}
+
+func NewArena(name string) *Arena {
+	var a *Arena
+	switch name {
+	case "small":
+		a = NewRectArena(900, 640)
+	case "large":
+		a = NewRectArena(3000, 2000)
+	case "circle":
+		a = NewCircleArena(620)
+	case "octagon":
+		a = NewRegularArena(8, 700)
+	case "pillars":
+		a = NewRectArena(worldWidth, worldHeight)
+		for _, corner := range a.Corners(360) {
+			a.obstacles = append(a.obstacles, NewPillar(corner, 60))
+		}
+	case "walls":
+		// two walls with a gap between them, and one on either side to funnel things through it
+		a = NewRectArena(worldWidth, worldHeight)
+		a.obstacles = []*obstacle{
+			NewWall(pixel.V(0, 120), pixel.V(0, 420), 32),
+			NewWall(pixel.V(0, -120), pixel.V(0, -420), 32),
+			NewWall(pixel.V(-500, -150), pixel.V(-500, 150), 32),
+			NewWall(pixel.V(500, -150), pixel.V(500, 150), 32),
+		}
+	case "windmill":
+		a = NewCircleArena(700)
+		a.obstacles = []*obstacle{
+			NewBar(pixel.V(-350, 0), 400, 24, 0.5),
+			NewBar(pixel.V(350, 0), 400, 24, -0.5),
+		}
+	default:
+		name = "classic"
+		a = NewRectArena(worldWidth, worldHeight)
+	}
+	a.name = name
+	return a
+}
+
+func NewDefaultArena() *Arena {
+	return NewArena("classic")
+}
+
+// nextArena is the arena after this one, for trying them out from the debug console
+func nextArena(current *Arena) *Arena {
+	for i, name := range arenaNames {
+		if name == current.name {
+			return NewArena(arenaNames[(i+1)%len(arenaNames)])
+		}
+	}
+	return NewDefaultArena()
+}
+
+func (a *Arena) Bounds() pixel.Rect {
+	return a.bounds
+}
+
+func (a *Arena) Contains(v pixel.Vec) bool {
+	switch a.shape {
+	case "circle":
+		return v.Len() <= a.radius
+	case "polygon":
+		for i, p := range a.points {
+			if a.points[(i+1)%len(a.points)].Sub(p).Cross(v.Sub(p)) < 0 {
+				return false
+			}
+		}
+		return true
+	default:
+		return a.bounds.Contains(v)
+	}
+}
+
+// Clamp is the closest point to v that's at least margin inside the arena, or v if it already is
+func (a *Arena) Clamp(v pixel.Vec, margin float64) pixel.Vec {
+	switch a.shape {
+	case "circle":
+		r := math.Max(0, a.radius-margin)
+		if v.Len() > r {
+			return v.Unit().Scaled(r)
+		}
+		return v
+	case "polygon":
+		if a.depth(v) >= margin {
+			return v
+		}
+		// the closest point on the edge of the polygon shrunk by margin, which near a corner is the corner
+		inset := a.inset(margin)
+		if inset == nil {
+			return a.centre()
+		}
+		closest, best := v, math.Inf(1)
+		for i, p := range inset {
+			edge := inset[(i+1)%len(inset)].Sub(p)
+			t := 0.0
+			if l := edge.Dot(edge); l > 0 {
+				t = math.Max(0, math.Min(1, v.Sub(p).Dot(edge)/l))
+			}
+			if c := p.Add(edge.Scaled(t)); c.To(v).Len() < best {
+				closest, best = c, c.To(v).Len()
+			}
+		}
+		return closest
+	default:
+		inner := a.bounds
+		inner.Min = inner.Min.Add(pixel.V(margin, margin))
+		inner.Max = inner.Max.Sub(pixel.V(margin, margin))
+		return pixel.V(
+			math.Max(inner.Min.X, math.Min(inner.Max.X, v.X)),
+			math.Max(inner.Min.Y, math.Min(inner.Max.Y, v.Y)),
+		)
+	}
+}
+
+// depth is how far inside a polygon arena's nearest edge v is, negative when it's outside
+func (a *Arena) depth(v pixel.Vec) float64 {
+	depth := math.Inf(1)
+	for i, p := range a.points {
+		inward := a.points[(i+1)%len(a.points)].Sub(p).Normal().Unit()
+		depth = math.Min(depth, v.Sub(p).Dot(inward))
+	}
+	return depth
+}
+
+// inset is a polygon arena's corners with every edge moved margin inwards, or nil if there's nothing left of it
+func (a *Arena) inset(margin float64) []pixel.Vec {
+	n := len(a.points)
+	inset := make([]pixel.Vec, n)
+	for i, p := range a.points {
+		prev := a.points[(i+n-1)%n]
+		d1, d2 := p.Sub(prev), a.points[(i+1)%n].Sub(p)
+		from := prev.Add(d1.Normal().Unit().Scaled(margin))
+		to := p.Add(d2.Normal().Unit().Scaled(margin))
+		inset[i] = from.Add(d1.Scaled(from.To(to).Cross(d2) / d1.Cross(d2)))
+	}
+	// past the middle, the moved edges cross over and the corners end up outside the others
+	for _, p := range inset {
+		if a.depth(p) < margin-1e-6 {
+			return nil
+		}
+	}
+	return inset
+}
+
+// centre is the middle of a polygon arena's corners
+func (a *Arena) centre() pixel.Vec {
+	sum := pixel.ZV
+	for _, p := range a.points {
+		sum = sum.Add(p)
+	}
+	return sum.Scaled(1 / float64(len(a.points)))
+}
+
+// Reflect keeps something margin inside the arena, bouncing its velocity off whichever edge it went through
+func (a *Arena) Reflect(pos pixel.Vec, velocity pixel.Vec, margin float64) (pixel.Vec, pixel.Vec, bool) {
+	clamped := a.Clamp(pos, margin)
+	if clamped == pos {
+		return pos, velocity, false
+	}
+	if a.shape == "rect" {
+		// each side on its own, so a corner bounces straight back out of it
+		if clamped.X > pos.X {
+			velocity.X = math.Abs(velocity.X)
+		} else if clamped.X < pos.X {
+			velocity.X = -math.Abs(velocity.X)
+		}
+		if clamped.Y > pos.Y {
+			velocity.Y = math.Abs(velocity.Y)
+		} else if clamped.Y < pos.Y {
+			velocity.Y = -math.Abs(velocity.Y)
+		}
+		return clamped, velocity, true
+	}
+	inward := clamped.Sub(pos).Unit()
+	if d := velocity.Dot(inward); d < 0 {
+		velocity = velocity.Sub(inward.Scaled(2 * d))
+	}
+	return clamped, velocity, true
+}
+
+// RandomPoint is anywhere at least margin inside the arena, and out of the obstacles
+func (a *Arena) RandomPoint(margin float64) pixel.Vec {
+	v := a.randomPoint(margin)
+	for i := 0; i < 32 && a.Blocked(v, margin); i++ {
+		v = a.randomPoint(margin)
+	}
+	return v
+}
+
+func (a *Arena) randomPoint(margin float64) pixel.Vec {
+	switch a.shape {
+	case "circle":
+		r := math.Max(0, a.radius-margin) * math.Sqrt(rand.Float64())
+		return pixel.V(r, 0).Rotated(rand.Float64() * 2 * math.Pi)
+	case "polygon":
+		for i := 0; i < 32; i++ {
+			v := pixel.V(
+				a.bounds.Min.X+rand.Float64()*a.bounds.W(),
+				a.bounds.Min.Y+rand.Float64()*a.bounds.H(),
+			)
+			if a.Clamp(v, margin) == v {
+				return v
+			}
+		}
+		return a.Clamp(a.bounds.Center(), margin)
+	default:
+		return pixel.V(
+			a.bounds.Min.X+margin+rand.Float64()*math.Max(0, a.bounds.W()-margin*2),
+			a.bounds.Min.Y+margin+rand.Float64()*math.Max(0, a.bounds.H()-margin*2),
+		)
+	}
+}
+
+// Corners are the four furthest out spots, inset from the edge: bottom left, top left, bottom right then top right
+func (a *Arena) Corners(inset float64) [4]pixel.Vec {
+	b := a.bounds
+	return [4]pixel.Vec{
+		a.Clamp(b.Min, inset),
+		a.Clamp(pixel.V(b.Min.X, b.Max.Y), inset),
+		a.Clamp(pixel.V(b.Max.X, b.Min.Y), inset),
+		a.Clamp(b.Max, inset),
+	}
+}
+
+// Outline is the edge of the arena as a closed polygon
+func (a *Arena) Outline() []pixel.Vec {
+	switch a.shape {
+	case "circle":
+		points := make([]pixel.Vec, arenaCircleSegments)
+		for i := range points {
+			points[i] = pixel.V(a.radius, 0).Rotated(2 * math.Pi * float64(i) / arenaCircleSegments)
+		}
+		return points
+	case "polygon":
+		return a.points
+	default:
+		b := a.bounds
+		return []pixel.Vec{b.Min, pixel.V(b.Min.X, b.Max.Y), b.Max, pixel.V(b.Max.X, b.Min.Y)}
+	}
+}
@@ -0,0 +1,142 @@
+package starshipkepler
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// insideBy is how far v is inside the arena's nearest edge, negative when it's outside
+func insideBy(a *Arena, v pixel.Vec) float64 {
+	switch a.shape {
+	case "circle":
+		return a.radius - v.Len()
+	case "polygon":
+		return a.depth(v)
+	default:
+		b := a.bounds
+		return math.Min(math.Min(v.X-b.Min.X, b.Max.X-v.X), math.Min(v.Y-b.Min.Y, b.Max.Y-v.Y))
+	}
+}
+
+func TestPolygonArenaWinding(t *testing.T) {
+	square := []pixel.Vec{pixel.V(-100, -100), pixel.V(100, -100), pixel.V(100, 100), pixel.V(-100, 100)}
+	clockwise := []pixel.Vec{pixel.V(-100, -100), pixel.V(-100, 100), pixel.V(100, 100), pixel.V(100, -100)}
+
+	for name, points := range map[string][]pixel.Vec{"anticlockwise": square, "clockwise": clockwise} {
+		a := NewPolygonArena(points...)
+		area := 0.0
+		for i, p := range a.points {
+			q := a.points[(i+1)%len(a.points)]
+			area += p.X*q.Y - q.X*p.Y
+		}
+		if area <= 0 {
+			t.Errorf("%s: expected the points anticlockwise, got %v", name, a.points)
+		}
+		if a.bounds != pixel.R(-100, -100, 100, 100) {
+			t.Errorf("%s: expected bounds around the square, got %v", name, a.bounds)
+		}
+
+		cases := []struct {
+			v    pixel.Vec
+			want bool
+		}{
+			{pixel.ZV, true},
+			{pixel.V(99, -99), true},
+			{pixel.V(100, 0), true},
+			{pixel.V(101, 0), false},
+			{pixel.V(0, -150), false},
+			{pixel.V(-120, 120), false},
+		}
+		for _, c := range cases {
+			if got := a.Contains(c.v); got != c.want {
+				t.Errorf("%s: Contains(%v) = %v, expected %v", name, c.v, got, c.want)
+			}
+		}
+	}
+}
+
+// Clamping well outside a corner has to push off both edges, and should end up inside both, however sharp it is
+func TestPolygonArenaClampCorners(t *testing.T) {
+	arenas := map[string]*Arena{
+		"octagon":  NewRegularArena(8, 700),
+		"triangle": NewRegularArena(3, 500),
+		"square":   NewPolygonArena(pixel.V(-100, -100), pixel.V(100, -100), pixel.V(100, 100), pixel.V(-100, 100)),
+	}
+	margin := 20.0
+	for name, a := range arenas {
+		for _, corner := range a.points {
+			for _, far := range []float64{1.05, 1.5, 3} {
+				v := a.Clamp(corner.Scaled(far), margin)
+				if depth := insideBy(a, v); depth < margin-1e-6 {
+					t.Errorf("%s: clamping %v left it %.2f inside, expected %v", name, corner.Scaled(far), depth, margin)
+				}
+			}
+		}
+		if v := a.Clamp(pixel.ZV, 5000); v.Len() > 1e-6 {
+			t.Errorf("%s: expected a margin bigger than the arena to give the middle, got %v", name, v)
+		}
+		inside := pixel.V(1, 2)
+		if v := a.Clamp(inside, margin); v != inside {
+			t.Errorf("%s: expected a point well inside to stay put, got %v", name, v)
+		}
+	}
+}
+
+func TestRectArenaReflect(t *testing.T) {
+	a := NewRectArena(200, 100)
+	cases := []struct {
+		name     string
+		pos      pixel.Vec
+		velocity pixel.Vec
+		wantPos  pixel.Vec
+		wantVel  pixel.Vec
+		bounced  bool
+	}{
+		{"inside", pixel.V(0, 0), pixel.V(5, 5), pixel.V(0, 0), pixel.V(5, 5), false},
+		{"through the right", pixel.V(105, 10), pixel.V(5, 3), pixel.V(90, 10), pixel.V(-5, 3), true},
+		{"through the bottom", pixel.V(-20, -60), pixel.V(-2, -4), pixel.V(-20, -40), pixel.V(-2, 4), true},
+		{"through a corner", pixel.V(-110, 55), pixel.V(-3, 7), pixel.V(-90, 40), pixel.V(3, -7), true},
+		{"already heading back", pixel.V(105, 0), pixel.V(-5, 0), pixel.V(90, 0), pixel.V(-5, 0), true},
+	}
+	for _, c := range cases {
+		pos, vel, bounced := a.Reflect(c.pos, c.velocity, 10)
+		if pos != c.wantPos || vel != c.wantVel || bounced != c.bounced {
+			t.Errorf("%s: expected %v %v %v, got %v %v %v", c.name, c.wantPos, c.wantVel, c.bounced, pos, vel, bounced)
+		}
+	}
+}
+
+func TestCircleArenaClamp(t *testing.T) {
+	a := NewCircleArena(100)
+	cases := []struct {
+		name   string
+		v      pixel.Vec
+		margin float64
+		want   pixel.Vec
+	}{
+		{"inside", pixel.V(10, 20), 10, pixel.V(10, 20)},
+		{"outside", pixel.V(300, 0), 10, pixel.V(90, 0)},
+		{"margin as big as the arena", pixel.V(0, 50), 100, pixel.ZV},
+		{"margin bigger than the arena", pixel.V(0, 50), 150, pixel.ZV},
+	}
+	for _, c := range cases {
+		if got := a.Clamp(c.v, c.margin); got.To(c.want).Len() > 1e-9 {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestArenaRandomPointMargin(t *testing.T) {
+	rand.Seed(1)
+	for _, name := range []string{"classic", "small", "circle", "octagon"} {
+		a := NewArena(name)
+		for i := 0; i < 500; i++ {
+			if v := a.RandomPoint(60); insideBy(a, v) < 60-1e-6 {
+				t.Fatalf("%s: %v is only %.2f inside, expected 60", name, v, insideBy(a, v))
+			}
+		}
+	}
+}
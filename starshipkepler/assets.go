@@ -0,0 +1,190 @@
+package starshipkepler
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/faiface/pixel"
+)
+
+// Where an asset ended up being loaded from
+const (
+	assetFromOverride    = "override"
+	assetFromEmbedded    = "embedded"
+	assetFromPlaceholder = "placeholder"
+)
+
+type AssetRecord struct {
+	Path   string
+	Source string
+	Err    error
+}
+
+// Assets are resolved from the override directory first (so they can be modded without a rebuild),
+// then from the defaults baked into the binary. Anything missing from both gets a placeholder.
+type assetManager struct {
+	overrideDir string
+	defaults    fs.FS
+
+	mu      sync.Mutex
+	records map[string]AssetRecord
+}
+
+// Until InitAssets is called, assets are read relative to the working directory like they always were
+var assets = newAssetManager(".", nil)
+
+func newAssetManager(overrideDir string, defaults fs.FS) *assetManager {
+	return &assetManager{
+		overrideDir: overrideDir,
+		defaults:    defaults,
+		records:     map[string]AssetRecord{},
+	}
+}
+
+// InitAssets must be called before any audio or drawing is initialised.
+func InitAssets(overrideDir string, defaults fs.FS) {
+	assets = newAssetManager(overrideDir, defaults)
+}
+
+func cleanAssetPath(name string) string {
+	return strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "/")
+}
+
+func (a *assetManager) record(name string, source string, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records[name] = AssetRecord{Path: name, Source: source, Err: err}
+}
+
+func (a *assetManager) ReadFile(name string) ([]byte, error) {
+	name = cleanAssetPath(name)
+
+	if a.overrideDir != "" {
+		data, err := ioutil.ReadFile(filepath.Join(a.overrideDir, filepath.FromSlash(name)))
+		if err == nil {
+			a.record(name, assetFromOverride, nil)
+			return data, nil
+		}
+	}
+
+	if a.defaults != nil {
+		data, err := fs.ReadFile(a.defaults, name)
+		if err == nil {
+			a.record(name, assetFromEmbedded, nil)
+			return data, nil
+		}
+	}
+
+	err := fmt.Errorf("asset not found: %s", name)
+	return nil, err
+}
+
+// Exists reports whether an asset can be found without recording it as loaded
+func (a *assetManager) Exists(name string) bool {
+	_, err := a.Stat(name)
+	return err == nil
+}
+
+// Stat describes an asset from wherever it would be loaded, without recording it as loaded
+func (a *assetManager) Stat(name string) (fs.FileInfo, error) {
+	name = cleanAssetPath(name)
+	if a.overrideDir != "" {
+		if info, err := os.Stat(filepath.Join(a.overrideDir, filepath.FromSlash(name))); err == nil {
+			return info, nil
+		}
+	}
+	if a.defaults != nil {
+		if info, err := fs.Stat(a.defaults, name); err == nil {
+			return info, nil
+		}
+	}
+	return nil, fmt.Errorf("asset not found: %s", name)
+}
+
+// ModTime is when an asset in the override directory was last changed, for reloading it while the
+// game runs. Embedded assets can't change, so they (and anything missing) get the zero time.
+func (a *assetManager) ModTime(name string) time.Time {
+	if a.overrideDir == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(filepath.Join(a.overrideDir, filepath.FromSlash(cleanAssetPath(name))))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Open returns the whole asset in memory. Decoders like to seek, and embedded files are small enough.
+func (a *assetManager) Open(name string) (io.ReadSeekCloser, error) {
+	data, err := a.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return nopSeekCloser{bytes.NewReader(data)}, nil
+}
+
+// Placeholder logs a missing asset and records that something was substituted for it
+func (a *assetManager) Placeholder(name string, err error) {
+	name = cleanAssetPath(name)
+	log.Printf("[Assets] %s unavailable, substituting placeholder: %v\n", name, err)
+	a.record(name, assetFromPlaceholder, err)
+}
+
+func (a *assetManager) LoadedAssets() []AssetRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	loaded := make([]AssetRecord, 0, len(a.records))
+	for _, r := range a.records {
+		loaded = append(loaded, r)
+	}
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].Path < loaded[j].Path
+	})
+	return loaded
+}
+
+func LoadedAssets() []AssetRecord {
+	return assets.LoadedAssets()
+}
+
+func PrintAssetReport(w io.Writer) {
+	for _, r := range assets.LoadedAssets() {
+		fmt.Fprintf(w, "%-12s %s\n", r.Source, r.Path)
+	}
+}
+
+type nopSeekCloser struct {
+	*bytes.Reader
+}
+
+func (nopSeekCloser) Close() error { return nil }
+
+// A soft white disc, which is at least recognisable when tinted like a ward
+func placeholderPicture() pixel.Picture {
+	size := 64
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	c := float64(size) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := float64(x)-c, float64(y)-c
+			if dx*dx+dy*dy <= c*c {
+				img.Set(x, y, color.RGBA{0xff, 0xff, 0xff, 0x80})
+			}
+		}
+	}
+	return pixel.PictureDataFromImage(img)
+}
@@ -0,0 +1,186 @@
+package starshipkepler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/speaker"
+	"github.com/faiface/beep/wav"
+)
+
+// AudioBackend is where the mixed audio ends up. The mixer hands it a single streamer,
+// and locks it whenever it changes what's playing.
+type AudioBackend interface {
+	Init(format beep.Format) error
+	Play(s beep.Streamer)
+	Lock()
+	Unlock()
+	// EndFrame is called once per game update
+	EndFrame()
+	Close() error
+}
+
+// speakerBackend plays through the sound card. It needs a real audio device.
+type speakerBackend struct{}
+
+func NewSpeakerBackend() AudioBackend {
+	return &speakerBackend{}
+}
+
+func (s *speakerBackend) Init(format beep.Format) error {
+	return speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/10))
+}
+
+func (s *speakerBackend) Play(streamer beep.Streamer) { speaker.Play(streamer) }
+func (s *speakerBackend) Lock()                       { speaker.Lock() }
+func (s *speakerBackend) Unlock()                     { speaker.Unlock() }
+func (s *speakerBackend) EndFrame()                   {}
+
+func (s *speakerBackend) Close() error {
+	speaker.Close()
+	return nil
+}
+
+// How much audio an offline backend renders per game update
+const offlineFrameRate = 60
+
+// CapturedSound is a named sound that was played while running offline
+type CapturedSound struct {
+	Frame int
+	Time  time.Duration
+	Name  string
+}
+
+// offlineBackend renders audio without a device, a fixed slice of time per frame,
+// so that a run produces the same audio no matter how fast it goes.
+// Without a path it throws the audio away (which still lets sounds finish and free their voices),
+// with a path it writes everything to a WAV file on Close, plus a log of which sounds played when.
+type offlineBackend struct {
+	mu       sync.Mutex
+	format   beep.Format
+	streamer beep.Streamer
+	scratch  [][2]float64
+
+	path    string
+	capture *beep.Buffer
+
+	frame  int
+	sounds []CapturedSound
+}
+
+// NewNullBackend discards all audio. It's used by -audio none, and as the fallback when the device won't open.
+func NewNullBackend() AudioBackend {
+	return &offlineBackend{format: defaultSoundFormat}
+}
+
+// NewCaptureBackend mixes everything played into a WAV file at path
+func NewCaptureBackend(path string) AudioBackend {
+	return &offlineBackend{format: defaultSoundFormat, path: path}
+}
+
+func (o *offlineBackend) Init(format beep.Format) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.format = format
+	o.scratch = make([][2]float64, format.SampleRate.N(time.Second/offlineFrameRate))
+	if o.path != "" {
+		o.capture = beep.NewBuffer(format)
+	}
+	return nil
+}
+
+func (o *offlineBackend) Play(s beep.Streamer) {
+	o.mu.Lock()
+	o.streamer = s
+	o.mu.Unlock()
+}
+
+func (o *offlineBackend) Lock()   { o.mu.Lock() }
+func (o *offlineBackend) Unlock() { o.mu.Unlock() }
+
+func (o *offlineBackend) EndFrame() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.frame++
+	if o.streamer == nil || len(o.scratch) == 0 {
+		return
+	}
+
+	// the mixer never runs dry, it just streams silence
+	for i := range o.scratch {
+		o.scratch[i] = [2]float64{}
+	}
+	n, _ := o.streamer.Stream(o.scratch)
+	if o.capture != nil {
+		o.capture.Append(&sliceStreamer{samples: o.scratch[:n]})
+	}
+}
+
+func (o *offlineBackend) logSound(name string) {
+	o.mu.Lock()
+	o.sounds = append(o.sounds, CapturedSound{
+		Frame: o.frame,
+		Time:  time.Duration(o.frame) * time.Second / offlineFrameRate,
+		Name:  name,
+	})
+	o.mu.Unlock()
+}
+
+// Sounds returns every named sound played so far, in order
+func (o *offlineBackend) Sounds() []CapturedSound {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]CapturedSound{}, o.sounds...)
+}
+
+func (o *offlineBackend) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.capture == nil {
+		return nil
+	}
+
+	f, err := os.Create(o.path)
+	if err != nil {
+		return err
+	}
+	err = wav.Encode(f, o.capture.Streamer(0, o.capture.Len()), o.format)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	logPath := strings.TrimSuffix(o.path, filepath.Ext(o.path)) + ".log"
+	log, err := os.Create(logPath)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+	for _, s := range o.sounds {
+		fmt.Fprintf(log, "%d\t%.3fs\t%s\n", s.Frame, s.Time.Seconds(), s.Name)
+	}
+	fmt.Printf("[Audio] Captured %.1fs of audio to %s\n", float64(o.capture.Len())/float64(o.format.SampleRate), o.path)
+	return nil
+}
+
+// feeds one frame of rendered samples into a beep.Buffer
+type sliceStreamer struct {
+	samples [][2]float64
+}
+
+func (s *sliceStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	if len(s.samples) == 0 {
+		return 0, false
+	}
+	n = copy(samples, s.samples)
+	s.samples = s.samples[n:]
+	return n, true
+}
+
+func (s *sliceStreamer) Err() error { return nil }
@@ -0,0 +1,66 @@
+package starshipkepler
+
+import (
+	"math"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// Run with -bench . to compare the particle and grid updates on one core against the worker pool
+
+var updateModes = []struct {
+	name   string
+	serial bool
+}{
+	{"serial", true},
+	{"parallel", false},
+}
+
+// benchmarkParticles is a full particle pool that won't die off however long the run goes
+func benchmarkParticles() *particlePool {
+	particles := NewParticlePool(maxParticles)
+	for particles.count() < maxParticles {
+		particles.Emit("player/die", pixel.ZV, pixel.ZV, pixel.RGBA{R: 1, G: 1, B: 1, A: 1})
+	}
+	for i := range particles.particles {
+		particles.particles[i].duration = math.MaxFloat64
+	}
+	return particles
+}
+
+func BenchmarkParticlesUpdate(b *testing.B) {
+	serial := serialUpdates
+	defer SetSerialUpdates(serial)
+
+	for _, mode := range updateModes {
+		b.Run(mode.name, func(b *testing.B) {
+			SetSerialUpdates(mode.serial)
+			particles, arena := benchmarkParticles(), NewDefaultArena()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				particles.Update(1.0, arena)
+			}
+		})
+	}
+}
+
+func BenchmarkGridUpdate(b *testing.B) {
+	serial := serialUpdates
+	defer SetSerialUpdates(serial)
+
+	for _, mode := range updateModes {
+		b.Run(mode.name, func(b *testing.B) {
+			SetSerialUpdates(mode.serial)
+			g := newWorldGrid(gridThemes[0], NewDefaultArena())
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// keep it moving, a still grid is cheaper than a real one
+				if i%30 == 0 {
+					g.ApplyExplosiveForce(200, Vector3{0.0, 0.0, 0.0}, 500)
+				}
+				g.Update(1.0)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package starshipkepler
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/faiface/pixel"
+	"golang.org/x/image/colornames"
+)
+
+// BOSSES
+
+// Bosses are big enemies made of segments around a core, each with its own hp and an element it's weak to.
+// They fight in phases, getting nastier as they lose hp, and wind up every attack long enough to see it coming.
+
+type bossSegment struct {
+	offset   pixel.Vec // from the middle of the boss, before it's turned
+	radius   float64
+	hp       int
+	maxHp    int
+	weakness string  // bullets carrying this element do bossWeaknessMultiplier times the damage
+	core     bool    // shielded until every other segment is gone, and the boss goes down with it
+	flash    float64 // seconds left of flashing from a hit
+}
+
+type bossPhase struct {
+	banner    string   // announced when the phase starts
+	threshold float64  // the phase starts once the boss is down to this much of its hp
+	attacks   []string // one's picked at random after each rest
+	rest      float64  // seconds between attacks
+	speed     float64  // how fast it drifts after the player while resting
+	spin      float64  // radians per second
+}
+
+// bossAttack is how long an attack is telegraphed for before it goes off, and how long it goes on for after
+type bossAttack struct {
+	windup   float64
+	duration float64
+}
+
+var bossAttacks = map[string]bossAttack{
+	"charge": {windup: 1.0, duration: 0.6},
+	"slam":   {windup: 1.4, duration: 0.4},
+	"summon": {windup: 0.8, duration: 0.2},
+	"volley": {windup: 1.0, duration: 0.3},
+}
+
+const bossWeaknessMultiplier = 3
+const bossSlamRadius = 320.0
+const bossChargeSpeed = 1400.0
+const bossSpawnTime = 2.0 // seconds it takes to fade in, when it can't hurt or be hurt
+const bossHitFlash = 0.08
+
+// The order evolved mode sends them in
+var bossNames = []string{"warden", "hydra"}
+
+// How much notoriety between bosses in evolved mode
+const bossNotorietyStep = 1.0
+
+type boss struct {
+	name     string
+	title    string
+	origin   pixel.Vec
+	velocity pixel.Vec
+	angle    float64
+	radius   float64 // around the whole thing, for keeping it in the arena
+	segments []bossSegment
+	phases   []bossPhase
+	phase    int
+	bounty   int
+	spawning float64 // seconds left
+
+	attack       string  // what it's winding up or doing, "" while resting
+	attackTime   float64 // seconds since the attack (or the rest) started
+	attackTarget pixel.Vec
+	struck       bool // whether the attack has gone off yet
+	summonPoints []pixel.Vec
+}
+
+func NewBoss(name string, x float64, y float64) *boss {
+	b := &boss{name: name, origin: pixel.V(x, y), spawning: bossSpawnTime}
+	switch name {
+	case "hydra":
+		b.title = "The Hydra"
+		b.bounty = 25000
+		b.segments = []bossSegment{{radius: 48, hp: 80, weakness: "life", core: true}}
+		for i, weakness := range []string{"chaos", "fire", "water", "chaos", "fire", "water"} {
+			b.segments = append(b.segments, bossSegment{
+				offset:   pixel.V(104, 0).Rotated(float64(i) * math.Pi / 3),
+				radius:   28,
+				hp:       18,
+				weakness: weakness,
+			})
+		}
+		b.phases = []bossPhase{
+			{threshold: 1.0, attacks: []string{"summon", "slam"}, rest: 2.0, speed: 140, spin: 0.9},
+			{banner: "The Hydra thrashes", threshold: 0.5, attacks: []string{"charge", "summon", "volley"}, rest: 1.4, speed: 180, spin: -1.6},
+			{banner: "The Hydra is cornered", threshold: 0.2, attacks: []string{"charge", "slam", "charge"}, rest: 0.8, speed: 240, spin: 3.0},
+		}
+	default:
+		b.name = "warden"
+		b.title = "The Warden"
+		b.bounty = 20000
+		b.segments = []bossSegment{{radius: 56, hp: 60, weakness: "spirit", core: true}}
+		for i, weakness := range []string{"fire", "water", "wind", "lightning"} {
+			b.segments = append(b.segments, bossSegment{
+				offset:   pixel.V(112, 0).Rotated(float64(i) * math.Pi / 2),
+				radius:   34,
+				hp:       25,
+				weakness: weakness,
+			})
+		}
+		b.phases = []bossPhase{
+			{threshold: 1.0, attacks: []string{"summon", "charge"}, rest: 2.5, speed: 120, spin: 0.6},
+			{banner: "The Warden is angry", threshold: 0.6, attacks: []string{"charge", "slam", "volley"}, rest: 1.8, speed: 160, spin: 1.2},
+			{banner: "The Warden is desperate", threshold: 0.25, attacks: []string{"charge", "slam", "summon"}, rest: 1.0, speed: 220, spin: 2.4},
+		}
+	}
+
+	for i, s := range b.segments {
+		b.segments[i].maxHp = s.hp
+		b.radius = math.Max(b.radius, s.offset.Len()+s.radius)
+	}
+	return b
+}
+
+func (b *boss) segmentPos(i int) pixel.Vec {
+	return b.origin.Add(b.segments[i].offset.Rotated(b.angle))
+}
+
+// shielded is whether a segment can't be hurt yet, the core is until the rest are gone
+func (b *boss) shielded(i int) bool {
+	if !b.segments[i].core {
+		return false
+	}
+	for _, s := range b.segments {
+		if !s.core && s.hp > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Health is how much of its hp the boss has left, from 1 down to 0
+func (b *boss) Health() float64 {
+	hp, maxHp := 0, 0
+	for _, s := range b.segments {
+		hp += s.hp
+		maxHp += s.maxHp
+	}
+	return float64(hp) / float64(maxHp)
+}
+
+func (b *boss) alive() bool {
+	for _, s := range b.segments {
+		if s.core && s.hp > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// regroup moves the boss somewhere away from the player to fade back in, and calls off whatever it was doing
+func (b *boss) regroup(arena *Arena, player pixel.Vec) {
+	pos := arena.RandomPoint(b.radius)
+	for tries := 0; pos.Sub(player).Len() < 600 && tries < 32; tries++ {
+		pos = arena.RandomPoint(b.radius)
+	}
+	b.origin = pos
+	b.velocity = pixel.ZV
+	b.spawning = bossSpawnTime
+	b.attack = ""
+	b.attackTime = 0
+}
+
+// spawnBoss brings a boss in somewhere away from the player
+func (game *game) spawnBoss(name string) {
+	b := NewBoss(name, 0, 0)
+	b.regroup(game.data.arena, game.data.player.origin)
+	game.data.boss = b
+
+	game.data.Announce(fmt.Sprintf("%s approaches", b.title), game.lastFrame)
+	PlaySoundAt("boss/spawn", b.origin)
+	game.grid.ApplyImplosiveForce(400, Vector3{b.origin.X, b.origin.Y, 0.0}, 400)
+	fmt.Printf("[Boss] %s\n", b.title)
+}
+
+// updateBoss moves the boss, runs its attacks, and checks if it's caught the player
+func (game *game) updateBoss(dt float64, player *entityData) {
+	b := game.data.boss
+	if b == nil {
+		return
+	}
+	for i := range b.segments {
+		b.segments[i].flash = math.Max(0, b.segments[i].flash-dt)
+	}
+	if b.spawning > 0 {
+		b.spawning -= dt
+		return
+	}
+
+	phase := b.phases[b.phase]
+	b.attackTime += dt
+	b.angle += phase.spin * dt
+
+	if b.attack == "" {
+		// resting, drifting after the player
+		if player.alive {
+			dir := game.data.flow.Direction(b.origin, player.origin)
+			b.velocity = pixel.Lerp(b.velocity, dir.Scaled(phase.speed), 1-math.Pow(1.0/8, dt))
+		}
+		if b.attackTime >= phase.rest && player.alive {
+			b.startAttack(phase.attacks[rand.Intn(len(phase.attacks))], player, game.data.arena)
+		}
+	} else {
+		attack := bossAttacks[b.attack]
+		if b.attackTime < attack.windup {
+			// hold still while winding up, so the telegraph reads
+			b.velocity = b.velocity.Scaled(math.Pow(1.0/32, dt))
+		} else {
+			if !b.struck {
+				b.struck = true
+				game.bossStrike(player)
+			}
+			if b.attackTime >= attack.windup+attack.duration {
+				b.attack = ""
+				b.attackTime = 0
+			}
+		}
+	}
+
+	b.origin = b.origin.Add(b.velocity.Scaled(dt))
+	b.origin, b.velocity, _ = game.data.arena.Collide(b.origin, b.velocity, b.radius, true)
+
+	// running into any of it is fatal
+	if player.alive && !g_debug {
+		for i, s := range b.segments {
+			if s.hp > 0 && b.segmentPos(i).To(player.origin).Len() < s.radius+player.radius {
+				game.killPlayer(player, game.lastFrame)
+				break
+			}
+		}
+	}
+}
+
+func (b *boss) startAttack(attack string, player *entityData, arena *Arena) {
+	b.attack = attack
+	b.attackTime = 0
+	b.struck = false
+	b.attackTarget = player.origin
+	b.summonPoints = nil
+	if attack == "summon" {
+		for i := 0; i < 4; i++ {
+			pos := b.origin.Add(pixel.V(b.radius+80, 0).Rotated(b.angle + float64(i)*math.Pi/2))
+			b.summonPoints = append(b.summonPoints, arena.Clamp(pos, 32))
+		}
+	}
+}
+
+// bossStrike is the moment the attack the boss was winding up goes off
+func (game *game) bossStrike(player *entityData) {
+	b := game.data.boss
+	switch b.attack {
+	case "charge":
+		b.velocity = b.origin.To(b.attackTarget).Unit().Scaled(bossChargeSpeed)
+		game.grid.ApplyExplosiveForce(200, Vector3{b.origin.X, b.origin.Y, 0.0}, 200)
+	case "slam":
+		PlaySoundAt("boss/slam", b.origin)
+		game.Camera.Shake(0.6)
+		game.grid.ApplyExplosiveForce(600, Vector3{b.origin.X, b.origin.Y, 0.0}, bossSlamRadius*1.5)
+		game.data.particles.Emit("ring", b.origin, pixel.ZV, pixel.ToRGBA(colornames.Orangered))
+		if player.alive && !g_debug && b.origin.To(player.origin).Len() < bossSlamRadius {
+			game.killPlayer(player, game.lastFrame)
+		}
+	case "summon":
+		for _, pos := range b.summonPoints {
+			minion := *NewFollower(pos.X, pos.Y)
+			game.data.newEntities = InlineAppendEntities(game.data.newEntities, minion)
+		}
+	case "volley":
+		// a ring of stars in the core's element, so the ward it's weak to soaks them up too
+		PlaySoundAt("enemy/shoot", b.origin)
+		for i, s := range b.segments {
+			if s.core {
+				game.data.projectiles.Fire("boss/volley", b.segmentPos(i), pixel.V(1, 0).Rotated(b.angle), s.weakness)
+			}
+		}
+	}
+}
+
+// hitBoss is whether a bullet hit the boss, taking the hit out of whichever segment it struck
+func (game *game) hitBoss(bullet *bullet) bool {
+	b := game.data.boss
+	if b == nil || b.spawning > 0 {
+		return false
+	}
+	for i, s := range b.segments {
+		pos := b.segmentPos(i)
+		if s.hp <= 0 || pos.To(bullet.data.origin).Len() > s.radius+bullet.width/2 {
+			continue
+		}
+		if b.shielded(i) {
+			game.data.particles.Emit("bullet/edge", bullet.data.origin, pixel.ZV, pixel.ToRGBA(colornames.Lightblue))
+			return true
+		}
+
+		damage := 1
+		for _, el := range bullet.data.elements {
+			if el == s.weakness {
+				damage = bossWeaknessMultiplier
+			}
+		}
+		s.hp = int(math.Max(0, float64(s.hp-damage)))
+		s.flash = bossHitFlash
+		b.segments[i] = s
+		PlaySoundAt("boss/hit", pos)
+
+		if s.hp == 0 {
+			game.bossSegmentDestroyed(i)
+		}
+		game.bossCheckPhase()
+		return true
+	}
+	return false
+}
+
+func (game *game) bossSegmentDestroyed(i int) {
+	b := game.data.boss
+	pos := b.segmentPos(i)
+	s := b.segments[i]
+	PlaySoundAt("boss/segment", pos)
+	game.Camera.Shake(0.3)
+	game.grid.ApplyExplosiveForce(300, Vector3{pos.X, pos.Y, 0.0}, 250)
+	game.data.particles.Emit("entity/die", pos, pixel.ZV, pixel.ToRGBA(elementColour(s.weakness)))
+
+	reward := 500 * game.data.scoreMultiplier
+	if s.core {
+		reward = b.bounty * game.data.scoreMultiplier
+	}
+	game.data.score += reward
+	game.data.scoreSinceBorn += reward
+
+	if b.alive() {
+		return
+	}
+
+	// the core's gone, so is the boss. It leaves behind an essence of everything it was weak to
+	PlaySoundAt("boss/die", b.origin)
+	game.Camera.Shake(1.0)
+	game.Camera.PulseZoom(0.1)
+	game.data.particles.Emit("blackhole/die", b.origin, pixel.ZV, pixel.ToRGBA(colornames.Orangered))
+	game.data.Announce(fmt.Sprintf("%s destroyed", b.title), game.lastFrame)
+	for i, s := range b.segments {
+		pos := b.segmentPos(i)
+		essence := *NewEssence(pos.X, pos.Y, s.weakness, game.lastFrame.Add(time.Duration(8)*time.Second))
+		game.data.newEntities = InlineAppendEntities(game.data.newEntities, essence)
+	}
+	game.data.kills++
+	game.data.boss = nil
+}
+
+// bossCheckPhase moves the boss on to its next phase once it's lost enough hp
+func (game *game) bossCheckPhase() {
+	b := game.data.boss
+	if b == nil || b.phase+1 >= len(b.phases) || b.Health() > b.phases[b.phase+1].threshold {
+		return
+	}
+	b.phase++
+	b.attack = ""
+	b.attackTime = 0
+	game.data.Announce(b.phases[b.phase].banner, game.lastFrame)
+	game.Camera.Shake(0.5)
+	game.Camera.PulseZoom(0.05)
+}
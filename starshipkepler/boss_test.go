@@ -0,0 +1,90 @@
+package starshipkepler
+
+import (
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// shootSegment hits one of the boss's segments with a bullet carrying element
+func shootSegment(game *game, i int, element string) bool {
+	pos := game.data.boss.segmentPos(i)
+	b := NewBullet(pos.X, pos.Y, 10, 20, 0, pixel.ZV, []string{element}, 1, 1)
+	return game.hitBoss(b)
+}
+
+// The warden's phases start at 60% and 25% of its hp, and not a hit before
+func TestBossPhaseThresholds(t *testing.T) {
+	game := newGoldenGame()
+	game.data.boss = NewBoss("warden", 0, 0)
+	b := game.data.boss
+	b.spawning = 0
+
+	for i := range b.segments {
+		if b.segments[i].core {
+			continue
+		}
+		for b.segments[i].hp > 0 {
+			if !shootSegment(game, i, b.segments[i].weakness) {
+				t.Fatalf("missed segment %d", i)
+			}
+			want := 0
+			for p := range b.phases {
+				if b.Health() <= b.phases[p].threshold {
+					want = p
+				}
+			}
+			if b.phase != want {
+				t.Fatalf("at %.2f health expected phase %d, got %d", b.Health(), want, b.phase)
+			}
+		}
+	}
+	if b.phase != 1 {
+		t.Errorf("expected the outer segments to be worth one phase, got to phase %d", b.phase)
+	}
+}
+
+// The core can't be hurt until every other segment is gone, and the boss goes with it
+func TestBossCoreShielded(t *testing.T) {
+	game := newGoldenGame()
+	game.data.boss = NewBoss("hydra", 0, 0)
+	b := game.data.boss
+	b.spawning = 0
+
+	core := -1
+	for i, s := range b.segments {
+		if s.core {
+			core = i
+		}
+	}
+
+	for i := range b.segments {
+		if i == core {
+			continue
+		}
+		before := b.segments[core].hp
+		if !b.shielded(core) || !shootSegment(game, core, b.segments[core].weakness) || b.segments[core].hp != before {
+			t.Fatalf("expected the core to shrug off hits with segment %d still up", i)
+		}
+		for b.segments[i].hp > 0 {
+			shootSegment(game, i, b.segments[i].weakness)
+		}
+	}
+
+	if b.shielded(core) {
+		t.Fatal("expected the core to be open with the other segments gone")
+	}
+	for game.data.boss != nil && b.segments[core].hp > 0 {
+		before := b.segments[core].hp
+		shootSegment(game, core, b.segments[core].weakness)
+		if b.segments[core].hp >= before {
+			t.Fatal("expected the core to take damage")
+		}
+	}
+	if game.data.boss != nil {
+		t.Error("expected the boss to be gone with its core")
+	}
+	if len(game.data.newEntities) != len(b.segments) {
+		t.Errorf("expected an essence for each segment, got %d", len(game.data.newEntities))
+	}
+}
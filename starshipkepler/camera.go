@@ -0,0 +1,123 @@
+package starshipkepler
+
+import (
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// Camera is what the arena is seen through. Screen space is the primary canvas,
+// with the origin in the middle and a unit per pixel at a zoom of 1.
+type Camera struct {
+	Position pixel.Vec
+	Zoom     float64
+	Rotation float64
+
+	// Trauma goes up with big hits and wears off over time, the shake is trauma squared
+	// so small knocks barely register and big ones really throw the camera about
+	trauma    float64
+	zoomPulse float64
+	time      float64
+
+	shakeOffset pixel.Vec
+	shakeAngle  float64
+}
+
+// Accessibility setting, shaking the camera can be a lot for some people
+var screenShakeOn = true
+
+// How fast trauma wears off per second, and how far the camera moves at full trauma
+const cameraTraumaDecay = 1.2
+const cameraMaxShakeOffset = 24.0
+const cameraMaxShakeAngle = 0.04
+
+// The furthest out framing will zoom to fit everything in
+const cameraMinZoom = 0.6
+
+// How much room to leave around everything being framed
+const cameraFramingMargin = 200.0
+
+func NewCamera() Camera {
+	return Camera{Zoom: 1}
+}
+
+// Shake adds trauma, from 0 for nothing to 1 for as bad as it gets
+func (c *Camera) Shake(trauma float64) {
+	c.trauma = math.Min(1, c.trauma+trauma)
+}
+
+// PulseZoom punches in by amount (0.1 is 10%), then eases back out
+func (c *Camera) PulseZoom(amount float64) {
+	c.zoomPulse += amount
+}
+
+// Update wears off the shake and zoom pulses
+func (c *Camera) Update(dt float64) {
+	c.time += dt
+	c.trauma = math.Max(0, c.trauma-cameraTraumaDecay*dt)
+	c.zoomPulse *= math.Pow(1.0/64, dt)
+
+	shake := c.trauma * c.trauma
+	if !screenShakeOn {
+		shake = 0
+	}
+	// a few sines at odd frequencies wander about smoothly, which looks less jittery than random offsets
+	t := c.time * 30
+	c.shakeOffset = pixel.V(
+		math.Sin(t*1.13)+math.Sin(t*2.71)*0.5,
+		math.Sin(t*1.37+1)+math.Sin(t*3.07+2)*0.5,
+	).Scaled(shake * cameraMaxShakeOffset / 1.5)
+	c.shakeAngle = (math.Sin(t*0.97+3) + math.Sin(t*2.33)*0.5) * shake * cameraMaxShakeAngle / 1.5
+}
+
+// Follow eases the camera towards a point
+func (c *Camera) Follow(target pixel.Vec, dt float64) {
+	c.Position = pixel.Lerp(c.Position, target, 1-math.Pow(1.0/128, dt))
+}
+
+// Frame eases the camera towards the middle of the targets, zooming out if they won't fit in a view the size of bounds
+func (c *Camera) Frame(bounds pixel.Rect, dt float64, targets ...pixel.Vec) {
+	if len(targets) == 0 {
+		return
+	}
+	area := pixel.R(targets[0].X, targets[0].Y, targets[0].X, targets[0].Y)
+	for _, t := range targets[1:] {
+		area = area.Union(pixel.R(t.X, t.Y, t.X, t.Y))
+	}
+	c.Follow(area.Center(), dt)
+
+	zoom := 1.0
+	if area.W() > 0 || area.H() > 0 {
+		zoom = math.Min(
+			bounds.W()/(area.W()+cameraFramingMargin*2),
+			bounds.H()/(area.H()+cameraFramingMargin*2),
+		)
+	}
+	zoom = math.Max(cameraMinZoom, math.Min(1, zoom))
+	c.Zoom += (zoom - c.Zoom) * (1 - math.Pow(1.0/16, dt))
+}
+
+// View takes world space to screen space
+func (c *Camera) View() pixel.Matrix {
+	return pixel.IM.
+		Moved(c.Position.Add(c.shakeOffset).Scaled(-1)).
+		Rotated(pixel.ZV, c.Rotation+c.shakeAngle).
+		Scaled(pixel.ZV, c.Zoom*(1+c.zoomPulse))
+}
+
+func (c *Camera) WorldToScreen(v pixel.Vec) pixel.Vec {
+	return c.View().Project(v)
+}
+
+func (c *Camera) ScreenToWorld(v pixel.Vec) pixel.Vec {
+	return c.View().Unproject(v)
+}
+
+// WindowToWorld is where a point in the window (like the mouse) is in the world, when a screen
+// the size of screen is stretched over it
+func (c *Camera) WindowToWorld(v pixel.Vec, window pixel.Rect, screen pixel.Rect) pixel.Vec {
+	return c.ScreenToWorld(pixel.V(
+		(v.X-window.Center().X)*(screen.W()/window.W()),
+		(v.Y-window.Center().Y)*(screen.H()/window.H()),
+	))
+}
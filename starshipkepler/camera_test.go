@@ -0,0 +1,104 @@
+package starshipkepler
+
+import (
+	"math"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestCameraRoundTrip(t *testing.T) {
+	cases := []struct {
+		name  string
+		setup func(c *Camera)
+	}{
+		{"still", func(c *Camera) {}},
+		{"moved", func(c *Camera) { c.Position = pixel.V(300, -120) }},
+		{"rotated", func(c *Camera) { c.Position = pixel.V(-50, 80); c.Rotation = 0.7 }},
+		{"zoomed out", func(c *Camera) { c.Position = pixel.V(10, 10); c.Zoom = cameraMinZoom }},
+		{"pulsing and shaking", func(c *Camera) {
+			c.Rotation = -0.3
+			c.Zoom = 0.8
+			c.PulseZoom(0.1)
+			c.Shake(1)
+			c.Update(0.05)
+		}},
+	}
+	points := []pixel.Vec{pixel.ZV, pixel.V(400, 300), pixel.V(-720, 55), pixel.V(1, -999)}
+	for _, c := range cases {
+		cam := NewCamera()
+		c.setup(&cam)
+		for _, p := range points {
+			if back := cam.ScreenToWorld(cam.WorldToScreen(p)); back.To(p).Len() > 1e-6 {
+				t.Errorf("%s: %v came back as %v", c.name, p, back)
+			}
+		}
+	}
+}
+
+// At a zoom of 1 the mouse should land where it always did, before there was a camera
+func TestCameraWindowToWorld(t *testing.T) {
+	cam := NewCamera()
+	cam.Position = pixel.V(250, -140)
+	window, screen := pixel.R(0, 0, 1280, 720), pixel.R(0, 0, 1920, 1080)
+
+	for _, mouse := range []pixel.Vec{pixel.V(640, 360), pixel.V(0, 0), pixel.V(1280, 720), pixel.V(100, 600)} {
+		scaledX := (mouse.X - (window.W() / 2)) * (screen.W() / window.W())
+		scaledY := (mouse.Y - (window.H() / 2)) * (screen.H() / window.H())
+		want := pixel.V(scaledX, scaledY).Add(cam.Position)
+		if got := cam.WindowToWorld(mouse, window, screen); got.To(want).Len() > 1e-9 {
+			t.Errorf("mouse at %v: expected %v, got %v", mouse, want, got)
+		}
+	}
+}
+
+func TestCameraFrame(t *testing.T) {
+	bounds := pixel.R(0, 0, 1920, 1080)
+
+	// one target is just following it
+	cam := NewCamera()
+	cam.Zoom = 0.7
+	for i := 0; i < 600; i++ {
+		cam.Frame(bounds, 1.0/60, pixel.V(500, 200))
+	}
+	if math.Abs(cam.Zoom-1) > 1e-6 {
+		t.Errorf("expected a zoom of 1 for one target, got %v", cam.Zoom)
+	}
+	if cam.Position.To(pixel.V(500, 200)).Len() > 1e-3 {
+		t.Errorf("expected to be on the target, at %v", cam.Position)
+	}
+
+	// targets too far apart to fit stop at the minimum zoom, in the middle of them
+	cam = NewCamera()
+	for i := 0; i < 600; i++ {
+		cam.Frame(bounds, 1.0/60, pixel.V(-3000, 0), pixel.V(3000, 400))
+	}
+	if math.Abs(cam.Zoom-cameraMinZoom) > 1e-6 {
+		t.Errorf("expected the zoom to stop at %v, got %v", cameraMinZoom, cam.Zoom)
+	}
+	if cam.Position.To(pixel.V(0, 200)).Len() > 1e-3 {
+		t.Errorf("expected to be between the targets, at %v", cam.Position)
+	}
+}
+
+func TestCameraShakeOff(t *testing.T) {
+	defer func(on bool) { screenShakeOn = on }(screenShakeOn)
+
+	screenShakeOn = false
+	cam := NewCamera()
+	cam.Shake(1)
+	for i := 0; i < 10; i++ {
+		cam.Update(1.0 / 60)
+		if cam.shakeOffset != pixel.ZV || cam.shakeAngle != 0 {
+			t.Fatalf("expected no shake with it turned off, got %v and %v", cam.shakeOffset, cam.shakeAngle)
+		}
+	}
+
+	// and it does shake with it on
+	screenShakeOn = true
+	cam.Shake(1)
+	cam.Update(1.0 / 60)
+	if cam.shakeOffset == pixel.ZV {
+		t.Error("expected a shake at full trauma")
+	}
+}
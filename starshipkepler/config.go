@@ -6,6 +6,7 @@ import (
 	"golang.org/x/image/colornames"
 )
 
+// The size of the default arena, and of the view the camera is set up for
 const worldWidth = 1700.0
 const worldHeight = 1080.0
 
@@ -13,8 +14,14 @@ var g_debug = false
 
 const particlesOn = true
 
+// Particle and grid physics are tuned in steps of a 60th of a second, and scaled by the frame time to match
+const simRate = 60.0
+
 const gameTitle = "Starship Kepler"
 
+// Seconds between bombs
+const bombCooldown = 2.0
+
 var elementWaterColor = color.RGBA{0x48, 0x64, 0xed, 0xff}
 var elementLifeColor = colornames.Green
 var elementSpiritColor = colornames.Snow
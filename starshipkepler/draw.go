@@ -3,8 +3,6 @@ package starshipkepler
 import (
 	"fmt"
 	"image/color"
-	"io/ioutil"
-	"log"
 	"math"
 	"time"
 
@@ -21,39 +19,30 @@ import (
 
 type DrawContext struct {
 	// Draw targets
-	mapRect      *imdraw.IMDraw
-	imd          *imdraw.IMDraw
-	uiDraw       *imdraw.IMDraw
-	bulletDraw   *imdraw.IMDraw
-	particleDraw *imdraw.IMDraw
-	tmpTarget    *imdraw.IMDraw
-
-	// Sprites
-	wardInner      *pixel.Sprite
-	wardOuter      *pixel.Sprite
-	innerWardBatch *imdraw.IMDraw
-	outerWardBatch *imdraw.IMDraw
+	imd    *imdraw.IMDraw
+	uiDraw *imdraw.IMDraw
+
+	// The world goes through this onto the primary canvas
+	world *canvasRenderer
+	art   worldArt
 
 	// Canvases
 	PrimaryCanvas *pixelgl.Canvas
 	uiCanvas      *pixelgl.Canvas
 
-	// Post processing canvases
-	bloom1 *pixelgl.Canvas
-	bloom2 *pixelgl.Canvas
-	bloom3 *pixelgl.Canvas
+	// Bloom and friends, see shaders/postprocessing.yml
+	postFX *postProcessor
 
 	// Fonts
 	titleFont *text.Atlas
 
 	// Text objects
-	titleTxt     *text.Text
-	gameOverTxt  *text.Text
-	centeredTxt  *text.Text
-	highscoreTxt *text.Text
-	scoreTxt     *text.Text
-	consoleTxt   *text.Text
-	livesTxt     *text.Text
+	titleTxt    *text.Text
+	gameOverTxt *text.Text
+	centeredTxt *text.Text
+	consoleTxt  *text.Text
+
+	hud *hud
 }
 
 var basicFont *text.Atlas
@@ -62,71 +51,14 @@ var smallFont *text.Atlas
 func NewDrawContext(cfg pixelgl.WindowConfig) *DrawContext {
 	drawContext := new(DrawContext)
 
-	mapRect := imdraw.New(nil)
-	mapRect.Color = color.RGBA{0x64, 0x64, 0xff, 0xbb}
-	mapRect.Push(
-		pixel.V(-(worldWidth/2), (worldHeight/2)), // Make a home for these globals
-		pixel.V((worldWidth/2), (worldHeight/2)),
-	)
-	mapRect.Push(
-		pixel.V(-(worldWidth/2), -(worldHeight/2)),
-		pixel.V((worldWidth/2), -(worldHeight/2)),
-	)
-	mapRect.Rectangle(4)
-	drawContext.mapRect = mapRect
-
 	drawContext.imd = imdraw.New(nil)
 	drawContext.uiDraw = imdraw.New(nil)
-	drawContext.bulletDraw = imdraw.New(nil)
-	drawContext.particleDraw = imdraw.New(nil)
-	drawContext.tmpTarget = imdraw.New(nil)
-
-	wardInnerPic, _ := loadPicture("./images/wards/ward_alpha.png")
-	wardOuterPic, _ := loadPicture("./images/wards/ward2_alpha.png")
+	drawContext.art = loadWorldArt()
 
-	drawContext.wardInner = pixel.NewSprite(wardInnerPic, wardInnerPic.Bounds())
-	drawContext.wardOuter = pixel.NewSprite(wardOuterPic, wardOuterPic.Bounds())
-
-	drawContext.innerWardBatch = imdraw.New(wardInnerPic)
-	drawContext.outerWardBatch = imdraw.New(wardOuterPic)
-
-	// Fonts and text
-	ttfData, err := ioutil.ReadFile("./font/gabriel_serif/Gabriel Serif.ttf")
-	if err != nil {
-		log.Fatal(err)
-	}
-	var titleFace font.Face = basicfont.Face7x13
-	tFont, err := truetype.Parse(ttfData)
-	if err != nil {
-		log.Fatal(err)
-	} else {
-		titleFace = truetype.NewFace(tFont, &truetype.Options{
-			Size: 24.0,
-			DPI:  96,
-		})
-	}
 	// Fonts and text
-	ttfData, err = ioutil.ReadFile("./font/comfortaa/Comfortaa-Regular.ttf")
-	if err != nil {
-		log.Fatal(err)
-	}
-	var normalFace font.Face = basicfont.Face7x13
-	var smallFace font.Face = basicfont.Face7x13
-
-	nFont, err := truetype.Parse(ttfData)
-	if err != nil {
-		log.Fatal(err)
-	} else {
-		normalFace = truetype.NewFace(nFont, &truetype.Options{
-			Size: 18.0,
-			DPI:  96,
-		})
-
-		smallFace = truetype.NewFace(nFont, &truetype.Options{
-			Size: 14.0,
-			DPI:  96,
-		})
-	}
+	titleFace := loadFontFace("font/gabriel_serif/Gabriel Serif.ttf", 24.0)
+	normalFace := loadFontFace("font/comfortaa/Comfortaa-Regular.ttf", 18.0)
+	smallFace := loadFontFace("font/comfortaa/Comfortaa-Regular.ttf", 14.0)
 
 	drawContext.titleFont = text.NewAtlas(titleFace, text.ASCII)
 
@@ -138,6 +70,7 @@ func NewDrawContext(cfg pixelgl.WindowConfig) *DrawContext {
 	drawContext.gameOverTxt = text.New(pixel.V(0, 64), basicFont)
 	drawContext.centeredTxt = text.New(pixel.V(0, 0), basicFont)
 	drawContext.centeredTxt.LineHeight = basicFont.LineHeight() * 1.5
+	drawContext.hud = NewHUD(basicFont, smallFont)
 
 	drawContext.SetBounds(cfg.Bounds)
 	return drawContext
@@ -146,32 +79,36 @@ func NewDrawContext(cfg pixelgl.WindowConfig) *DrawContext {
 func (d *DrawContext) SetBounds(bounds pixel.Rect) {
 	d.PrimaryCanvas = pixelgl.NewCanvas(pixel.R(-bounds.W()/2, -bounds.H()/2, bounds.W()/2, bounds.H()/2))
 	d.uiCanvas = pixelgl.NewCanvas(pixel.R(-bounds.W()/2, -bounds.H()/2, bounds.W()/2, bounds.H()/2))
+	d.world = NewCanvasRenderer(d.PrimaryCanvas, basicFont)
 
-	d.bloom1 = pixelgl.NewCanvas(pixel.R(-bounds.W()/2, -bounds.H()/2, bounds.W()/2, bounds.H()/2))
-	extractBrightness, err := loadFileToString("./shaders/extract_bright_areas.glsl")
-	if err != nil {
-		panic(err)
+	// The passes only need resizing, recompiling their shaders on every resize is slow
+	if d.postFX == nil {
+		d.postFX = NewPostProcessor(d.PrimaryCanvas.Bounds())
+	} else {
+		d.postFX.Resize(d.PrimaryCanvas.Bounds())
 	}
-	d.bloom1.SetFragmentShader(extractBrightness)
 
-	d.bloom2 = pixelgl.NewCanvas(pixel.R(-bounds.W()/2, -bounds.H()/2, bounds.W()/2, bounds.H()/2))
-	blur, err := loadFileToString("./shaders/blur.glsl")
+	d.consoleTxt = text.New(pixel.V(-(bounds.W()/2)+50, (bounds.H()/2)-170), smallFont)
+}
+
+// Falls back to the built in bitmap font if the font file is missing or broken
+func loadFontFace(path string, size float64) font.Face {
+	ttfData, err := assets.ReadFile(path)
 	if err != nil {
-		panic(err)
+		assets.Placeholder(path, err)
+		return basicfont.Face7x13
 	}
-	d.bloom2.SetFragmentShader(blur)
 
-	d.bloom3 = pixelgl.NewCanvas(pixel.R(-bounds.W()/2, -bounds.H()/2, bounds.W()/2, bounds.H()/2))
-	// blur, err = loadFileToString("./shaders/blur.glsl")
-	// if err != nil {
-	// 	panic(err)
-	// }
-	d.bloom3.SetFragmentShader(blur)
+	ttf, err := truetype.Parse(ttfData)
+	if err != nil {
+		assets.Placeholder(path, err)
+		return basicfont.Face7x13
+	}
 
-	d.scoreTxt = text.New(pixel.V(-(bounds.W()/2)+120, (bounds.H()/2)-50), basicFont)
-	d.highscoreTxt = text.New(pixel.V((bounds.W()/2)-180, (bounds.H()/2)-50), basicFont)
-	d.livesTxt = text.New(pixel.V(0.0, (bounds.H()/2)-50), basicFont)
-	d.consoleTxt = text.New(pixel.V(-(bounds.W()/2)+50, (bounds.H()/2)-170), smallFont)
+	return truetype.NewFace(ttf, &truetype.Options{
+		Size: size,
+		DPI:  96,
+	})
 }
 
 func drawShip(d *imdraw.IMDraw) {
@@ -217,28 +154,13 @@ func drawShip(d *imdraw.IMDraw) {
 	// d.Line(weight)
 }
 
-func drawBullet(bullet *bullet, d *imdraw.IMDraw) {
-	d.Color = pixel.ToRGBA(color.RGBA{255, 192, 128, 255})
-
+func drawBullet(bullet *bullet, r Renderer) {
 	hw := bullet.width / 2
 	hl := bullet.length / 2
-	d.Push(
-		pixel.V(hw, hl),
-		pixel.V(hw, -hl),
-		pixel.V(-hw, hl),
-		pixel.V(-hw, -hl),
-	)
-	d.Rectangle(0)
+	r.Rectangle(color.RGBA{255, 192, 128, 255}, 0, pixel.V(-hw, -hl), pixel.V(hw, hl))
 
 	for i, el := range bullet.data.elements {
-		d.Color = elements[el]
-		d.Push(
-			pixel.V(hw, hl),
-			pixel.V(hw, hl/4.0*float64(i)),
-			pixel.V(-hw, hl),
-			pixel.V(-hw, hl/4.0*float64(i)),
-		)
-		d.Rectangle(hw)
+		r.Rectangle(elementColour(el), hw, pixel.V(-hw, hl/4.0*float64(i)), pixel.V(hw, hl))
 	}
 }
 
@@ -261,10 +183,41 @@ func drawMenu(d *DrawContext, menu *menu) {
 			)
 			d.imd.Circle(2.0, 4.0)
 		}
-		fmt.Fprintln(d.centeredTxt, item)
+		fmt.Fprintln(d.centeredTxt, menuLabel(item))
 	}
 }
 
+// drawStoryPage puts the lines of the story page that's up in the middle of the screen
+func drawStoryPage(d *DrawContext, t pixel.Target, game *game) {
+	lines := game.storyPageLines(&chapter1)
+	if lines == nil {
+		return
+	}
+	d.centeredTxt.Clear()
+	d.centeredTxt.Orig = pixel.V(0, 160)
+	d.centeredTxt.Dot = d.centeredTxt.Orig
+	d.centeredTxt.Color = colornames.White
+	for _, line := range lines {
+		d.centeredTxt.Dot.X -= d.centeredTxt.BoundsOf(line).W() / 2
+		fmt.Fprintln(d.centeredTxt, line)
+	}
+	d.centeredTxt.Draw(t, pixel.IM)
+}
+
+func menuLabel(item string) string {
+	if item == "Colour Palette" {
+		return fmt.Sprintf("%s: < %s >", item, elementPalette)
+	}
+	bus, ok := volumeMenuItems[item]
+	if !ok {
+		return item
+	}
+	if audio.Muted(bus) {
+		return fmt.Sprintf("%s: Muted", item)
+	}
+	return fmt.Sprintf("%s: < %d%% >", item, int(math.Round(audio.Level(bus)*100)))
+}
+
 func drawDebug(d *DrawContext, game *game) {
 	txt := "Debugging: On"
 	fmt.Fprintln(d.consoleTxt, txt)
@@ -291,33 +244,19 @@ func drawDebug(d *DrawContext, game *game) {
 	// txt = "Buffered Entities Cap: %d\n"
 	// fmt.Fprintf(d.consoleTxt, txt, cap(game.data.newEntities))
 
-	activeParticles := 0
-	for _, p := range game.data.particles {
-		if p != (particle{}) {
-			activeParticles++
-		}
-	}
-
 	txt = "Particles: %d\n"
-	fmt.Fprintf(d.consoleTxt, txt, activeParticles)
+	fmt.Fprintf(d.consoleTxt, txt, game.data.particles.count())
 	txt = "Particles Cap: %d\n"
-	fmt.Fprintf(d.consoleTxt, txt, cap(game.data.particles))
-
-	bufferedParticles := 0
-	for _, particle := range game.data.newParticles {
-		if (particle.origin != pixel.Vec{}) {
-			bufferedParticles++
-		}
-	}
-
-	txt = "Buffered Particles: %d\n"
-	fmt.Fprintf(d.consoleTxt, txt, bufferedParticles)
+	fmt.Fprintf(d.consoleTxt, txt, len(game.data.particles.particles))
 
 	txt = "Bullets: %d\n"
 	fmt.Fprintf(d.consoleTxt, txt, len(game.data.bullets))
 	txt = "Bullets Cap: %d\n"
 	fmt.Fprintf(d.consoleTxt, txt, cap(game.data.bullets))
 
+	txt = "Projectiles: %d\n"
+	fmt.Fprintf(d.consoleTxt, txt, game.data.projectiles.count())
+
 	txt = "Kills: %d\n"
 	fmt.Fprintf(d.consoleTxt, txt, game.data.kills)
 
@@ -340,15 +279,481 @@ func drawDebug(d *DrawContext, game *game) {
 	fmt.Fprintf(d.consoleTxt, txt, game.data.landingPartyR)
 }
 
+// drawGrid draws the grid in its theme's style: lines, a dot on each point, or filled cells
+func drawGrid(r Renderer, g *grid, colour pixel.RGBA, view projection) {
+	arena := g.arena
+	switch g.theme.style {
+	case "dots":
+		for _, point := range g.masses {
+			p := view.Project(point.origin)
+			if arena.Contains(p) {
+				r.Circle(colour, 0, p, math.Max(1.0, 2.0+point.origin.Z*0.01))
+			}
+		}
+	case "cells":
+		shade := colour.Scaled(0.6)
+		shade.A = 1.0
+		corners := []pixel.Vec{}
+		for i, cell := range g.cells {
+			inside := false
+			corners = corners[:0]
+			for _, point := range cell {
+				p := view.Project(point.origin)
+				inside = inside || arena.Contains(p)
+				// It's possible that some but not all points are brought in from out of the world boundary
+				// If being brought in from out of the world, render right on the border
+				p = arena.Clamp(p, 0)
+				corners = append(corners, p)
+			}
+			if !inside {
+				continue
+			}
+			if i%2 == 0 {
+				r.Polygon(shade, 0, corners...)
+			} else {
+				r.Polygon(colour, 0, corners...)
+			}
+		}
+	default:
+		for _, line := range g.lines {
+			from, to := line.ends(view)
+			if arena.Contains(from) || arena.Contains(to) {
+				// It's possible that one but not the other point is brought in from out of the world boundary
+				// If being brought in from out of the world, render right on the border
+				from = arena.Clamp(from, 0)
+				to = arena.Clamp(to, 0)
+				r.Line(colour, line.thickness, from, to)
+			}
+		}
+	}
+}
+
+// worldArt is the pictures drawWorld needs, loaded once by whoever owns the renderer
+type worldArt struct {
+	wardInner pixel.Picture
+	wardOuter pixel.Picture
+	glyphs    map[string]pixel.Picture
+}
+
+func loadWorldArt() worldArt {
+	wardInner, _ := loadPicture("images/wards/ward_alpha.png")
+	wardOuter, _ := loadPicture("images/wards/ward2_alpha.png")
+	return worldArt{wardInner: wardInner, wardOuter: wardOuter, glyphs: loadElementGlyphs()}
+}
+
+// The border around the arena
+var mapRectColour = color.RGBA{0x64, 0x64, 0xff, 0xbb}
+
+// drawWorld draws the arena and everything in it, as seen from the camera
+func drawWorld(r Renderer, game *game, art worldArt) {
+	r.Clear(colornames.Black)
+	r.SetCamera(game.Camera.View())
+	r.SetMatrix(pixel.IM)
+
+	if game.data.mode != "story" {
+		// Draw: grid effect
+		r.SetColorMask(pixel.Alpha(game.grid.theme.alpha * (1.0 + game.beat.energy)))
+		hue := math.Mod((game.grid.theme.hue + game.musicHue + ((math.Mod(game.totalTime, 300.0) / 300.0) * 6.0)), 6.0)
+		drawGrid(r, &game.grid, HSVToColor(hue, game.grid.theme.saturation, 1.0), game.projection)
+
+		// draw: obstacles, over the grid that's pinned under them
+		r.SetColorMask(pixel.Alpha(1))
+		r.SetMatrix(pixel.IM)
+		for _, o := range game.data.arena.obstacles {
+			outline := o.Outline()
+			r.Polygon(colornames.Black, 0, outline...)
+			r.Polygon(mapRectColour, 3, outline...)
+		}
+
+		// draw: particles
+		for _, p := range game.data.particles.particles {
+			if p.alive {
+				defaultSize := pixel.V(8, 2)
+				pModel := defaultSize.ScaledXY(p.scale)
+				r.SetColorMask(pixel.Alpha(0.4 * p.colour.A))
+				r.SetMatrix(pixel.IM.Rotated(pixel.ZV, p.orientation).Moved(p.origin))
+				r.Line(p.colour, pModel.Y, pixel.V(-pModel.X/2, 0.0), pixel.V(pModel.X/2, 0.0))
+			}
+		}
+	}
+
+	// story mode is just the player in the void, until the chapter's boss turns up
+	r.SetColorMask(pixel.Alpha(1))
+	drawPlayer(r, game)
+	drawEnemies(r, game, art)
+	drawBoss(r, game, art)
+
+	for _, b := range game.data.bullets {
+		if b.data.alive {
+			r.SetMatrix(pixel.IM.Rotated(pixel.ZV, b.data.orientation.Angle()-math.Pi/2).Moved(b.data.origin))
+			r.SetColorMask(pixel.Alpha(0.9 - (game.lastFrame.Sub(b.data.born).Seconds() / b.duration)))
+			drawBullet(&b, r)
+			if len(b.data.elements) > 0 {
+				drawElementGlyph(r, art, b.data.elements[0], b.data.origin, 16)
+			}
+		}
+	}
+	drawProjectiles(r, game, art)
+	r.Flush()
+
+	// draw: wards
+	if game.data.player.alive {
+		rotInterp := 2 * math.Pi * math.Mod(game.totalTime, 8.0) / 8
+		currentT := math.Sin(rotInterp)
+		ang := (currentT * 2 * math.Pi) - math.Pi
+
+		r.SetComposeMethod(pixel.ComposePlus)
+		r.SetColorMask(pixel.Alpha(1))
+		r.SetMatrix(pixel.IM.Scaled(pixel.ZV, 0.6).Rotated(pixel.ZV, ang).Moved(game.data.player.origin))
+		for i, pic := range []pixel.Picture{art.wardInner, art.wardOuter} {
+			if len(game.data.player.elements) > i {
+				r.Sprite(pic, elementColour(game.data.player.elements[i]))
+			}
+		}
+		r.SetComposeMethod(pixel.ComposeOver)
+
+		// the ward glyphs orbit the ship on opposite sides
+		for i, element := range game.data.player.elements {
+			pos := pixel.V(0, 64).Rotated(ang + float64(i)*math.Pi).Add(game.data.player.origin)
+			drawElementGlyph(r, art, element, pos, 24)
+		}
+	}
+
+	r.SetMatrix(pixel.IM)
+	r.SetColorMask(pixel.Alpha(1))
+	if game.data.mode != "story" {
+		r.Polygon(mapRectColour, 4, game.data.arena.Outline()...)
+	}
+	r.Flush()
+}
+
+func drawPlayer(r Renderer, game *game) {
+	player := &game.data.player
+	if !player.alive {
+		return
+	}
+
+	r.SetMatrix(pixel.IM.Rotated(pixel.ZV, player.orientation.Angle()).Moved(player.origin))
+	r.Circle(colornames.White, 4.0, pixel.ZV, 20.0)
+	r.CircleArc(colornames.White, 2.0, pixel.ZV, 28.0, 0.3, -0.3)
+
+	if (game.data.weapon != weapondata{}) {
+		r.SetMatrix(pixel.IM.Moved(player.origin))
+		r.Circle(colornames.Lightsteelblue, 2.0, pixel.V(12.0, 0.0).Rotated(player.relativeTarget.Angle()), 4.0)
+	}
+}
+
+// wandererShape is the pinwheel wanderers and essences are drawn with
+func wandererShape(size float64, angle float64) []pixel.Vec {
+	points := []pixel.Vec{
+		pixel.V(0, size),
+		pixel.V(2, 1).Scaled(size / 8),
+		pixel.V(0, size).Rotated(-120.0 * math.Pi / 180),
+		pixel.V(0, -2.236).Scaled(size / 8),
+		pixel.V(0, size).Rotated(120.0 * math.Pi / 180),
+		pixel.V(-2, 1).Scaled(size / 8),
+	}
+	for i := range points {
+		points[i] = points[i].Rotated(angle)
+	}
+	return points
+}
+
+func drawEnemies(r Renderer, game *game, art worldArt) {
+	for _, e := range game.data.entities {
+		if !e.alive {
+			continue
+		}
+
+		r.SetColorMask(pixel.Alpha(1))
+		size := e.radius
+		if e.spawning {
+			r.SetColorMask(pixel.Alpha(0.7))
+			timeSinceBorn := game.lastFrame.Sub(e.born).Seconds()
+			spawnIndicatorT := e.spawnTime / 2.0
+
+			size = e.radius * (math.Mod(timeSinceBorn, spawnIndicatorT) / spawnIndicatorT)
+			if e.entityType == "blackhole" {
+				size = e.radius * ((timeSinceBorn) / e.spawnTime) // grow from small to actual size
+			}
+		}
+
+		r.SetMatrix(pixel.IM.Rotated(e.origin, e.orientation.Angle()))
+		weight := 3.0
+		switch e.entityType {
+		case "wanderer":
+			r.SetMatrix(pixel.IM.Rotated(pixel.ZV, e.orientation.Angle()).Moved(e.origin))
+			r.Polygon(e.color, 3, wandererShape(size, 0)...)
+		case "blackhole":
+			r.SetMatrix(pixel.IM)
+			if e.active {
+				heartRate := 0.5 - ((float64(e.hp) / 15.0) * 0.35)
+				volatility := (math.Mod(game.totalTime, heartRate) / heartRate)
+				size += (5 * volatility)
+
+				ringWeight := 2.0
+				if volatility > 0 {
+					ringWeight += (3 * volatility)
+				}
+
+				hue := (math.Mod(game.lastFrame.Sub(e.born).Seconds(), 6.0))
+				baseColor := HSVToColor(hue, 0.5+(volatility/2), 1.0)
+				baseColor = baseColor.Add(pixel.Alpha(volatility / 2))
+				r.Circle(baseColor, ringWeight, e.origin, size)
+
+				v2 := math.Mod(volatility+0.5, 1.0)
+				hue2 := (math.Mod(game.lastFrame.Sub(e.born).Seconds()+1.0, 6.0))
+				baseColor2 := HSVToColor(hue2, 0.5+(v2/2), 1.0)
+				baseColor2 = baseColor2.Add(pixel.Alpha(v2 / 2))
+				r.Circle(baseColor2, ringWeight, e.origin, size-ringWeight)
+			} else {
+				r.Circle(e.Colour(), 4, e.origin, size)
+			}
+		case "essence":
+			rotInterp := 2 * math.Pi * math.Mod(game.totalTime, 8.0) / 8
+			currentT := math.Sin(rotInterp)
+			ang := (currentT * 2 * math.Pi) - math.Pi
+
+			colour := e.Colour()
+			r.SetMatrix(pixel.IM.Rotated(pixel.ZV, ang).Moved(e.origin))
+			r.Polygon(colour, 3, wandererShape(size/2, 0)...)
+			r.Polygon(colour, 2, wandererShape(size/2, 60.0*math.Pi/180)...)
+			drawElementGlyph(r, art, e.elements[0], e.origin, size*0.6)
+		case "follower":
+			growth := size / 10.0
+			timeSinceBorn := game.lastFrame.Sub(e.born).Seconds()
+
+			xRad := (size * 1.2) + (growth * math.Sin(2*math.Pi*(math.Mod(timeSinceBorn, 2.0)/2.0)))
+			yRad := (size * 1.2) + (growth * -math.Cos(2*math.Pi*(math.Mod(timeSinceBorn, 2.0)/2.0)))
+			r.Polygon(e.color, weight,
+				pixel.V(e.origin.X-xRad, e.origin.Y),
+				pixel.V(e.origin.X, e.origin.Y+yRad),
+				pixel.V(e.origin.X+xRad, e.origin.Y),
+				pixel.V(e.origin.X, e.origin.Y-yRad),
+				pixel.V(e.origin.X-xRad, e.origin.Y),
+			)
+		case "pink", "pinkpleb":
+			if e.entityType == "pink" {
+				weight = 4.0
+			}
+			min, max := pixel.V(e.origin.X-size, e.origin.Y-size), pixel.V(e.origin.X+size, e.origin.Y+size)
+			r.Rectangle(e.color, weight, min, max)
+			r.Line(e.color, weight, min, max)
+			r.Line(e.color, weight, pixel.V(min.X, max.Y), pixel.V(max.X, min.Y))
+		case "bubble":
+			r.Circle(e.Colour(), 2.0, e.origin, e.radius)
+		case "dodger":
+			r.SetColorMask(pixel.Alpha(0.8))
+			if e.spawning {
+				r.SetColorMask(pixel.Alpha(0.8 * 0.7))
+			}
+			r.Rectangle(e.color, weight, pixel.V(e.origin.X-size, e.origin.Y-size), pixel.V(e.origin.X+size, e.origin.Y+size))
+			r.Polygon(e.color, weight,
+				pixel.V(e.origin.X-size, e.origin.Y),
+				pixel.V(e.origin.X, e.origin.Y+size),
+				pixel.V(e.origin.X+size, e.origin.Y),
+				pixel.V(e.origin.X, e.origin.Y-size),
+			)
+		case "snek":
+			r.SetMatrix(pixel.IM.Rotated(pixel.ZV, e.orientation.Angle()-math.Pi/2).Moved(e.origin))
+			r.Circle(e.color, weight, pixel.ZV, e.radius)
+
+			r.SetMatrix(pixel.IM)
+			for _, snekT := range e.tail {
+				if snekT.entityType != "snektail" {
+					continue
+				}
+				r.Circle(colornames.Blueviolet, 3.0, snekT.origin, snekT.radius)
+			}
+		case "replicator":
+			r.Circle(colornames.Orangered, 4.0, e.origin, e.radius)
+		case "gate":
+			r.Line(colornames.Lightyellow, 4.0, e.origin.Add(pixel.V(-e.radius, 0.0)), e.origin.Add(pixel.V(e.radius, 0.0)))
+		case "starling":
+			r.SetMatrix(pixel.IM.Rotated(pixel.ZV, e.orientation.Angle()).Moved(e.origin))
+			r.Polygon(e.color, 2,
+				pixel.V(size, 0),
+				pixel.V(-size, size*0.8),
+				pixel.V(-size*0.4, 0),
+				pixel.V(-size, -size*0.8),
+			)
+		case "turret":
+			colour := e.Colour()
+			r.SetMatrix(pixel.IM.Rotated(pixel.ZV, e.orientation.Angle()).Moved(e.origin))
+			r.Polygon(colornames.Black, 0, polygonShape(8, size, math.Pi/8)...)
+			r.Polygon(colour, weight, polygonShape(8, size, math.Pi/8)...)
+			r.Circle(colour, 2, pixel.ZV, size*0.4)
+			r.Line(colour, 6, pixel.V(size*0.4, 0), pixel.V(size*1.3, 0))
+		case "sniper":
+			colour := e.Colour()
+			// the aim line firms up as the shot gets close
+			if !e.spawning && game.data.player.alive {
+				untilShot := sniperFireRate - game.lastFrame.Sub(e.lastShot).Seconds()
+				if untilShot < sniperAimTime {
+					r.SetMatrix(pixel.IM)
+					r.SetColorMask(pixel.Alpha(0.6 * (1 - untilShot/sniperAimTime)))
+					r.Line(colour, 1.5, e.origin, game.data.player.origin)
+					r.SetColorMask(pixel.Alpha(1))
+				}
+			}
+			r.SetMatrix(pixel.IM.Rotated(pixel.ZV, e.orientation.Angle()).Moved(e.origin))
+			r.Polygon(colour, weight,
+				pixel.V(size*1.4, 0),
+				pixel.V(0, size*0.5),
+				pixel.V(-size, 0),
+				pixel.V(0, -size*0.5),
+			)
+			r.Line(colour, 2, pixel.V(-size, 0), pixel.V(size*1.4, 0))
+		}
+	}
+}
+
+// drawProjectiles draws what the enemies have shot, in the colour of the element it carries
+func drawProjectiles(r Renderer, game *game, art worldArt) {
+	for _, p := range game.data.projectiles.projectiles {
+		if !p.alive {
+			continue
+		}
+		colour := projectileColour(&p)
+		// fade out over the last second
+		r.SetColorMask(pixel.Alpha(math.Min(1, p.lifetime-p.age)))
+		r.SetMatrix(pixel.IM.Rotated(pixel.ZV, p.angle).Moved(p.origin))
+		switch p.shape {
+		case "orb":
+			r.Circle(colour.Mul(pixel.Alpha(0.5)), 0, pixel.ZV, p.radius)
+			r.Circle(colour, 2, pixel.ZV, p.radius)
+		case "needle":
+			r.Polygon(colour, 0,
+				pixel.V(p.radius*3, 0),
+				pixel.V(0, p.radius*0.6),
+				pixel.V(-p.radius*3, 0),
+				pixel.V(0, -p.radius*0.6),
+			)
+		case "star":
+			points := make([]pixel.Vec, 8)
+			for i := range points {
+				reach := p.radius
+				if i%2 == 1 {
+					reach = p.radius * 0.4
+				}
+				points[i] = pixel.V(reach, 0).Rotated(float64(i) * math.Pi / 4)
+			}
+			r.Polygon(colour, 2, points...)
+		}
+		if p.element != "" && p.radius >= 10 {
+			r.SetMatrix(pixel.IM)
+			drawElementGlyph(r, art, p.element, p.origin, p.radius*1.2)
+		}
+	}
+	r.SetMatrix(pixel.IM)
+	r.SetColorMask(pixel.Alpha(1))
+}
+
+// polygonShape is a regular polygon with its corners size from the middle
+func polygonShape(sides int, size float64, angle float64) []pixel.Vec {
+	points := make([]pixel.Vec, sides)
+	for i := range points {
+		points[i] = pixel.V(0, size).Rotated(angle + 2*math.Pi*float64(i)/float64(sides))
+	}
+	return points
+}
+
+var bossTelegraphColour = colornames.Orangered
+
+// drawBoss draws what the boss is winding up to under it, then each of its segments
+func drawBoss(r Renderer, game *game, art worldArt) {
+	b := game.data.boss
+	if b == nil {
+		return
+	}
+	r.SetMatrix(pixel.IM)
+	alpha := 1.0
+	if b.spawning > 0 {
+		alpha = 1 - b.spawning/bossSpawnTime
+	}
+
+	// telegraphs fill in as the windup runs out
+	if attack, ok := bossAttacks[b.attack]; ok && !b.struck {
+		progress := math.Min(1, b.attackTime/attack.windup)
+		pulse := 0.5 + 0.5*math.Sin(b.attackTime*math.Pi*8)
+		r.SetColorMask(pixel.Alpha(0.4 + 0.4*progress*pulse))
+		switch b.attack {
+		case "charge":
+			dir := b.origin.To(b.attackTarget).Unit()
+			end := b.origin.Add(dir.Scaled(bossChargeSpeed * attack.duration))
+			r.Line(bossTelegraphColour, 2+6*progress, b.origin, end)
+		case "slam":
+			r.Circle(bossTelegraphColour, 3, b.origin, bossSlamRadius)
+			r.Circle(bossTelegraphColour, 2, b.origin, bossSlamRadius*progress)
+		case "summon":
+			for _, pos := range b.summonPoints {
+				r.Circle(bossTelegraphColour, 2, pos, 32*(1-progress)+8)
+			}
+		case "volley":
+			// spokes out along where the stars will go
+			spokes := projectilePresets["boss/volley"].count
+			for i := 0; i < spokes; i++ {
+				dir := pixel.V(1, 0).Rotated(b.angle + 2*math.Pi*float64(i)/float64(spokes))
+				r.Line(bossTelegraphColour, 2, b.origin.Add(dir.Scaled(b.radius)), b.origin.Add(dir.Scaled(b.radius+64*progress)))
+			}
+		}
+	}
+
+	r.SetColorMask(pixel.Alpha(alpha))
+	core := b.origin
+	for i, s := range b.segments {
+		if s.core && s.hp > 0 {
+			core = b.segmentPos(i)
+		}
+	}
+	for i, s := range b.segments {
+		if s.hp <= 0 {
+			continue
+		}
+		r.SetMatrix(pixel.IM)
+		pos := b.segmentPos(i)
+		colour := pixel.ToRGBA(elementColour(s.weakness))
+		if s.flash > 0 {
+			colour = pixel.ToRGBA(colornames.White)
+		}
+		sides := 6
+		if s.core {
+			sides = 8
+		} else {
+			r.Line(colour.Mul(pixel.Alpha(0.5)), 2, core, pos)
+		}
+		r.SetMatrix(pixel.IM.Moved(pos))
+		r.Polygon(colornames.Black, 0, polygonShape(sides, s.radius, b.angle)...)
+		r.Polygon(colour, 3, polygonShape(sides, s.radius, b.angle)...)
+		// how much hp the segment has left runs around the inside
+		health := float64(s.hp) / float64(s.maxHp)
+		r.CircleArc(colour, 2, pixel.ZV, s.radius*0.6, math.Pi/2, math.Pi/2+2*math.Pi*health)
+		if b.shielded(i) {
+			r.Circle(colornames.Lightblue, 2, pixel.ZV, s.radius+8)
+		}
+		r.SetMatrix(pixel.IM)
+		drawElementGlyph(r, art, s.weakness, pos, s.radius)
+	}
+	r.SetColorMask(pixel.Alpha(1))
+}
+
+// drawBounties pops up what each enemy that just died was worth
+func drawBounties(r Renderer, game *game) {
+	r.SetMatrix(pixel.IM)
+	r.SetColorMask(pixel.Alpha(1))
+	for _, e := range game.data.entities {
+		if (!e.alive && e.death != time.Time{} && e.entityType != "" && e.bounty > 0) {
+			text := fmt.Sprintf("%d", e.bounty*game.data.scoreMultiplier)
+			growth := (0.5 - (float64(e.expiry.Sub(game.lastFrame).Milliseconds()) / 300.0))
+			r.Text(colornames.Lightgoldenrodyellow, e.origin, 1.0-growth, text)
+		}
+	}
+	r.Flush()
+}
+
 func DrawGame(win *pixelgl.Window, game *game, d *DrawContext) {
 	d.imd.Reset()
 	d.uiDraw.Reset()
-	d.bulletDraw.Reset()
-	d.particleDraw.Reset()
-	d.tmpTarget.Reset()
-
-	cam := pixel.IM.Moved(game.CamPos.Scaled(-1))
-	d.PrimaryCanvas.SetMatrix(cam)
 
 	// draw_
 	{
@@ -389,435 +794,14 @@ func DrawGame(win *pixelgl.Window, game *game, d *DrawContext) {
 			}
 		}
 
-		if game.data.mode != "story" {
-			// Draw: grid effect
-			// TODO, extract?
-			// Add catmullrom splines?
-			width := len(game.grid.points)
-			height := len(game.grid.points[0])
-			d.imd.SetColorMask(pixel.Alpha(0.1))
-			hue := math.Mod((3.6 + ((math.Mod(game.totalTime, 300.0) / 300.0) * 6.0)), 6.0)
-			d.imd.Color = HSVToColor(hue, 0.5, 1.0)
-
-			for y := 0; y < height; y++ {
-				for x := 0; x < width; x++ {
-					left, up := pixel.ZV, pixel.ZV
-					// p := game.grid.points[x][y].origin.ToVec2(win.Bounds())
-					p := game.grid.points[x][y].origin.ToVec2(win.Bounds()) // TODO: make sure this is equivalent
-
-					// fmt.Printf("Drawing point %f %f\n", p.X, p.Y)
-					if x > 0 {
-						left = game.grid.points[x-1][y].origin.ToVec2(win.Bounds())
-						if withinWorld(p) || withinWorld(left) {
-							// It's possible that one but not the other point is brought in from out of the world boundary
-							// If being brought in from out of the world, render right on the border
-							enforceWorldBoundary(&p, 0.0)
-							enforceWorldBoundary(&left, 0.0)
-							thickness := 1.0
-							if y%2 == 0 {
-								thickness = 4.0
-							}
-							d.imd.Push(left, p)
-							d.imd.Line(thickness)
-						}
-					}
-					if y > 0 {
-						up = game.grid.points[x][y-1].origin.ToVec2(win.Bounds())
-						if withinWorld(p) || withinWorld(up) {
-							// It's possible that one but not the other point is brought in from out of the world boundary
-							// If being brought in from out of the world, render right on the border
-							enforceWorldBoundary(&p, 0.0)
-							enforceWorldBoundary(&up, 0.0)
-							thickness := 1.0
-							if x%2 == 0 {
-								thickness = 4.0
-							}
-							d.imd.Push(up, p)
-							d.imd.Line(thickness)
-						}
-					}
-
-					if x > 0 && y > 0 {
-						upLeft := game.grid.points[x-1][y-1].origin.ToVec2(win.Bounds())
-						p1, p2 := upLeft.Add(up).Scaled(0.5), left.Add(p).Scaled(0.5)
-
-						if withinWorld(p1) || withinWorld(p2) {
-							enforceWorldBoundary(&p1, 0.0)
-							enforceWorldBoundary(&p2, 0.0)
-							d.imd.Push(p1, p2)
-							d.imd.Line(1.0)
-						}
-
-						p3, p4 := upLeft.Add(left).Scaled(0.5), up.Add(p).Scaled(0.5)
-
-						if withinWorld(p3) || withinWorld(p4) {
-							enforceWorldBoundary(&p3, 0.0)
-							enforceWorldBoundary(&p4, 0.0)
-							d.imd.Push(p3, p4)
-							d.imd.Line(1.0)
-						}
-					}
-				}
-			}
-
-			// draw: particles
-			d.imd.SetColorMask(pixel.Alpha(0.4))
-			for _, p := range game.data.particles {
-				d.particleDraw.Clear()
-				if p != (particle{}) {
-					defaultSize := pixel.V(8, 2)
-					pModel := defaultSize.ScaledXY(p.scale)
-					d.particleDraw.Color = p.colour
-					d.particleDraw.SetColorMask(pixel.Alpha(p.colour.A))
-					d.particleDraw.SetMatrix(pixel.IM.Rotated(pixel.ZV, p.orientation).Moved(p.origin))
-					d.particleDraw.Push(pixel.V(-pModel.X/2, 0.0), pixel.V(pModel.X/2, 0.0))
-					d.particleDraw.Line(pModel.Y)
-					d.particleDraw.Draw(d.imd)
-				}
-			}
-
-			d.imd.Color = colornames.White
-			d.imd.SetColorMask(pixel.Alpha(1))
-
-			// draw: game.data.player
-			if game.data.player.alive {
-				tmpD := imdraw.New(nil)
-				tmpD.SetMatrix(pixel.IM.Rotated(pixel.ZV, game.data.player.orientation.Angle()).Moved(game.data.player.origin))
-				tmpD.Push(pixel.ZV)
-
-				size := 20.0
-				rad := 4.0
-				tmpD.Circle(size, rad)
-				tmpD.Push(pixel.ZV)
-				tmpD.CircleArc(28.0, 0.3, -0.3, 2.0)
-
-				// d.Push(pixel.ZV)
-				// d.CircleArc(28.0, 0.2, -0.2, 2.0)
-				tmpD.Color = colornames.Lightsteelblue
-
-				if (game.data.weapon != weapondata{}) {
-					tmpD.SetMatrix(pixel.IM.Moved(game.data.player.origin))
-					tmpD.Push(pixel.V(12.0, 0.0).Rotated(game.data.player.relativeTarget.Angle()))
-					tmpD.Circle(4.0, 2.0)
-				}
-				// game.data.playerDraw.Draw(d)
-				tmpD.Draw(d.imd)
-
-				// draw: elements
-				// e := imdraw.New(nil)
-				// e.SetMatrix(pixel.IM.Moved(game.data.player.origin.Add(pixel.V(-32, -40))))
-				// for i := 0; i < len(game.data.player.elements); i++ {
-				// 	element := game.data.player.elements[i]
-				// 	e.Color = elements[element]
-
-				// 	e.Push(pixel.V(float64(i)*32, 0))
-				// 	e.Circle(12, 4)
-				// }
-				// e.Draw(d.imd)
-				// c := pixelgl.NewCanvas(pixel.R(-200, -200, 200, 200))
-				// wardInner.Draw(c, pixel.IM)
-				// wardOuter.Draw(c, pixel.IM)
-				// c.DrawColorMask(d.imd, pixel.IM, elementLifeColor)
-			}
-
-			// lastBomb := game.data.lastBomb.Sub(game.lastFrame).Seconds()
-			// if game.data.lastBomb.Sub(game.lastFrame).Seconds() < 1.0 {
-			// 	// draw: bomb
-			// 	d.imd.Color = colornames.White
-			// 	d.imd.Push(game.data.player.origin)
-			// 	d.imd.Circle(lastBomb*2048.0, 64)
-			// }
-
-			// imd.Push(game.data.player.rect.Min, game.data.player.rect.Max)
-			// imd.Rectangle(2)
-
-			// draw: enemies
-			d.imd.Color = colornames.Lightskyblue
-			for _, e := range game.data.entities {
-				if e.alive {
-					d.imd.SetColorMask(pixel.Alpha(1))
-					size := e.radius
-					if e.spawning {
-						d.imd.SetColorMask(pixel.Alpha(0.7))
-						timeSinceBorn := game.lastFrame.Sub(e.born).Seconds()
-						spawnIndicatorT := e.spawnTime / 2.0
-
-						size = e.radius * (math.Mod(timeSinceBorn, spawnIndicatorT) / spawnIndicatorT)
-						if e.entityType == "blackhole" {
-							size = e.radius * ((timeSinceBorn) / e.spawnTime) // grow from small to actual size
-						}
-					}
-
-					if e.entityType == "wanderer" {
-						d.tmpTarget.Clear()
-						d.tmpTarget.Color = e.color
-						baseTransform := pixel.IM.Rotated(pixel.ZV, e.orientation.Angle()).Moved(e.origin)
-						d.tmpTarget.SetMatrix(baseTransform)
-						d.tmpTarget.Push(
-							pixel.V(0, size),
-							pixel.V(2, 1).Scaled(size/8),
-							pixel.V(0, size).Rotated(-120.0*math.Pi/180),
-							pixel.V(0, -2.236).Scaled(size/8),
-							pixel.V(0, size).Rotated(120.0*math.Pi/180),
-							pixel.V(-2, 1).Scaled(size/8),
-						)
-						d.tmpTarget.Polygon(3)
-						d.tmpTarget.Draw(d.imd)
-					} else if e.entityType == "blackhole" {
-						d.imd.Color = pixel.ToRGBA(e.color)
-						if e.active {
-							heartRate := 0.5 - ((float64(e.hp) / 15.0) * 0.35)
-							volatility := (math.Mod(game.totalTime, heartRate) / heartRate)
-							size += (5 * volatility)
-
-							ringWeight := 2.0
-							if volatility > 0 {
-								ringWeight += (3 * volatility)
-							}
-
-							hue := (math.Mod(game.lastFrame.Sub(e.born).Seconds(), 6.0))
-							baseColor := HSVToColor(hue, 0.5+(volatility/2), 1.0)
-							baseColor = baseColor.Add(pixel.Alpha(volatility / 2))
-
-							d.imd.Color = baseColor
-							d.imd.Push(e.origin)
-							d.imd.Circle(size, ringWeight)
-
-							v2 := math.Mod(volatility+0.5, 1.0)
-							hue2 := (math.Mod(game.lastFrame.Sub(e.born).Seconds()+1.0, 6.0))
-							baseColor2 := HSVToColor(hue2, 0.5+(v2/2), 1.0)
-							baseColor2 = baseColor2.Add(pixel.Alpha(v2 / 2))
-							d.imd.Color = baseColor2
-							d.imd.Push(e.origin)
-							d.imd.Circle(size-ringWeight, ringWeight)
-						} else {
-							d.imd.Push(e.origin)
-							d.imd.Circle(size, float64(4))
-						}
-					} else {
-						d.tmpTarget.Clear()
-						d.tmpTarget.SetMatrix(pixel.IM.Rotated(e.origin, e.orientation.Angle()))
-						weight := 3.0
-
-						// essences
-						if e.entityType == "essence" {
-							rotInterp := 2 * math.Pi * math.Mod(game.totalTime, 8.0) / 8
-							currentT := math.Sin(rotInterp)
-							ang := (currentT * 2 * math.Pi) - math.Pi
-
-							d.tmpTarget.Clear()
-							d.tmpTarget.Color = e.color
-							baseTransform := pixel.IM.Rotated(pixel.ZV, ang).Moved(e.origin)
-							size = size / 2
-							d.tmpTarget.SetMatrix(baseTransform)
-							d.tmpTarget.Push(
-								pixel.V(0, size),
-								pixel.V(2, 1).Scaled(size/8),
-								pixel.V(0, size).Rotated(-120.0*math.Pi/180),
-								pixel.V(0, -2.236).Scaled(size/8),
-								pixel.V(0, size).Rotated(120.0*math.Pi/180),
-								pixel.V(-2, 1).Scaled(size/8),
-							)
-							d.tmpTarget.Polygon(3)
-							d.tmpTarget.Push(
-								pixel.V(0, size).Rotated(60.0*math.Pi/180),
-								pixel.V(2, 1).Scaled(size/8).Rotated(60.0*math.Pi/180),
-								pixel.V(0, size).Rotated(-120.0*math.Pi/180).Rotated(60.0*math.Pi/180),
-								pixel.V(0, -2.236).Scaled(size/8).Rotated(60.0*math.Pi/180),
-								pixel.V(0, size).Rotated(120.0*math.Pi/180).Rotated(60.0*math.Pi/180),
-								pixel.V(-2, 1).Scaled(size/8).Rotated(60.0*math.Pi/180),
-							)
-							d.tmpTarget.Polygon(2)
-							d.tmpTarget.Draw(d.imd)
-						} else if e.entityType == "follower" {
-							d.tmpTarget.Color = e.color
-
-							growth := size / 10.0
-							timeSinceBorn := game.lastFrame.Sub(e.born).Seconds()
-
-							xRad := (size * 1.2) + (growth * math.Sin(2*math.Pi*(math.Mod(timeSinceBorn, 2.0)/2.0)))
-							yRad := (size * 1.2) + (growth * -math.Cos(2*math.Pi*(math.Mod(timeSinceBorn, 2.0)/2.0)))
-							d.tmpTarget.Push(
-								pixel.V(e.origin.X-xRad, e.origin.Y),
-								pixel.V(e.origin.X, e.origin.Y+yRad),
-								pixel.V(e.origin.X+xRad, e.origin.Y),
-								pixel.V(e.origin.X, e.origin.Y-yRad),
-								pixel.V(e.origin.X-xRad, e.origin.Y),
-							)
-							d.tmpTarget.Polygon(weight)
-						} else if e.entityType == "pink" {
-							weight = 4.0
-							d.tmpTarget.Color = e.color
-							d.tmpTarget.Push(pixel.V(e.origin.X-size, e.origin.Y-size), pixel.V(e.origin.X+size, e.origin.Y+size))
-							d.tmpTarget.Rectangle(weight)
-							d.tmpTarget.Push(pixel.V(e.origin.X-size, e.origin.Y-size), pixel.V(e.origin.X+size, e.origin.Y+size))
-							d.tmpTarget.Line(weight)
-							d.tmpTarget.Push(pixel.V(e.origin.X-size, e.origin.Y+size), pixel.V(e.origin.X+size, e.origin.Y-size))
-							d.tmpTarget.Line(weight)
-						} else if e.entityType == "pinkpleb" {
-							weight = 3.0
-							d.tmpTarget.Color = e.color
-							d.tmpTarget.Push(pixel.V(e.origin.X-size, e.origin.Y-size), pixel.V(e.origin.X+size, e.origin.Y+size))
-							d.tmpTarget.Rectangle(weight)
-							d.tmpTarget.Push(pixel.V(e.origin.X-size, e.origin.Y-size), pixel.V(e.origin.X+size, e.origin.Y+size))
-							d.tmpTarget.Line(weight)
-							d.tmpTarget.Push(pixel.V(e.origin.X-size, e.origin.Y+size), pixel.V(e.origin.X+size, e.origin.Y-size))
-							d.tmpTarget.Line(weight)
-						} else if e.entityType == "bubble" {
-							weight = 2.0
-							d.tmpTarget.Color = e.color
-							d.tmpTarget.Push(e.origin)
-							d.tmpTarget.Circle(e.radius, weight)
-						} else if e.entityType == "dodger" {
-							weight = 3.0
-							d.tmpTarget.SetColorMask(pixel.Alpha(0.8))
-							d.tmpTarget.Color = e.color
-							d.tmpTarget.Push(pixel.V(e.origin.X-size, e.origin.Y-size), pixel.V(e.origin.X+size, e.origin.Y+size))
-							d.tmpTarget.Rectangle(weight)
-							d.tmpTarget.Push(pixel.V(e.origin.X-size, e.origin.Y), pixel.V(e.origin.X, e.origin.Y+size))
-							d.tmpTarget.Push(pixel.V(e.origin.X+size, e.origin.Y), pixel.V(e.origin.X, e.origin.Y-size))
-							d.tmpTarget.Polygon(weight)
-							// tmpTarget.Push(e.origin)
-							// tmpTarget.Circle(e.radius, 1.0)
-						} else if e.entityType == "snek" {
-							weight = 3.0
-							// outline := 8.0
-							d.tmpTarget.SetMatrix(pixel.IM.Rotated(pixel.ZV, e.orientation.Angle()-math.Pi/2).Moved(e.origin))
-							d.tmpTarget.Color = e.color
-							d.tmpTarget.Push(pixel.ZV)
-							// small := r / 12.0
-							// medium := r / 4.0
-							// large := r / 2.0
-
-							// tmpTarget.Push(
-							// 	pixel.ZV,
-							// 	pixel.V(-large, medium),
-							// 	pixel.V(-large-medium, large+medium),
-							// 	pixel.V(-large-medium, medium),
-							// 	pixel.V(-large, -large),
-							// 	pixel.V(0.0, -large),
-							// 	pixel.V(large, -large),
-							// 	pixel.V(large+medium, medium),
-							// 	pixel.V(large+medium, large+medium),
-							// 	pixel.V(large, medium),
-							// )
-							d.tmpTarget.Circle(e.radius, weight)
-
-							d.tmpTarget.SetMatrix(pixel.IM)
-							d.tmpTarget.Color = colornames.Blueviolet
-							for _, snekT := range e.tail {
-								if snekT.entityType != "snektail" {
-									continue
-								}
-								d.tmpTarget.Push(
-									snekT.origin,
-								)
-								d.tmpTarget.Circle(snekT.radius, 3.0)
-							}
-						} else if e.entityType == "replicator" {
-							d.tmpTarget.Color = colornames.Orangered
-							d.tmpTarget.Push(e.origin)
-							d.tmpTarget.Circle(e.radius, 4.0)
-						} else if e.entityType == "gate" {
-							d.tmpTarget.Color = colornames.Lightyellow
-							d.tmpTarget.Push(e.origin.Add(pixel.V(-e.radius, 0.0)), e.origin.Add(pixel.V(e.radius, 0.0)))
-							d.tmpTarget.Line(4.0)
-						}
-						d.tmpTarget.Draw(d.imd)
-					}
-				}
-			}
-
-			for _, b := range game.data.bullets {
-				if b.data.alive {
-					d.bulletDraw.Clear()
-					d.bulletDraw.SetMatrix(pixel.IM.Rotated(pixel.ZV, b.data.orientation.Angle()-math.Pi/2).Moved(b.data.origin))
-					d.bulletDraw.SetColorMask(pixel.Alpha(0.9 - (time.Since(b.data.born).Seconds() / b.duration)))
-					drawBullet(&b, d.bulletDraw)
-					d.bulletDraw.Draw(d.imd)
-				}
-			}
-		}
-
-		d.PrimaryCanvas.Clear(colornames.Black)
-		d.imd.Draw(d.PrimaryCanvas)
-
-		// draw: wards
-		// todo move these batch initializers to run once territory
-		d.innerWardBatch.Clear()
-		d.outerWardBatch.Clear()
-
-		if game.data.player.alive {
-			rotInterp := 2 * math.Pi * math.Mod(game.totalTime, 8.0) / 8
-			currentT := math.Sin(rotInterp)
-			ang := (currentT * 2 * math.Pi) - math.Pi
-
-			d.PrimaryCanvas.SetComposeMethod(pixel.ComposePlus)
-			if len(game.data.player.elements) > 0 {
-				d.innerWardBatch.Clear()
-				d.innerWardBatch.SetMatrix(pixel.IM.Rotated(pixel.ZV, ang).Moved(game.data.player.origin))
-				el := game.data.player.elements[0]
-				d.innerWardBatch.SetColorMask(elements[el])
-				d.wardInner.Draw(d.innerWardBatch, pixel.IM.Scaled(pixel.ZV, 0.6))
-				d.innerWardBatch.Draw(d.PrimaryCanvas)
-			}
-
-			if len(game.data.player.elements) > 1 {
-				d.outerWardBatch.Clear()
-				el := game.data.player.elements[1]
-				d.outerWardBatch.SetMatrix(pixel.IM.Rotated(pixel.ZV, ang).Moved(game.data.player.origin))
-				d.outerWardBatch.SetColorMask(elements[el])
-				d.wardOuter.Draw(d.outerWardBatch, pixel.IM.Scaled(pixel.ZV, 0.6))
-				d.outerWardBatch.Draw(d.PrimaryCanvas)
-			}
-		}
-
-		// if len(game.data.player.elements) > 2 {
-		// 	d.innerWardBatch.Clear()
-		// 	el := game.data.player.elements[2]
-		// 	d.innerWardBatch.SetMatrix(pixel.IM.Rotated(pixel.ZV, ang).Moved(game.data.player.origin))
-		// 	d.innerWardBatch.SetColorMask(elements[el])
-		// 	d.wardInner.Draw(innerWardBatch, pixel.IM.Scaled(pixel.ZV, 0.6))
-		// 	d.innerWardBatch.Draw(d.PrimaryCanvas)
-		// }
-		d.PrimaryCanvas.SetComposeMethod(pixel.ComposeOver)
-
-		if game.data.mode != "story" {
-			d.mapRect.Draw(d.PrimaryCanvas)
-		}
-
-		d.bloom1.Clear(colornames.Black)
-		d.bloom2.Clear(colornames.Black)
-		d.PrimaryCanvas.Draw(d.bloom1, pixel.IM.Moved(d.PrimaryCanvas.Bounds().Center()))
-		d.bloom1.Draw(d.bloom2, pixel.IM.Moved(d.PrimaryCanvas.Bounds().Center()))
-		d.bloom1.Clear(colornames.Black)
-		d.PrimaryCanvas.Draw(d.bloom1, pixel.IM.Moved(d.PrimaryCanvas.Bounds().Center()))
-		d.bloom2.Draw(d.bloom1, pixel.IM.Moved(d.PrimaryCanvas.Bounds().Center()))
-		d.bloom1.Draw(d.bloom3, pixel.IM.Moved(d.PrimaryCanvas.Bounds().Center()))
+		drawWorld(d.world, game, d.art)
 
 		d.imd.Clear()
 		if game.state == "playing" {
-			for eID, e := range game.data.entities {
-				if (!e.alive && e.death != time.Time{} && e.entityType != "" && e.bounty > 0) {
-					// fmt.Print("[DrawBounty]")
-					// Draw: bounty
-					e.text.Clear()
-					e.text.Orig = e.origin
-					e.text.Dot = e.origin
-
-					text := fmt.Sprintf("%d", e.bounty*game.data.scoreMultiplier)
-					e.text.Dot.X -= (e.text.BoundsOf(text).W() / 2)
-					fmt.Fprintf(e.text, "%s", text)
-					e.text.Color = colornames.Lightgoldenrodyellow
-
-					growth := (0.5 - (float64(e.expiry.Sub(game.lastFrame).Milliseconds()) / 300.0))
-					e.text.Draw(
-						d.PrimaryCanvas,
-						pixel.IM.Scaled(e.text.Orig, 1.0-growth),
-					)
-				}
+			drawBounties(d.world, game)
 
-				if g_debug {
+			if g_debug {
+				for eID, e := range game.data.entities {
 					e.DrawDebug(fmt.Sprintf("%d", eID), d.imd, d.PrimaryCanvas)
 				}
 			}
@@ -835,117 +819,34 @@ func DrawGame(win *pixelgl.Window, game *game, d *DrawContext) {
 			}
 		}
 
+		d.postFX.Update()
+		final := d.postFX.Apply(d.PrimaryCanvas)
+
 		// stretch the canvas to the window
 		win.Clear(colornames.Black)
 		win.SetMatrix(pixel.IM.ScaledXY(pixel.ZV,
 			pixel.V(
-				win.Bounds().W()/d.bloom2.Bounds().W(),
-				win.Bounds().H()/d.bloom2.Bounds().H(),
+				win.Bounds().W()/d.PrimaryCanvas.Bounds().W(),
+				win.Bounds().H()/d.PrimaryCanvas.Bounds().H(),
 			),
 		).Moved(win.Bounds().Center()))
 
 		win.SetComposeMethod(pixel.ComposePlus)
-		// bloom2.Draw(win, pixel.IM.Moved(bloom2.Bounds().Center()))
-		d.bloom3.Draw(win, pixel.IM.Moved(d.bloom2.Bounds().Center()))
-		d.PrimaryCanvas.Draw(win, pixel.IM.Moved(d.PrimaryCanvas.Bounds().Center()))
+		drawStretched(final, win, d.PrimaryCanvas.Bounds())
 
 		d.imd.Clear()
 		d.imd.Color = colornames.Orange
 		d.imd.SetColorMask(pixel.Alpha(1.0))
 		d.uiCanvas.Clear(colornames.Black)
 		if game.state == "playing" {
-			d.scoreTxt.Clear()
-			txt := "Score: %d\n"
-			d.scoreTxt.Dot.X -= (d.scoreTxt.BoundsOf(txt).W() / 2)
-			fmt.Fprintf(d.scoreTxt, txt, game.data.score)
-			txt = "X%d\n"
-			d.scoreTxt.Dot.X -= (d.scoreTxt.BoundsOf(txt).W() / 2)
-			fmt.Fprintf(d.scoreTxt, txt, game.data.scoreMultiplier)
-
-			d.highscoreTxt.Clear()
-			highscore := game.localData.Highscore()
-			highscoreTxt := fmt.Sprintf("%s: %d", highscore.Name, highscore.Score)
-			d.highscoreTxt.Dot.X -= (d.highscoreTxt.BoundsOf(highscoreTxt).W() / 2)
-			fmt.Fprintf(d.highscoreTxt, highscoreTxt)
+			d.hud.Draw(win, d.PrimaryCanvas.Bounds(), game)
+			drawStoryPage(d, win, game)
 
 			d.consoleTxt.Clear()
 			if g_debug {
 				drawDebug(d, game)
 				d.consoleTxt.Draw(win, pixel.IM.Scaled(d.consoleTxt.Orig, 1))
 			}
-
-			d.scoreTxt.Draw(
-				win,
-				pixel.IM.Scaled(d.scoreTxt.Orig, 1),
-			)
-
-			if highscore.Score > 0 {
-				d.highscoreTxt.Draw(
-					win,
-					pixel.IM.Scaled(d.highscoreTxt.Orig, 1),
-				)
-			}
-
-			d.livesTxt.Clear()
-			txt = "Lives: %d\n"
-			d.livesTxt.Dot.X -= (d.livesTxt.BoundsOf(txt).W() / 2)
-			fmt.Fprintf(d.livesTxt, txt, game.data.lives)
-			txt = "Bombs: %d\n"
-			d.livesTxt.Dot.X -= (d.livesTxt.BoundsOf(txt).W() / 2)
-			fmt.Fprintf(d.livesTxt, txt, game.data.bombs)
-
-			// draw: UI
-			// uiOrigin := pixel.V(-win.Bounds().W()/2+128, -win.Bounds().H()/2+192)
-
-			// WASD
-			// d.imd.Color = colornames.Black
-			// d.imd.Push(uiOrigin.Add(pixel.V(50, 0)))
-			// d.imd.Circle(20.0, 0)
-
-			// d.imd.Push(uiOrigin.Add(pixel.V(10, -50)))
-			// d.imd.Circle(20.0, 0)
-
-			// d.imd.Push(uiOrigin.Add(pixel.V(60, -50)))
-			// d.imd.Circle(20.0, 0)
-
-			// d.imd.Push(uiOrigin.Add(pixel.V(110, -50)))
-			// d.imd.Circle(20.0, 0)
-
-			// d.imd.Color = elementWaterColor
-			// d.imd.Push(uiOrigin)
-			// d.imd.Circle(20.0, 0)
-
-			// d.imd.Color = elementChaosColor
-			// d.imd.Push(uiOrigin.Add(pixel.V(100, 0)))
-			// d.imd.Circle(20.0, 0)
-
-			// d.imd.Color = elementSpiritColor
-			// d.imd.Push(uiOrigin.Add(pixel.V(150, 0)))
-			// d.imd.Circle(20.0, 0)
-
-			// d.imd.Color = elementFireColor
-			// d.imd.Push(uiOrigin.Add(pixel.V(160, -50)))
-			// d.imd.Circle(20.0, 0)
-
-			// d.imd.Color = elementLightningColor
-			// d.imd.Push(uiOrigin.Add(pixel.V(20, -100)))
-			// d.imd.Circle(20.0, 0)
-
-			// d.imd.Color = elementWindColor
-			// d.imd.Push(uiOrigin.Add(pixel.V(70, -100)))
-			// d.imd.Circle(20.0, 0)
-
-			// d.imd.Color = elementLifeColor
-			// d.imd.Push(uiOrigin.Add(pixel.V(120, -100)))
-			// d.imd.Circle(20.0, 0)
-			// imd.Color = elementFireColor
-			// imd.Push(uiOrigin.Add(pixel.V(160, -50)))
-			// imd.Circle(20.0, 0)
-
-			d.livesTxt.Draw(
-				win,
-				pixel.IM.Scaled(d.livesTxt.Orig, 1),
-			)
 		} else if game.state == "paused" {
 			d.titleTxt.Clear()
 			d.titleTxt.Orig = pixel.V(0.0, 128.0)
@@ -1019,21 +920,6 @@ func DrawGame(win *pixelgl.Window, game *game, d *DrawContext) {
 				d.uiCanvas,
 				pixel.IM.Scaled(d.centeredTxt.Orig, 1),
 			)
-		} else if game.state == "story_mode" {
-			// d.centeredTxt.Orig = pixel.V(-112, 64)
-			// d.centeredTxt.Clear()
-			// for _, page := range chapter1.pages {
-
-			// 		d.imd.Push(d.centeredTxt.Dot.Add(pixel.V(-8.0, (d.centeredTxt.LineHeight/2.0)-4.0)))
-			// 		d.imd.Circle(2.0, 4.0)
-			// 	fmt.Fprintln(centeredTxt, item)
-			// }
-
-			// // d.centeredTxt.Color = color.RGBA64{255, 255, 255, 255}
-			// d.centeredTxt.Draw(
-			// 	d.uiCanvas,
-			// 	pixel.IM.Scaled(d.centeredTxt.Orig, 1),
-			// )
 		} else if game.state == "game_over" {
 			d.titleTxt.Clear()
 			d.titleTxt.Orig = pixel.V(0.0, 128.0)
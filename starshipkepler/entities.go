@@ -7,9 +7,6 @@ import (
 	"math/rand"
 	"time"
 
-	"github.com/faiface/beep"
-	"github.com/faiface/beep/effects"
-	"github.com/faiface/beep/speaker"
 	"github.com/faiface/pixel"
 	"github.com/faiface/pixel/imdraw"
 	"github.com/faiface/pixel/pixelgl"
@@ -46,8 +43,7 @@ type entityData struct {
 	elements []string
 
 	// sounds
-	spawnSound *beep.Buffer
-	volume     float64
+	spawnSound string // sound bank name
 
 	// enemy data
 	bounty       int
@@ -67,72 +63,20 @@ type entityData struct {
 	active                bool
 	particleEmissionAngle float64
 
-	// debugging
-	selected bool
-}
+	// turrets and snipers
+	lastShot time.Time
+	orbit    float64 // which way round snipers circle the player, 1 or -1
 
-type particle struct {
-	origin      pixel.Vec
-	orientation float64
-	scale       pixel.Vec
-
-	colour      pixel.RGBA
-	duration    float64
-	percentLife float64
-
-	velocity         pixel.Vec
-	lengthMultiplier float64
-	particleType     string
-}
+	// steering
+	wanderAngle float64
 
-func NewParticle(x float64, y float64, c pixel.RGBA, duration float64, scale pixel.Vec, theta float64, velocity pixel.Vec, lengthMultiplier float64, t string) particle {
-	p := particle{}
-	p.origin = pixel.V(x, y)
-	p.colour = c
-	p.duration = duration
-	p.scale = scale
-	p.orientation = theta
-	p.velocity = velocity
-	p.lengthMultiplier = lengthMultiplier
-	p.particleType = t
-
-	p.percentLife = 1.0
-	return p
+	// debugging
+	selected bool
 }
 
 // Not 100% sure if these "inline append" functions are needed anymore
 // (They were a blind attempt at solving a performance issue that turned out to be completely unrelated)
 
-func InlineAppendParticles(
-	particles []particle,
-	particlesToAdd ...particle) []particle {
-
-	// config var
-	if !particlesOn {
-		return particles
-	}
-	for _, newParticle := range particlesToAdd {
-		if newParticle == (particle{}) {
-			continue
-		}
-		particleID := 0
-		if len(particles) < cap(particles) {
-			particles = append(particles, newParticle)
-		} else {
-			for particleID < len(particles) {
-				existing := particles[particleID]
-				if existing == (particle{}) {
-					particles[particleID] = newParticle
-					break
-				}
-				particleID++
-			}
-		}
-	}
-
-	return particles
-}
-
 func InlineAppendBullets(
 	bullets []bullet,
 	bulletsToAdd ...bullet) []bullet {
@@ -186,88 +130,30 @@ func InlineAppendEntities(
 	return entities
 }
 
-func (e *entityData) SpawnSound() beep.Streamer {
-	return &effects.Volume{
-		Streamer: e.spawnSound.Streamer(0, e.spawnSound.Len()),
-		Base:     10,
-		Volume:   e.volume,
-		Silent:   false,
-	}
-}
-
 func PlaySpawnSounds(spawns []entityData) {
 	playback := map[string]bool{}
 	for _, e := range spawns {
-		if playback[e.entityType] || e.spawnSound == nil {
+		if playback[e.entityType] || e.spawnSound == "" {
 			continue
 		}
 		playback[e.entityType] = true
-		speaker.Play(e.SpawnSound())
+		PlaySoundAt(e.spawnSound, e.origin)
 	}
 }
 
-func outOfWorld(v pixel.Vec) bool {
-	return v.X < -worldWidth/2 || v.X > worldWidth/2 || v.Y < -worldHeight/2 || v.Y > worldHeight/2
-}
-
-func withinWorld(v pixel.Vec) bool {
-	return !outOfWorld(v)
-}
-
-func enforceWorldBoundary(v *pixel.Vec, margin float64) { // this code seems dumb, TODO: find some api call that does it
-	minX := -(worldWidth / 2.0) + margin
-	minY := -(worldHeight / 2.0) + margin
-	maxX := (worldWidth / 2.) - margin
-	maxY := (worldHeight / 2.0) - margin
-	if v.X < minX {
-		v.X = minX
-	} else if v.X > maxX {
-		v.X = maxX
-	}
-	if v.Y < minY {
-		v.Y = minY
-	} else if v.Y > maxY {
-		v.Y = maxY
-	}
+// enforceWorldBoundary keeps the entity in the arena and out of its obstacles, bouncing off or sliding along them
+func (p *entityData) enforceWorldBoundary(arena *Arena, bounce bool) {
+	p.origin, p.velocity, _ = arena.Collide(p.origin, p.velocity, p.radius, bounce)
 }
 
-func (p *entityData) enforceWorldBoundary(bounce bool) { // this code seems dumb, TODO: find some api call that does it
-	minX := -(worldWidth / 2.0) + p.radius
-	minY := -(worldHeight / 2.0) + p.radius
-	maxX := (worldWidth / 2.) - p.radius
-	maxY := (worldHeight / 2.0) - p.radius
-	if p.origin.X < minX {
-		p.origin.X = minX
-		if bounce {
-			p.velocity.X *= -1.0
-		}
-	} else if p.origin.X > maxX {
-		p.origin.X = maxX
-		if bounce {
-			p.velocity.X *= -1.0
-		}
-	}
-	if p.origin.Y < minY {
-		p.origin.Y = minY
-		if bounce {
-			p.velocity.Y *= -1.0
-		}
-	} else if p.origin.Y > maxY {
-		p.origin.Y = maxY
-		if bounce {
-			p.velocity.Y *= -1.0
-		}
-	}
+func (e *entityData) Circle() pixel.Circle {
+	return pixel.C(e.origin, e.radius)
 }
 
 func (e *entityData) MovementCollisionCircle() pixel.Circle {
 	return pixel.C(e.origin, e.movementColliderRadius)
 }
 
-func (e *entityData) Circle() pixel.Circle {
-	return pixel.C(e.origin, e.radius)
-}
-
 func (e *entityData) IntersectWithPlayer(
 	inflictor entityData,
 	eID int,
@@ -277,14 +163,7 @@ func (e *entityData) IntersectWithPlayer(
 	if e.entityType == "gate" {
 		game.grid.ApplyExplosiveForce(100, Vector3{e.origin.X, e.origin.Y, 0.0}, 100)
 
-		deathSound := blackholeDieBuffer.Streamer(0, blackholeDieBuffer.Len())
-		volume := &effects.Volume{
-			Streamer: deathSound,
-			Base:     10,
-			Volume:   -0.25,
-			Silent:   false,
-		}
-		speaker.Play(volume)
+		PlaySoundAt("gate/explode", e.origin)
 		// damage surrounding entities and push them back
 		for entID, ent := range game.data.entities {
 			if eID == entID || !ent.alive || ent.spawning || ent.entityType == "gate" {
@@ -319,51 +198,42 @@ func (e *entityData) IntersectWithPlayer(
 		// player died
 		if !warded && !g_debug {
 			e.killedPlayer = true
-			player.alive = false
-			player.death = currTime
-			game.data.lastWave = time.Now().Add((time.Duration(-game.data.waveFreq) + 2) * time.Second)
-			game.data.spawning = false
-			PlaySound("player/die")
-
-			for i := 0; i < 1200; i++ {
-				speed := 24.0 * (1.0 - 1/((rand.Float64()*32.0)+1))
-				p := NewParticle(
-					player.origin.X,
-					player.origin.Y,
-					pixel.ToRGBA(colornames.Lightyellow),
-					100,
-					pixel.V(
-						1.5,
-						1.5,
-					),
-					0.0,
-					randomVector(speed),
-					2.5,
-					"player",
-				)
-				game.data.newParticles = InlineAppendParticles(game.data.newParticles, p)
-			}
-
 			e.alive = false
-			for entID, ent := range game.data.entities {
-				ent.alive = false
-				game.data.entities[entID] = ent
-			}
-
-			if game.data.mode == "menu" {
-				game.data.player = *NewPlayer(0.0, 0.0)
-			} else {
-				game.data.lives--
-				if game.data.lives == 0 {
-					GameOver(game)
-				}
-			}
+			game.killPlayer(player, currTime)
 		}
 
 	}
 	game.data.entities[eID] = *e
 }
 
+// killPlayer blows up the player, and everything else with them
+func (game *game) killPlayer(player *entityData, currTime time.Time) {
+	player.alive = false
+	player.death = currTime
+	game.data.lastWave = time.Now().Add((time.Duration(-game.data.waveFreq) + 2) * time.Second)
+	game.data.spawning = false
+	PlaySoundAt("player/die", player.origin)
+	audio.Duck(0.8)
+	game.Camera.Shake(1.0)
+
+	game.data.particles.Emit("player/die", player.origin, pixel.ZV, pixel.ToRGBA(colornames.Lightyellow))
+	game.data.projectiles.Clear()
+
+	for entID, ent := range game.data.entities {
+		ent.alive = false
+		game.data.entities[entID] = ent
+	}
+
+	if game.data.mode == "menu" {
+		game.data.player = *NewPlayer(0.0, 0.0)
+	} else {
+		game.data.lives--
+		if game.data.lives == 0 {
+			GameOver(game)
+		}
+	}
+}
+
 func (b *bullet) DealDamage(
 	inflictor *entityData,
 	bID int,
@@ -420,38 +290,13 @@ func (e *entityData) DealDamage(
 		e.bountyText = fmt.Sprintf("%d", reward)
 		game.data.entities[eID] = *e
 		// Draw particles
-		hue1 := rand.Float64() * 6.0
-		hue2 := math.Mod(hue1+(rand.Float64()*1.5), 6.0)
-		for i := 0; i < 120; i++ {
-			speed := 24 * (1.0 - (1.0 / ((rand.Float64() * 10.0) + 1.0)))
-			t := rand.Float64()
-			diff := math.Abs(hue1 - hue2)
-			hue := hue1 + (diff * t)
-
-			p := NewParticle(
-				e.origin.X,
-				e.origin.Y,
-				HSVToColor(hue, 0.5, 1.0),
-				64,
-				pixel.V(1.5, 1.5),
-				0.0,
-				randomVector(speed),
-				1.8,
-				"enemy",
-			)
-
-			if len(game.data.newParticles) < maxParticles {
-				game.data.newParticles = InlineAppendParticles(game.data.newParticles, p)
-			} else {
-				game.data.newParticles[len(game.data.newParticles)%maxParticles] = p
-			}
-		}
+		game.data.particles.Emit("entity/die", e.origin, pixel.ZV)
 
 		if len(e.elements) > 0 {
 			r := rand.Float64()
 			if r < 0.1 {
 				essence := *NewEssence(
-					e.origin.X, e.origin.Y, e.elements[0], e.color, game.lastFrame.Add(time.Duration(5)*time.Second),
+					e.origin.X, e.origin.Y, e.elements[0], game.lastFrame.Add(time.Duration(5)*time.Second),
 				)
 				game.data.newEntities = InlineAppendEntities(
 					game.data.newEntities, essence,
@@ -460,7 +305,7 @@ func (e *entityData) DealDamage(
 		}
 
 		// on kill
-		PlaySound("entity/die")
+		PlaySoundAt("entity/die", e.origin)
 		if e.entityType == "pink" {
 			// spawn 3 mini plebs
 			for i := 0; i < 3; i++ {
@@ -480,14 +325,8 @@ func (e *entityData) DealDamage(
 			}
 		} else if e.entityType == "blackhole" {
 			game.grid.ApplyExplosiveForce(200, Vector3{e.origin.X, e.origin.Y, 0.0}, 200)
-			deathSound := blackholeDieBuffer.Streamer(0, blackholeDieBuffer.Len())
-			volume := &effects.Volume{
-				Streamer: deathSound,
-				Base:     10,
-				Volume:   -0.25,
-				Silent:   false,
-			}
-			speaker.Play(volume)
+			PlaySoundAt("blackhole/die", e.origin)
+			game.Camera.Shake(0.5)
 			// damage surrounding entities and push them back
 			for entID, ent := range game.data.entities {
 				if eID == entID || !ent.alive || ent.spawning {
@@ -516,29 +355,7 @@ func (e *entityData) DealDamage(
 		if e.entityType == "blackhole" {
 			game.grid.ApplyExplosiveForce(e.radius*8, Vector3{e.origin.X, e.origin.Y, 0.0}, e.radius*4)
 			e.active = true
-
-			hue1 := rand.Float64() * 6.0
-			hue2 := math.Mod(hue1+(rand.Float64()*1.5), 6.0)
-			for i := 0; i < 64; i++ {
-				speed := 32 * (1.0 - (1.0 / ((rand.Float64() * 10.0) + 1.0)))
-				t := rand.Float64()
-				diff := math.Abs(hue1 - hue2)
-				hue := hue1 + (diff * t)
-
-				p := NewParticle(
-					e.origin.X,
-					e.origin.Y,
-					HSVToColor(hue, 0.5, 1.0),
-					64,
-					pixel.V(1.0, 1.0),
-					0.0,
-					randomVector(speed),
-					3.0,
-					"enemy",
-				)
-
-				game.data.newParticles = InlineAppendParticles(game.data.newParticles, p)
-			}
+			game.data.particles.Emit("blackhole/hit", e.origin, pixel.ZV)
 		}
 	}
 }
@@ -554,7 +371,16 @@ func (e *entityData) Back(margin float64) pixel.Vec {
 	return e.origin.Add(e.orientation.Scaled((-1 * e.radius) - margin))
 }
 
-func (e *entityData) Update(dt float64, totalT float64, currTime time.Time) {
+// EmitWake streams particles off the corners of the entity, e.g. as it gets pulled or dodges
+func (e *entityData) EmitWake(game *game, velocity pixel.Vec) {
+	colour := pixel.ToRGBA(e.Colour())
+	for _, corner := range []pixel.Vec{pixel.V(1, 1), pixel.V(-1, 1), pixel.V(1, -1), pixel.V(-1, -1)} {
+		pos := corner.Rotated(e.orientation.Angle()).Scaled(e.radius).Add(e.origin)
+		game.data.particles.Emit("enemy/wake", pos, velocity, colour)
+	}
+}
+
+func (e *entityData) Update(dt float64, totalT float64, currTime time.Time, arena *Arena) {
 	e.velocity = e.velocity.Scaled(e.friction)
 	if e.velocity.Len() < 0.2 {
 		e.velocity = pixel.ZV
@@ -572,7 +398,7 @@ func (e *entityData) Update(dt float64, totalT float64, currTime time.Time) {
 	if e.entityType == "snek" {
 		e.orientation = e.velocity.Unit()
 		nextTailTarget := e.Back(e.radius)
-		enforceWorldBoundary(&nextTailTarget, e.radius)
+		nextTailTarget = arena.Clamp(nextTailTarget, e.radius)
 		for tID, snekT := range e.tail {
 			if snekT.entityType != "snektail" {
 				continue
@@ -582,7 +408,7 @@ func (e *entityData) Update(dt float64, totalT float64, currTime time.Time) {
 			snekT.origin = nextTailTarget
 			e.tail[tID] = snekT
 			nextTailTarget = snekT.Back(snekT.radius)
-			enforceWorldBoundary(&nextTailTarget, e.radius)
+			nextTailTarget = arena.Clamp(nextTailTarget, e.radius)
 		}
 		if len(e.tail) < 16 {
 			tailPieceT := nextTailTarget
@@ -604,7 +430,13 @@ func (e *entityData) Update(dt float64, totalT float64, currTime time.Time) {
 	if e.entityType == "blackhole" {
 		e.radius = 20 + (20 * (float64(e.hp) / 10.0))
 	}
-	e.enforceWorldBoundary(true)
+	if e.entityType == "player" {
+		// the player still bounces off the edge, but slides along obstacles so they can't snag on them
+		e.origin, e.velocity, _ = arena.Reflect(e.origin, e.velocity, e.radius)
+		e.origin, e.velocity, _ = arena.Deflect(e.origin, e.velocity, e.radius, false)
+		return
+	}
+	e.enforceWorldBoundary(arena, true)
 }
 
 func (e *entityData) DrawDebug(entityID string, imd *imdraw.IMDraw, canvas *pixelgl.Canvas) {
@@ -712,6 +544,7 @@ type bullet struct {
 	data     entityData
 	duration float64
 	velocity pixel.Vec
+	from     pixel.Vec // where it was before this update, so it can't skip through walls
 
 	width  float64
 	length float64
@@ -732,7 +565,6 @@ func NewEntity(x float64, y float64, size float64, speed float64, entityType str
 	p.hp = 1
 	p.alive = true
 	p.entityType = entityType
-	p.volume = 0.0
 	p.born = time.Now()
 	p.bornPos = p.origin
 	p.text = text.New(pixel.V(0, 0), basicFont)
@@ -746,20 +578,18 @@ func NewPlayer(x float64, y float64) *entityData {
 	return p
 }
 
-func NewEssence(x float64, y float64, essence string, color color.Color, expiry time.Time) *entityData {
+func NewEssence(x float64, y float64, essence string, expiry time.Time) *entityData {
 	e := NewEntity(x, y, 44.0, 0, "essence")
 	e.expiry = expiry
 	e.elements = []string{essence}
-	e.color = color
 	return e
 }
 
 func NewFollower(x float64, y float64) *entityData {
 	e := NewEntity(x, y, 44.0, 280, "follower")
-	e.spawnSound = spawnBuffer
+	e.spawnSound = "spawn/follower"
 	e.elements = []string{"water"}
 	e.color = colornames.Cornflowerblue
-	e.volume = -0.6
 	e.bounty = 50
 	e.movementColliderRadius = 24.0
 	return e
@@ -767,10 +597,9 @@ func NewFollower(x float64, y float64) *entityData {
 
 func NewWanderer(x float64, y float64) *entityData {
 	w := NewEntity(x, y, 44.0, 200, "wanderer")
-	w.spawnSound = spawnBuffer4
+	w.spawnSound = "spawn/wanderer"
 	w.elements = []string{"lightning"}
 	w.color = colornames.Mediumpurple
-	w.volume = -0.4
 	w.acceleration = 1
 	w.bounty = 25
 	return w
@@ -779,10 +608,9 @@ func NewWanderer(x float64, y float64) *entityData {
 func NewDodger(x float64, y float64) *entityData {
 	w := NewEntity(x, y, 44.0, 380, "dodger")
 	w.elements = []string{"wind"}
-	w.spawnSound = spawnBuffer2
+	w.spawnSound = "spawn/dodger"
 	w.color = colornames.Orange
 	w.acceleration = 2.0
-	w.volume = -0.5
 	w.friction = 0.95
 	w.bounty = 100
 	return w
@@ -791,9 +619,8 @@ func NewDodger(x float64, y float64) *entityData {
 func NewPinkSquare(x float64, y float64) *entityData {
 	w := NewEntity(x, y, 44.0, 460, "pink")
 	w.elements = []string{"chaos"}
-	w.spawnSound = spawnBuffer5
+	w.spawnSound = "spawn/pink"
 	w.acceleration = 1.0
-	w.volume = -0.2
 	w.color = colornames.Crimson
 	w.friction = 0.98
 	w.bounty = 100
@@ -802,7 +629,7 @@ func NewPinkSquare(x float64, y float64) *entityData {
 
 func NewPinkPleb(x float64, y float64) *entityData {
 	w := NewEntity(x, y, 26.0, 256, "pinkpleb")
-	// w.spawnSound = spawnBuffer4
+	// w.spawnSound = "spawn/wanderer"
 	w.elements = []string{"chaos"}
 	w.virtualOrigin = pixel.V(x, y)
 	w.origin = w.virtualOrigin.Add(pixel.V(48.0, 0.0))
@@ -819,8 +646,7 @@ func NewSnek(x float64, y float64) *entityData {
 	s.spawnTime = 0.0
 	s.spawning = false
 	s.color = colornames.Azure
-	s.spawnSound = snakeSpawnBuffer
-	s.volume = -0.8
+	s.spawnSound = "spawn/snek"
 	s.cone = 30 + (rand.Float64() * 90.0)
 	s.lastTailSpawn = time.Now()
 	s.bounty = 150
@@ -829,11 +655,10 @@ func NewSnek(x float64, y float64) *entityData {
 
 func NewAngryBubble(x float64, y float64) *entityData {
 	w := NewEntity(x, y, 35.0, 200, "bubble")
-	// w.spawnSound = spawnBuffer4
+	// w.spawnSound = "spawn/wanderer"
 	w.elements = []string{"spirit"}
 	w.spawnTime = 0.0
 	w.spawning = false
-	w.color = elementSpiritColor
 	w.acceleration = 0.9
 	w.speed = 600
 	w.friction = 0.99
@@ -845,9 +670,7 @@ func NewBlackHole(x float64, y float64) *entityData {
 	b := NewEntity(x, y, 40.0, 0.0, "blackhole")
 	b.bounty = 150
 	b.elements = []string{"fire"}
-	b.color = elementFireColor
-	b.spawnSound = spawnBuffer3
-	b.volume = -0.6
+	b.spawnSound = "spawn/blackhole"
 	b.hp = 10
 	b.active = false // dormant until activation (by taking damage)
 	return b
@@ -861,6 +684,50 @@ func NewReplicator(x float64, y float64) *entityData {
 	return b
 }
 
+// NewTurret is dug in where it lands, spitting fans of fireballs at the player
+func NewTurret(x float64, y float64) *entityData {
+	t := NewEntity(x, y, 48.0, 0.0, "turret")
+	t.elements = []string{"fire"}
+	t.spawnSound = "spawn/turret"
+	t.spawnTime = 1.0
+	t.hp = 4
+	t.bounty = 150
+	t.lastShot = time.Now()
+	return t
+}
+
+// NewSniper circles the player at a distance, lining up long fast shots
+func NewSniper(x float64, y float64) *entityData {
+	s := NewEntity(x, y, 36.0, 300, "sniper")
+	s.elements = []string{"lightning"}
+	s.spawnSound = "spawn/sniper"
+	s.acceleration = 1.5
+	s.friction = 0.95
+	s.hp = 2
+	s.bounty = 200
+	s.lastShot = time.Now()
+	s.orbit = 1
+	if rand.Float64() < 0.5 {
+		s.orbit = -1
+	}
+	return s
+}
+
+// NewStarling is one of a flock, they swoop in on where the player's going rather than where they are
+func NewStarling(x float64, y float64) *entityData {
+	s := NewEntity(x, y, 24.0, 340, "starling")
+	s.elements = []string{"wind"}
+	s.color = colornames.Lightskyblue
+	s.spawnSound = "spawn/wanderer"
+	s.acceleration = 1.2
+	s.friction = 0.96
+	s.bounty = 40
+	s.movementColliderRadius = 24.0 // keeps a bit of space around itself in the flock
+	s.orientation = randomVector(1.0).Unit()
+	s.wanderAngle = rand.Float64() * 2 * math.Pi
+	return s
+}
+
 func NewGate(x float64, y float64) *entityData {
 	b := NewEntity(x, y, 212.0, 40.0, "gate")
 	b.orientation = randomVector(1.0)
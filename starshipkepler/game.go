@@ -1,13 +1,12 @@
 package starshipkepler
 
 import (
+	"fmt"
 	"math"
 	"math/rand"
 	"runtime"
 	"time"
 
-	"github.com/faiface/beep/effects"
-	"github.com/faiface/beep/speaker"
 	"github.com/faiface/pixel"
 	"github.com/faiface/pixel/pixelgl"
 	"github.com/nathanKramer/starship-kepler/sliceextra"
@@ -41,8 +40,7 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 		// fmt.Printf("Bullets\tlen: %d\tcap: %d\n", len(game.data.bullets), cap(game.data.bullets))
 		// fmt.Printf("New Bullets\tlen: %d\tcap: %d\n\n", len(game.data.newBullets), cap(game.data.newBullets))
 
-		// fmt.Printf("Particles\tlen: %d\tcap: %d\n", len(game.data.particles), cap(game.data.particles))
-		// fmt.Printf("New Particles\tlen: %d\tcap: %d\n\n", len(game.data.newParticles), cap(game.data.newParticles))
+		// fmt.Printf("Particles\tlive: %d\tcap: %d\n\n", game.data.particles.count(), len(game.data.particles.particles))
 
 		game.lastMemCheck = game.lastFrame
 
@@ -62,6 +60,17 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 
 	// update
 	dt := math.Min(time.Since(game.lastFrame).Seconds(), 0.1) * game.timescale()
+	// particle and grid physics are tuned per 60th of a second, this is how many of those the frame took
+	frames := dt * simRate
+
+	// each mode has its own grid
+	if game.grid.theme.name != game.data.gridTheme || game.grid.arena != game.data.arena {
+		game.grid = newWorldGrid(findGridTheme(game.data.gridTheme), game.data.arena)
+	}
+	if game.data.flow.arena != game.data.arena {
+		game.data.flow = NewFlowField(game.data.arena)
+	}
+	game.data.arena.Update(dt)
 	game.totalTime += dt
 	game.lastFrame = time.Now()
 
@@ -85,12 +94,28 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 	playerConfirmed := uiConfirm(win, ui.currJoystick)
 	playerCancelled := uiCancel(win, ui.currJoystick)
 
-	// lerp the camera position towards the player
-	game.CamPos = pixel.Lerp(
-		game.CamPos,
-		player.origin.Scaled(0.75),
-		1-math.Pow(1.0/128, dt),
-	)
+	audio.Update()
+
+	// ease the camera towards the player, pulling back to fit a boss in too
+	framing := []pixel.Vec{player.origin.Scaled(0.75)}
+	if game.data.boss != nil {
+		framing = append(framing, game.data.boss.origin.Scaled(0.75))
+	}
+	game.Camera.Frame(win.Bounds(), dt, framing...)
+	game.Camera.Update(dt)
+	SetListener(game.Camera.Position, game.data.arena.Bounds())
+	game.projection.Update(game.Camera.Position, player.velocity, player.speed, dt)
+	SetMusicIntensity(game.musicIntensity())
+
+	// the arena reacts to the music
+	game.beat = pollMusicEvents()
+	if game.beat.kick {
+		game.grid.ApplyExplosiveForce(30.0+60.0*game.beat.energy, Vector3{game.Camera.Position.X, game.Camera.Position.Y, 0.0}, 500.0)
+	}
+	if game.beat.downbeat {
+		game.musicHueTarget += 0.25
+	}
+	game.musicHue += (game.musicHueTarget - game.musicHue) * (1 - math.Pow(1.0/64, dt))
 
 	if game.state == "main_menu" || game.state == "paused" {
 		if playerConfirmed {
@@ -140,12 +165,46 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 
 			case "Music On":
 				game.music = true
+				audio.SetMuted(musicBus, false)
 				game.PlayGameMusic()
 				PlaySound("menu/confirm")
 			case "Music Off":
 				game.music = false
-				speaker.Clear()
+				audio.SetMuted(musicBus, true)
+				PlaySound("menu/confirm")
+			case "Rhythm Mode On":
+				game.rhythm = true
+				PlaySound("menu/confirm")
+			case "Rhythm Mode Off":
+				game.rhythm = false
+				PlaySound("menu/confirm")
+			case "Camera: Top Down":
+				game.projection = NewProjection("top-down")
+				PlaySound("menu/confirm")
+			case "Camera: Arena Floor":
+				game.projection = NewProjection("floor")
+				PlaySound("menu/confirm")
+			case "Camera: Dynamic":
+				game.projection = NewProjection("dynamic")
+				PlaySound("menu/confirm")
+			case "Colour Palette":
+				cycleElementPalette(1)
+				PlaySound("menu/confirm")
+			case "Element Glyphs On":
+				elementGlyphsOn = true
+				PlaySound("menu/confirm")
+			case "Element Glyphs Off":
+				elementGlyphsOn = false
 				PlaySound("menu/confirm")
+			case "Screen Shake On":
+				screenShakeOn = true
+				PlaySound("menu/confirm")
+			case "Screen Shake Off":
+				screenShakeOn = false
+				PlaySound("menu/confirm")
+
+			default:
+				audio.ToggleMenuOption(game.menu.options[game.menu.selection])
 			}
 		}
 
@@ -173,6 +232,16 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 			}
 			game.lastMenuChoiceTime = time.Now()
 		}
+
+		valueChange := uiChangeValue(win, uiGamePadDir, game.lastFrame, game.lastMenuChoiceTime)
+		if valueChange != 0 && game.menu.options[game.menu.selection] == "Colour Palette" {
+			cycleElementPalette(valueChange)
+			PlaySound("menu/step")
+			game.lastMenuChoiceTime = time.Now()
+		} else if valueChange != 0 && audio.AdjustMenuOption(game.menu.options[game.menu.selection], valueChange) {
+			PlaySound("menu/step")
+			game.lastMenuChoiceTime = time.Now()
+		}
 	}
 
 	if game.state == "start_screen" {
@@ -238,6 +307,13 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 			g_debug = !g_debug
 			game.data.console = !game.data.console
 		}
+		if g_debug && win.JustPressed(pixelgl.KeyG) {
+			game.data.gridTheme = nextGridTheme(game.data.gridTheme)
+		}
+		if g_debug && win.JustPressed(pixelgl.KeyB) {
+			game.data.arena = nextArena(game.data.arena)
+			fmt.Printf("[Arena] %s\n", game.data.arena.name)
+		}
 
 		// player controls
 		if player.alive {
@@ -301,10 +377,7 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 			if (player.target != pixel.Vec{}) {
 				direction = direction.Add(player.origin.To(player.target).Unit())
 				midColor := HSVToColor(3.0, 0.7, 1.0)
-				game.data.newParticles = InlineAppendParticles(
-					game.data.newParticles,
-					NewParticle(player.target.X, player.target.Y, midColor, 32.0, pixel.V(0.5, 1.0), 0.0, randomVector(1), 1.0, "ship"),
-				)
+				game.data.particles.Emit("ship/target", player.target, pixel.ZV, midColor)
 			}
 
 			if win.JoystickPresent(ui.currJoystick) {
@@ -328,7 +401,6 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 					ui.MousePos.X,
 					ui.MousePos.Y,
 					"water",
-					elementWaterColor,
 					expiry,
 				)
 				game.data.newEntities = append(game.data.newEntities, essence)
@@ -339,7 +411,6 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 					ui.MousePos.X,
 					ui.MousePos.Y,
 					"chaos",
-					elementChaosColor,
 					expiry,
 				)
 				game.data.newEntities = append(game.data.newEntities, essence)
@@ -349,7 +420,6 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 					ui.MousePos.X,
 					ui.MousePos.Y,
 					"spirit",
-					elementSpiritColor,
 					expiry,
 				)
 				game.data.newEntities = append(game.data.newEntities, essence)
@@ -359,7 +429,6 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 					ui.MousePos.X,
 					ui.MousePos.Y,
 					"fire",
-					elementFireColor,
 					expiry,
 				)
 				game.data.newEntities = append(game.data.newEntities, essence)
@@ -369,7 +438,6 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 					ui.MousePos.X,
 					ui.MousePos.Y,
 					"lightning",
-					elementLightningColor,
 					expiry,
 				)
 				game.data.newEntities = append(game.data.newEntities, essence)
@@ -379,7 +447,6 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 					ui.MousePos.X,
 					ui.MousePos.Y,
 					"wind",
-					elementWindColor,
 					expiry,
 				)
 				game.data.newEntities = append(game.data.newEntities, essence)
@@ -389,7 +456,6 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 					ui.MousePos.X,
 					ui.MousePos.Y,
 					"life",
-					elementLifeColor,
 					expiry,
 				)
 				game.data.newEntities = append(game.data.newEntities, essence)
@@ -451,6 +517,27 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 				)
 				game.data.newEntities = append(game.data.newEntities, enemy)
 			}
+			if win.JustPressed(pixelgl.KeyT) {
+				enemy := *NewTurret(
+					ui.MousePos.X,
+					ui.MousePos.Y,
+				)
+				game.data.newEntities = append(game.data.newEntities, enemy)
+			}
+			if win.JustPressed(pixelgl.KeyY) {
+				enemy := *NewSniper(
+					ui.MousePos.X,
+					ui.MousePos.Y,
+				)
+				game.data.newEntities = append(game.data.newEntities, enemy)
+			}
+			if win.JustPressed(pixelgl.KeyU) {
+				for i := 0; i < 12; i++ {
+					spawnPos := ui.MousePos.Add(randomVector(48.0))
+					enemy := *NewStarling(spawnPos.X, spawnPos.Y)
+					game.data.newEntities = append(game.data.newEntities, enemy)
+				}
+			}
 
 			total := 16.0
 			step := 360.0 / total
@@ -482,6 +569,9 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 					game.data.newEntities = append(game.data.newEntities, enemy)
 				}
 			}
+			if win.JustPressed(pixelgl.KeyV) && game.data.boss == nil {
+				game.spawnBoss(bossNames[rand.Intn(len(bossNames))])
+			}
 			if win.JustPressed(pixelgl.KeySlash) {
 				for i := 0.0; i < total; i++ {
 					spawnPos := pixel.V(1.0, 0.0).Rotated(i * step * math.Pi / 180.0).Unit().Scaled(400.0 + (rand.Float64()*64 - 32.0)).Add(player.origin)
@@ -498,12 +588,9 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 	if game.state == "playing" || game.state == "game_over" || game.data.mode == "menu" {
 		if game.data.mode == "menu" {
 			if player.target.Len() == 0 || player.origin.To(player.target).Len() < 5.0 {
-				poi := pixel.V(
-					(rand.Float64()*worldWidth)-worldWidth/2.0,
-					(rand.Float64()*worldHeight)-worldHeight/2.0,
-				)
+				poi := game.data.arena.RandomPoint(0)
 				player.target = player.origin.Sub(poi).Unit().Scaled(rand.Float64()*400 + 200)
-				enforceWorldBoundary(&player.target, player.radius*2)
+				player.target = game.data.arena.Clamp(player.target, player.radius*2)
 			}
 			player.orientation = player.orientation.Rotated(60 * math.Pi / 180 * dt).Unit()
 			direction = player.origin.To(player.target).Unit()
@@ -520,7 +607,7 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 			// player.velocity = direction.Unit().Scaled(player.speed)
 
 			// partile stream
-			baseVelocity := orientationDt.Unit().Scaled(-1 * player.speed).Scaled(dt)
+			baseVelocity := orientationDt.Unit().Scaled(-1 * player.speed / simRate)
 			perpVel := pixel.V(baseVelocity.Y, -baseVelocity.X).Scaled(0.2 * math.Sin(game.totalTime*10))
 			hue := math.Mod(((math.Mod(game.totalTime, 16.0) / 16.0) * 6.0), 6.0)
 			hue2 := math.Mod(hue+0.6, 6.0)
@@ -538,25 +625,17 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 
 			vel1 := baseVelocity.Add(perpVel).Add(randomVector((0.2)))
 			vel2 := baseVelocity.Sub(perpVel).Add(randomVector((0.2)))
-			game.data.newParticles = InlineAppendParticles(
-				game.data.newParticles,
-				NewParticle(pos.X, pos.Y, midColor, 32.0, pixel.V(0.5, 1.0), 0.0, baseVelocity, 1.0, "ship"),
-				NewParticle(pos.X, pos.Y, sideColor, 24.0, pixel.V(1.0, 1.0), 0.0, vel1.Scaled(1.5), 1.0, "ship"),
-				NewParticle(pos.X, pos.Y, sideColor, 24.0, pixel.V(1.0, 1.0), 0.0, vel2.Scaled(1.5), 1.0, "ship"),
-				// NewParticle(pos.X, pos.Y, white, 24.0, pixel.V(0.5, 1.0), 0.0, vel1, 1.0, "ship"),
-				// NewParticle(pos.X, pos.Y, white, 24.0, pixel.V(0.5, 1.0), 0.0, vel2, 1.0, "ship"),
-			)
+			game.data.particles.Emit("ship/exhaust", pos, baseVelocity, midColor)
+			game.data.particles.Emit("ship/wake", pos, vel1.Scaled(1.5), sideColor)
+			game.data.particles.Emit("ship/wake", pos, vel2.Scaled(1.5), sideColor)
 
 			if player.speed > 600 {
-				game.data.newParticles = InlineAppendParticles(
-					game.data.newParticles,
-					NewParticle(pos.X, pos.Y, white, 32.0, pixel.V(1.0, 1.0), 0.0, vel1.Add(perpVel), 2.0, "ship"),
-					NewParticle(pos.X, pos.Y, white, 32.0, pixel.V(1.0, 1.0), 0.0, vel2.Sub(perpVel), 2.0, "ship"),
-				)
+				game.data.particles.Emit("ship/boost", pos, vel1.Add(perpVel), white)
+				game.data.particles.Emit("ship/boost", pos, vel2.Sub(perpVel), white)
 			}
 		}
 
-		player.Update(dt, game.totalTime, game.lastFrame)
+		player.Update(dt, game.totalTime, game.lastFrame, game.data.arena)
 
 		aim := player.origin.To(ui.MousePos)
 		gamepadAim := uiThumbstickVector(win, ui.currJoystick, pixelgl.AxisRightX, pixelgl.AxisRightY)
@@ -696,13 +775,13 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 
 				game.data.lastBullet = game.lastFrame
 
-				shotSound := "sound/shoot3.mp3"
+				shotSound := "shoot/single"
 				if game.data.weapon.bulletCount > 2 && game.data.weapon.conicAngle > 0 {
-					shotSound = "sound/shoot-mixed.mp3"
+					shotSound = "shoot/mixed"
 				} else if game.data.weapon.conicAngle > 0 {
-					shotSound = "sound/shoot2.mp3"
+					shotSound = "shoot/conic"
 				} else if game.data.weapon.bulletCount > 3 {
-					shotSound = "sound/shoot.mp3"
+					shotSound = "shoot/burst"
 				}
 
 				PlaySound(shotSound)
@@ -712,6 +791,9 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 
 		// set velocities
 		closestEnemyDist := 1000000.0
+		game.data.flow.Update(player.origin, dt)
+		game.data.neighbours.Rebuild(game.data.entities)
+		game.updateBoss(dt, player)
 		for i, e := range game.data.entities {
 			if !e.alive {
 				continue
@@ -725,88 +807,39 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 				continue
 			}
 
-			dir := pixel.ZV
 			toPlayer := e.origin.To(player.origin)
-			if player.alive {
-				dir = toPlayer.Unit()
-			}
 			if (e.entityType == "blackhole" || e.entityType == "bubble") && toPlayer.Len() < closestEnemyDist {
 				closestEnemyDist = toPlayer.Len()
 			}
-			if e.entityType == "wanderer" {
-				if e.target.Len() == 0 || e.origin.To(e.target).Len() < 5.0 {
-					poi := pixel.V(
-						(rand.Float64()*worldWidth)-worldWidth/2.0,
-						(rand.Float64()*worldHeight)-worldHeight/2.0,
-					)
-					e.target = e.origin.Sub(poi).Unit().Scaled(rand.Float64() * 400)
-				}
+			dir := game.steer(&e, i, player, dt)
+
+			// which way they face, and who shoots, is still up to each type
+			switch e.entityType {
+			case "wanderer":
 				e.orientation = e.orientation.Rotated(60 * math.Pi / 180 * dt).Unit()
-				dir = e.origin.To(e.target).Unit()
-			} else if e.entityType == "dodger" {
-				// https://gamedev.stackexchange.com/questions/109513/how-to-find-if-an-object-is-facing-another-object-given-position-and-direction-a
-				// todo, tidy up and put somewhere
+			case "dodger", "pink":
 				e.orientation = player.origin
-				currentlyDodgingDist := -1.0
-				for _, b := range game.data.bullets {
-					if (len(b.data.elements) > 0 && b.data.elements[0] == "wind") || (len(b.data.elements) > 1 && b.data.elements[1] == "wind") {
-						continue
-					}
-					if !b.data.alive {
-						continue
-					}
-					entToBullet := e.origin.Sub(b.data.origin)
-					if entToBullet.Len() > 200 {
-						continue
-					}
-					entToBullet = entToBullet.Unit()
-					facing := entToBullet.Dot(b.data.orientation.Unit())
-
-					isClosest := (currentlyDodgingDist == -1.0 || entToBullet.Len() < currentlyDodgingDist)
-					if facing > 0.0 && facing > 0.7 && facing < 0.95 && isClosest { // if it's basically dead on, they'll die.
-						currentlyDodgingDist = entToBullet.Len()
-
-						if g_debug {
-							game.debugInfos = append(game.debugInfos, debugInfo{p1: e.origin, p2: b.data.origin})
-						}
-
-						baseVelocity := entToBullet.Unit().Scaled(-4 * game.timescale())
-
-						midColor := pixel.ToRGBA(e.color)
-						pos1 := pixel.V(1, 1).Rotated(e.orientation.Angle()).Scaled(e.radius).Add(e.origin)
-						pos2 := pixel.V(-1, 1).Rotated(e.orientation.Angle()).Scaled(e.radius).Add(e.origin)
-						pos3 := pixel.V(1, -1).Rotated(e.orientation.Angle()).Scaled(e.radius).Add(e.origin)
-						pos4 := pixel.V(-1, -1).Rotated(e.orientation.Angle()).Scaled(e.radius).Add(e.origin)
-						game.data.newParticles = InlineAppendParticles(
-							game.data.newParticles,
-							NewParticle(pos1.X, pos1.Y, midColor, 48.0, pixel.V(0.5, 1.0), 0.0, baseVelocity.Scaled(rand.Float64()*2.0), 1.0, "ship"),
-							NewParticle(pos2.X, pos1.Y, midColor, 48.0, pixel.V(0.5, 1.0), 0.0, baseVelocity.Scaled(rand.Float64()*2.0), 1.0, "ship"),
-							NewParticle(pos3.X, pos1.Y, midColor, 48.0, pixel.V(0.5, 1.0), 0.0, baseVelocity.Scaled(rand.Float64()*2.0), 1.0, "ship"),
-							NewParticle(pos4.X, pos1.Y, midColor, 48.0, pixel.V(0.5, 1.0), 0.0, baseVelocity.Scaled(rand.Float64()*2.0), 1.0, "ship"),
-						)
-
-						dir = e.origin.Sub(b.data.origin).Scaled(4)
-					}
+			case "gate":
+				e.orientation = e.orientation.Rotated(7 * math.Pi / 180 * dt).Unit()
+			case "starling":
+				if e.velocity.Len() > 0 {
+					e.orientation = e.velocity.Unit()
 				}
-			} else if e.entityType == "pink" {
-				e.orientation = player.origin
-			} else if e.entityType == "snek" {
-				t := math.Mod(game.lastFrame.Sub(e.born).Seconds(), 2.0)
-				deg := (math.Sin(t*math.Pi) * e.cone) * math.Pi / 180.0
-				dir = dir.Rotated(deg)
-				if t > 1.9 {
-					e.cone = 60.0 + (rand.Float64() * 90.0)
+			case "turret":
+				e.orientation = toPlayer.Unit()
+				if player.alive && game.lastFrame.Sub(e.lastShot).Seconds() >= turretFireRate &&
+					game.data.arena.LineOfSight(e.origin, player.origin, 0) {
+					game.enemyFire(&e, "turret/shot", toPlayer)
+					e.lastShot = game.lastFrame
 				}
-			} else if e.entityType == "gate" {
-				if e.target.Len() == 0 || e.origin.To(e.target).Len() < 5.0 {
-					poi := pixel.V(
-						(rand.Float64()*worldWidth)-worldWidth/2.0,
-						(rand.Float64()*worldHeight)-worldHeight/2.0,
-					)
-					e.target = e.origin.Sub(poi).Unit().Scaled(rand.Float64() * 400)
+			case "sniper":
+				e.orientation = toPlayer.Unit()
+				if player.alive && game.lastFrame.Sub(e.lastShot).Seconds() >= sniperFireRate {
+					if game.data.arena.LineOfSight(e.origin, player.origin, 0) {
+						game.enemyFire(&e, "sniper/shot", toPlayer)
+					}
+					e.lastShot = game.lastFrame
 				}
-				e.orientation = e.orientation.Rotated(7 * math.Pi / 180 * dt).Unit()
-				dir = e.origin.To(e.target).Unit()
 			}
 			e.Propel(dir, dt)
 
@@ -821,6 +854,7 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 				game.data.bullets[i] = bullet{}
 				continue
 			}
+			b.from = b.data.origin
 			b.data.origin = b.data.origin.Add(b.velocity.Scaled(dt))
 			if game.data.weapon.randomCone == 0 {
 				// if game.data.weapon.bulletCount > 2 {
@@ -853,27 +887,11 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 
 			// emit particles
 			if (uint64(game.totalTime*1000)/125)%2 == 0 {
-				v := 6.0 + (rand.Float64() * 12)
-				sprayVelocity := pixel.V(
+				sprayDirection := pixel.V(
 					math.Cos(b.particleEmissionAngle),
 					math.Sin(b.particleEmissionAngle),
-				).Unit().Scaled(v * game.timescale())
-
-				color := colornames.Lightskyblue
-				pos := b.origin
-				game.data.newParticles = InlineAppendParticles(
-					game.data.newParticles,
-					NewParticle(pos.X,
-						pos.Y,
-						pixel.ToRGBA(color),
-						128.0,
-						pixel.V(1.5, 1.5),
-						0.0,
-						sprayVelocity,
-						2.0,
-						"blackhole",
-					),
 				)
+				game.data.particles.Emit("blackhole/spray", b.origin, sprayDirection, pixel.ToRGBA(colornames.Lightskyblue))
 
 				b.particleEmissionAngle -= math.Pi / 25.0
 			}
@@ -893,31 +911,15 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 				}
 				game.data.entities[bID] = b
 
-				for i := 0; i < 1024; i++ {
-					extra := (1.0 / ((rand.Float64() * 10.0) + 1.0))
-					speed := 32 * (1.0 - extra)
-
-					p := NewParticle(
-						b.origin.X,
-						b.origin.Y,
-						pixel.ToRGBA(colornames.Deepskyblue).Add(pixel.Alpha(extra*3)),
-						64,
-						pixel.V(1.0, 1.0),
-						0.0,
-						randomVector(speed),
-						3.0,
-						"enemy",
-					)
-
-					game.data.newParticles = InlineAppendParticles(game.data.newParticles, p)
-				}
+				game.data.particles.Emit("blackhole/die", b.origin, pixel.ZV, pixel.ToRGBA(colornames.Deepskyblue))
+				game.Camera.Shake(0.4)
 
 				continue
 			}
 
 			maxForce := 2400.0
 
-			game.grid.ApplyImplosiveForce(5+b.radius, Vector3{b.origin.X, b.origin.Y, 0.0}, 50+b.radius)
+			game.grid.ApplyImplosiveForce((5+b.radius)*frames, Vector3{b.origin.X, b.origin.Y, 0.0}, 50+b.radius)
 
 			dist := player.origin.Sub(b.origin)
 			length := dist.Len()
@@ -937,8 +939,8 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 				}
 			}
 
-			for pID, p := range game.data.particles {
-				if p == (particle{}) {
+			for pID, p := range game.data.particles.particles {
+				if !p.alive {
 					continue
 				}
 
@@ -946,12 +948,12 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 				length := dist.Len()
 
 				n := dist.Unit()
-				p.velocity = p.velocity.Add(n.Scaled(10000.0 / ((length * length) + 10000.0)))
+				p.velocity = p.velocity.Add(n.Scaled(10000.0 / ((length * length) + 10000.0) * frames))
 
 				if length < 400 {
-					p.velocity = p.velocity.Add(pixel.V(n.Y, -n.X).Scaled(45 / (length + 250.0)))
+					p.velocity = p.velocity.Add(pixel.V(n.Y, -n.X).Scaled(45 / (length + 250.0) * frames))
 				}
-				game.data.particles[pID] = p
+				game.data.particles.particles[pID] = p
 			}
 
 			for bulletID, bul := range game.data.bullets {
@@ -1018,19 +1020,8 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 		for _, e := range game.data.entities {
 			baseVelocity := e.pullVec.Scaled(0.05)
 
-			if e.pullVec.Len() > 0 && e.color != nil {
-				midColor := pixel.ToRGBA(e.color)
-				pos1 := pixel.V(1, 1).Rotated(e.orientation.Angle()).Scaled(e.radius).Add(e.origin)
-				pos2 := pixel.V(-1, 1).Rotated(e.orientation.Angle()).Scaled(e.radius).Add(e.origin)
-				pos3 := pixel.V(1, -1).Rotated(e.orientation.Angle()).Scaled(e.radius).Add(e.origin)
-				pos4 := pixel.V(-1, -1).Rotated(e.orientation.Angle()).Scaled(e.radius).Add(e.origin)
-				game.data.newParticles = InlineAppendParticles(
-					game.data.newParticles,
-					NewParticle(pos1.X, pos1.Y, midColor, 48.0, pixel.V(0.5, 1.0), 0.0, baseVelocity.Scaled(rand.Float64()*2.0), 1.0, "enemy"),
-					NewParticle(pos2.X, pos1.Y, midColor, 48.0, pixel.V(0.5, 1.0), 0.0, baseVelocity.Scaled(rand.Float64()*2.0), 1.0, "enemy"),
-					NewParticle(pos3.X, pos1.Y, midColor, 48.0, pixel.V(0.5, 1.0), 0.0, baseVelocity.Scaled(rand.Float64()*2.0), 1.0, "enemy"),
-					NewParticle(pos4.X, pos1.Y, midColor, 48.0, pixel.V(0.5, 1.0), 0.0, baseVelocity.Scaled(rand.Float64()*2.0), 1.0, "enemy"),
-				)
+			if e.pullVec.Len() > 0 && e.Colour() != nil {
+				e.EmitWake(game, baseVelocity)
 			}
 		}
 
@@ -1039,10 +1030,10 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 				continue
 			}
 
-			game.grid.ApplyImplosiveForce(3.0, Vector3{e.origin.X, e.origin.Y, 0.0}, 50+e.radius)
+			game.grid.ApplyImplosiveForce(3.0*frames, Vector3{e.origin.X, e.origin.Y, 0.0}, 50+e.radius)
 		}
 
-		game.grid.Update()
+		game.grid.Update(frames)
 
 		// Apply velocities
 		// player.origin = player.origin.Add(player.velocity.Scaled(dt))
@@ -1067,35 +1058,16 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 			// 	}
 			// }
 
-			e.Update(dt, game.totalTime, game.lastFrame)
+			e.Update(dt, game.totalTime, game.lastFrame, game.data.arena)
 			game.data.entities[i] = e
 		}
 
 		// check for collisions
 		if game.data.mode != "story" {
-			player.enforceWorldBoundary(false)
+			player.enforceWorldBoundary(game.data.arena, false)
 		}
 
-		for id, a := range game.data.entities {
-			//tmpTarget.Push(e.origin.Add(e.orientation.Scaled(e.radius)), e.origin.Add(e.orientation.Scaled(-e.radius)))
-			ignoreList := []string{"pinkpleb", "snek", "gate"}
-			if sliceextra.Contains(ignoreList, a.entityType) {
-				continue
-			}
-			for id2, b := range game.data.entities {
-				if id == id2 || sliceextra.Contains(ignoreList, a.entityType) || a.entityType != b.entityType {
-					continue
-				}
-
-				intersection := a.MovementCollisionCircle().Intersect(b.MovementCollisionCircle())
-				if intersection.Radius > 0 {
-					a.origin = a.origin.Add(
-						b.origin.To(a.origin).Unit().Scaled(intersection.Radius * dt),
-					)
-					game.data.entities[id] = a
-				}
-			}
-		}
+		game.separateEnemies(dt)
 
 		for bID, b := range game.data.bullets {
 			if b.data.alive && (b.data.expiry == time.Time{} || b.data.expiry.After(game.lastFrame)) {
@@ -1112,14 +1084,7 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 						)
 
 						if e.entityType == "blackhole" {
-							hitSound := blackholeHitBuffer.Streamer(0, blackholeHitBuffer.Len())
-							volume := &effects.Volume{
-								Streamer: hitSound,
-								Base:     10,
-								Volume:   -0.9,
-								Silent:   false,
-							}
-							speaker.Play(volume)
+							PlaySoundAt("blackhole/hit", e.origin)
 						}
 						e.DealDamage(
 							&b.data,
@@ -1142,23 +1107,17 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 						}
 					}
 				}
-				if !pixel.R(-worldWidth/2, -worldHeight/2, worldWidth/2, worldHeight/2).Contains(b.data.origin) {
+				if b.data.alive && game.hitBoss(&b) {
+					b.data.alive = false
+					game.data.bullets[bID] = b
+				}
+				if b.data.alive && game.bulletHitObstacle(&b) {
+					game.data.bullets[bID] = b
+				}
+				if !game.data.arena.Contains(b.data.origin) {
 
 					// explode bullets when they hit the edge
-					for i := 0; i < 30; i++ {
-						p := NewParticle(
-							b.data.origin.X,
-							b.data.origin.Y,
-							pixel.ToRGBA(colornames.Lightblue),
-							32,
-							pixel.V(1.0, 1.0),
-							0.0,
-							randomVector(5.0),
-							1.0,
-							"bullet",
-						)
-						game.data.newParticles = InlineAppendParticles(game.data.newParticles, p)
-					}
+					game.data.particles.Emit("bullet/edge", b.data.origin, pixel.ZV, pixel.ToRGBA(colornames.Lightblue))
 
 					b.data.alive = false
 					game.data.bullets[bID] = b
@@ -1166,6 +1125,8 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 			}
 		}
 
+		game.updateProjectiles(dt, player)
+
 		for eID, e := range game.data.entities {
 			intersectionTest := e.Circle().Intersect(player.Circle()).Radius > 0
 
@@ -1291,34 +1252,19 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 		bombPressed := win.Pressed(pixelgl.KeySpace) || win.JoystickAxis(ui.currJoystick, pixelgl.AxisRightTrigger) > 0.1
 		// game.data.bombs > 0 &&
 		// droppping bomb concept for the moment
-		if bombPressed && game.lastFrame.Sub(game.data.lastBomb).Seconds() > 2.0 {
+		if bombPressed && game.lastFrame.Sub(game.data.lastBomb).Seconds() > bombCooldown {
 			if len(player.elements) > 0 {
 				game.grid.ApplyExplosiveForce(256.0, Vector3{player.origin.X, player.origin.Y, 0.0}, 256.0)
-				sound := bombBuffer.Streamer(0, bombBuffer.Len())
-				volume := &effects.Volume{
-					Streamer: sound,
-					Base:     10,
-					Volume:   0.7,
-					Silent:   false,
-				}
-				speaker.Play(volume)
-
-				for i := 0; i < 1000; i++ {
-					speed := 48.0 * (1.0 - 1/((rand.Float64()*32.0)+1))
-					col := int(rand.Float32() * float32(len(player.elements)))
-					p := NewParticle(
-						player.origin.X,
-						player.origin.Y,
-						pixel.ToRGBA(elements[player.elements[col]]),
-						100,
-						pixel.V(1.5, 1.5),
-						0.0,
-						randomVector(speed),
-						2.0,
-						"player",
-					)
-					game.data.newParticles = InlineAppendParticles(game.data.newParticles, p)
+				PlaySoundAt("player/bomb", player.origin)
+				audio.Duck(0.6)
+				game.Camera.Shake(0.6)
+				game.Camera.PulseZoom(0.08)
+
+				colours := make([]pixel.RGBA, len(player.elements))
+				for i, element := range player.elements {
+					colours[i] = pixel.ToRGBA(elementColour(element))
 				}
+				game.data.particles.Emit("player/bomb", player.origin, pixel.ZV, colours...)
 
 				game.data.lastBomb = time.Now()
 
@@ -1338,68 +1284,8 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 			}
 		}
 
-		// Keep buffered particles ticking so they don't stack up too much
-		for pID, p := range game.data.newParticles {
-			p.percentLife -= 1.0 / p.duration * game.timescale()
-			game.data.newParticles[pID] = p
-		}
-		for pID, p := range game.data.particles {
-			if p != (particle{}) {
-				p.origin = p.origin.Add(p.velocity)
-
-				minX := -worldWidth / 2
-				minY := -worldHeight / 2
-				maxX := worldWidth / 2
-				maxY := worldHeight / 2
-				// collide with the edges of the screen
-				if p.origin.X < minX {
-					p.origin.X = minX
-					p.velocity.X = math.Abs(p.velocity.X)
-				} else if p.origin.X > maxX {
-					p.origin.X = maxX
-					p.velocity.X = -math.Abs(p.velocity.X)
-				}
-				if p.origin.Y < minY {
-					p.origin.Y = minY
-					p.velocity.Y = math.Abs(p.velocity.Y)
-				} else if p.origin.Y > maxY {
-					p.origin.Y = maxY
-					p.velocity.Y = -math.Abs(p.velocity.Y)
-				}
-
-				p.orientation = p.velocity.Angle()
-
-				p.percentLife -= 1.0 / p.duration * game.timescale()
-
-				speed := p.velocity.Len()
-				alpha := math.Min(1, math.Min(p.percentLife*2, speed*1.0))
-				alpha *= alpha
-				p.colour.A = alpha
-				p.scale.X = p.lengthMultiplier * math.Min(math.Min(1.0, 0.2*speed+0.1), alpha)
-
-				if math.Abs(p.velocity.X)+math.Abs(p.velocity.Y) < 0.00000001 {
-					p.velocity = pixel.ZV
-				}
-
-				p.velocity = p.velocity.Scaled(0.97)
-
-				game.data.particles[pID] = p
-			}
-		}
+		game.data.particles.Update(frames, game.data.arena)
 
-		// kill particles
-		killedParticles := 0
-		for particleID, existing := range game.data.newParticles {
-			if (existing != particle{}) && existing.percentLife <= 0 {
-				game.data.newParticles[particleID] = particle{}
-			}
-		}
-		for particleID, existing := range game.data.particles {
-			if (existing != particle{}) && existing.percentLife <= 0 {
-				game.data.particles[particleID] = particle{}
-				killedParticles++
-			}
-		}
 		killedEnt := 0
 		for entID, existing := range game.data.entities {
 			died := (!existing.alive && existing.born != time.Time{})
@@ -1414,28 +1300,6 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 		// 	fmt.Printf("Killed\t(%d entities)\n", killedEnt)
 		// }
 
-		particleID := 0
-		for addedID, newParticle := range game.data.newParticles {
-			if newParticle == (particle{}) {
-				continue
-			}
-
-			if len(game.data.particles) < cap(game.data.particles) {
-				game.data.particles = append(game.data.particles, newParticle)
-				game.data.newParticles[addedID] = particle{}
-			} else {
-				for particleID < len(game.data.particles) {
-					existing := game.data.particles[particleID]
-					if existing == (particle{}) {
-						game.data.particles[particleID] = newParticle
-						game.data.newParticles[addedID] = particle{}
-						break
-					}
-					particleID++
-				}
-			}
-		}
-
 		entID := 0
 		toSpawn := 0
 		spawnedEnt := 0
@@ -1478,6 +1342,8 @@ func UpdateGame(win *pixelgl.Window, game *game, ui *uiContext) {
 			game.developmentGameModeUpdate(g_debug, game.lastFrame, game.totalTime, player)
 		} else if game.data.mode == "pacifism" {
 			game.pacifismGameModeUpdate(g_debug, game.lastFrame, game.totalTime, player)
+		} else if game.data.mode == "story" {
+			game.storyGameModeUpdate(&chapter1)
 		}
 	}
 
@@ -6,18 +6,26 @@ import (
 	"math/rand"
 	"time"
 
-	"github.com/faiface/beep/effects"
-	"github.com/faiface/beep/speaker"
 	"github.com/faiface/pixel"
 )
 
 const maxParticles = 5000
+const maxProjectiles = 512
 
 type menu struct {
 	selection int
 	options   []string
 }
 
+// banner is a short announcement shown across the top of the HUD
+type banner struct {
+	text  string
+	start time.Time
+}
+
+// How long a banner stays up for
+const bannerDuration = 2.5
+
 type wavedata struct {
 	waveDuration float64
 	waveStart    time.Time
@@ -45,17 +53,22 @@ type gamedata struct {
 	camPos pixel.Vec
 
 	mode            string
+	gridTheme       string
 	lives           int
 	bombs           int
 	scoreMultiplier int
 	landingPartyR   float64
-
-	entities     []entityData
-	bullets      []bullet
-	particles    []particle
-	newEntities  []entityData
-	newParticles []particle
-	newBullets   []bullet
+	arena           *Arena
+	flow            *flowField // how enemies get around the arena's obstacles
+	neighbours      *neighbourhood
+
+	entities    []entityData
+	bullets     []bullet
+	particles   *particlePool
+	projectiles *projectilePool // what enemies shoot
+	newEntities []entityData
+	newBullets  []bullet
+	boss        *boss
 
 	spawns         int
 	spawnCount     int
@@ -76,6 +89,10 @@ type gamedata struct {
 	landingPartyFreq  float64
 	ambientSpawnFreq  float64
 	notoriety         float64
+	nextBoss          float64   // the notoriety the next boss turns up at
+	storyPage         int       // which page of the chapter is up
+	storyPageStart    time.Time // when it went up
+	chapterBossFought bool
 	timescale         float64
 	spawning          bool
 
@@ -86,6 +103,8 @@ type gamedata struct {
 	lastWave          time.Time
 	lastWeaponUpgrade time.Time
 
+	banners []banner
+
 	console bool
 }
 
@@ -102,7 +121,8 @@ type game struct {
 	menu      menu
 	grid      grid
 
-	CamPos pixel.Vec
+	Camera     Camera
+	projection projection // the 3D view of the grid
 
 	// Frame state
 	lastFrame          time.Time
@@ -112,7 +132,13 @@ type game struct {
 	debugInfos         []debugInfo
 	globalTimeScale    float64
 
-	music bool
+	music  bool
+	rhythm bool // waves land on the downbeat
+
+	// what the music is doing, for things that react to it
+	beat           musicEvents
+	musicHue       float64
+	musicHueTarget float64
 }
 
 // Menus
@@ -126,6 +152,20 @@ var implementedMenuItems = []string{
 	"Main Menu",
 	"Music On",
 	"Music Off",
+	"Rhythm Mode On",
+	"Rhythm Mode Off",
+	"Camera: Top Down",
+	"Camera: Arena Floor",
+	"Camera: Dynamic",
+	"Colour Palette",
+	"Element Glyphs On",
+	"Element Glyphs Off",
+	"Screen Shake On",
+	"Screen Shake Off",
+	"Master Volume",
+	"Music Volume",
+	"Effects Volume",
+	"Menu Volume",
 	"Fullscreen (1080p)",
 	"Windowed (1024x768)",
 	"Back",
@@ -163,8 +203,22 @@ func NewOptionsMenu() menu {
 		options: []string{
 			"Fullscreen (1080p)",
 			"Windowed (1024x768)",
+			"Master Volume",
+			"Music Volume",
+			"Effects Volume",
+			"Menu Volume",
 			"Music Off",
 			"Music On",
+			"Rhythm Mode On",
+			"Rhythm Mode Off",
+			"Camera: Top Down",
+			"Camera: Arena Floor",
+			"Camera: Dynamic",
+			"Colour Palette",
+			"Element Glyphs On",
+			"Element Glyphs Off",
+			"Screen Shake On",
+			"Screen Shake Off",
 			"Back",
 		},
 	}
@@ -225,17 +279,21 @@ func NewGameData() *gamedata {
 	gameData := new(gamedata)
 
 	gameData.mode = "none"
+	gameData.gridTheme = "classic"
 	gameData.lives = 500
 	gameData.bombs = 3
 	gameData.scoreMultiplier = 1
 	gameData.landingPartyR = 0.0
+	gameData.arena = NewDefaultArena()
+	gameData.flow = NewFlowField(gameData.arena)
+	gameData.neighbours = NewNeighbourhood()
 
 	gameData.entities = make([]entityData, 0, 200)
 	gameData.bullets = make([]bullet, 0, 500)
-	gameData.particles = make([]particle, 0, maxParticles)
+	gameData.particles = NewParticlePool(maxParticles)
+	gameData.projectiles = NewProjectilePool(maxProjectiles)
 	gameData.newEntities = make([]entityData, 0, 200)
 	gameData.newBullets = make([]bullet, 0, 500)
-	gameData.newParticles = make([]particle, 0, 1000)
 
 	gameData.player = *NewPlayer(0.0, 0.0)
 	gameData.spawns = 0
@@ -247,6 +305,7 @@ func NewGameData() *gamedata {
 	gameData.score = 0
 	gameData.kills = 0
 	gameData.notoriety = 0.0 // brings new enemy types into ambient spawning gradually
+	gameData.nextBoss = bossNotorietyStep
 	gameData.spawning = true
 	gameData.lastSpawn = time.Now()
 	gameData.lastBullet = time.Now()
@@ -308,6 +367,7 @@ func NewEvolvedGame() *gamedata {
 func NewDevelopmentGame() *gamedata {
 	data := NewGameData()
 	data.mode = "development"
+	data.gridTheme = "vortex"
 	data.weapon = *NewWeaponData()
 	data.lives = 100
 	data.multiplierReward = 25 // kills
@@ -323,38 +383,52 @@ func NewDevelopmentGame() *gamedata {
 func NewPacifismGame() *gamedata {
 	data := NewGameData()
 	data.mode = "pacifism"
+	data.gridTheme = "honeycomb"
 	data.lives = 1
 	data.spawnCount = 3
 	data.ambientSpawnFreq = 2 // ambient spawning can be toggled off temporarily, but is otherwise always going on
 	return data
 }
 
+// newWorldGrid covers the arena, with a bit spare past the edges
+func newWorldGrid(theme gridTheme, arena *Arena) grid {
+	maxGridPoints := 2048.0
+	buffer := 256.0
+	bounds := arena.Bounds()
+	gridSpacing := math.Sqrt(bounds.W() * bounds.H() / maxGridPoints)
+	g := NewGrid(
+		pixel.R(
+			bounds.Min.X-buffer,
+			bounds.Min.Y-buffer,
+			bounds.Max.X+buffer,
+			bounds.Max.Y+buffer,
+		),
+		pixel.V(
+			gridSpacing,
+			gridSpacing,
+		),
+		theme,
+	)
+	g.arena = arena
+	if len(arena.obstacles) > 0 {
+		g.pin(arena.Fixed)
+	}
+	return g
+}
+
 func NewGame(data LocalData) *game {
 	game := new(game)
 	game.localData = data
 	game.state = "main_menu"
 	game.data = *NewMenuGame()
 	game.menu = NewMainMenu()
-	game.CamPos = pixel.ZV
+	game.Camera = NewCamera()
+	game.projection = NewProjection("top-down")
 	game.lastFrame = time.Now()
 	game.lastMenuChoiceTime = time.Now()
 	game.lastMemCheck = time.Now()
 
-	maxGridPoints := 2048.0
-	buffer := 256.0
-	gridSpacing := math.Sqrt(worldWidth * worldHeight / maxGridPoints)
-	game.grid = NewGrid(
-		pixel.R(
-			-worldWidth/2-buffer,
-			-worldHeight/2-buffer,
-			worldWidth/2+buffer,
-			worldHeight/2+buffer,
-		),
-		pixel.V(
-			gridSpacing,
-			gridSpacing,
-		),
-	)
+	game.grid = newWorldGrid(findGridTheme(game.data.gridTheme), game.data.arena)
 
 	game.totalTime = 0.0
 	game.debugInfos = []debugInfo{}
@@ -366,6 +440,37 @@ func NewGame(data LocalData) *game {
 	return game
 }
 
+// How likely a wave is to bring in a landing party of turrets and snipers too, at full notoriety
+const shooterPartyChance = 0.15
+
+// shooterLandingParty digs turrets in around the player, with a couple of snipers circling further out
+func (game *game) shooterLandingParty(player *entityData, corners [4]pixel.Vec) {
+	total := 3.0
+	step := 360.0 / total
+	offset := rand.Float64() * step
+	for i := 0.0; i < total; i++ {
+		spawnPos := pixel.V(1.0, 0.0).Rotated((offset + i*step) * math.Pi / 180.0).Scaled(350.0).Add(player.origin)
+		spawnPos = game.data.arena.Clamp(spawnPos, 80)
+		game.data.newEntities = InlineAppendEntities(game.data.newEntities, *NewTurret(spawnPos.X, spawnPos.Y))
+	}
+	for _, corner := range []pixel.Vec{corners[0], corners[3]} {
+		game.data.newEntities = InlineAppendEntities(game.data.newEntities, *NewSniper(corner.X, corner.Y))
+	}
+}
+
+// How likely a wave is to bring in a couple of flocks of starlings too, at full notoriety
+const starlingPartyChance = 0.15
+
+// starlingLandingParty sends in a flock from each of two corners
+func (game *game) starlingLandingParty(corners [4]pixel.Vec) {
+	for _, corner := range []pixel.Vec{corners[1], corners[2]} {
+		for i := 0; i < 10; i++ {
+			spawnPos := corner.Add(randomVector(48.0))
+			game.data.newEntities = InlineAppendEntities(game.data.newEntities, *NewStarling(spawnPos.X, spawnPos.Y))
+		}
+	}
+}
+
 func FireBullet(aim pixel.Vec, game *game, origin pixel.Vec, player *entityData) {
 	width := float64(game.data.weapon.bulletCount) * 5.0
 	rad := math.Atan2(aim.Unit().Y, aim.Unit().X)
@@ -403,13 +508,29 @@ func (data *gamedata) respawnPlayer() {
 	for bullID, _ := range data.bullets {
 		data.bullets[bullID] = bullet{}
 	}
+	data.projectiles.Clear()
 	data.player = *NewPlayer(0.0, 0.0)
+	if data.boss != nil {
+		// the boss sticks around, but backs off to give the player a moment
+		data.boss.regroup(data.arena, data.player.origin)
+	}
 	data.weapon = *NewWeaponData()
 	data.scoreMultiplier = 1
 	data.scoreSinceBorn = 0
 	data.killsSinceBorn = 0
 }
 
+// Announce puts up a banner, and takes down any that have finished
+func (data *gamedata) Announce(text string, now time.Time) {
+	current := data.banners[:0]
+	for _, b := range data.banners {
+		if now.Sub(b.start).Seconds() < bannerDuration {
+			current = append(current, b)
+		}
+	}
+	data.banners = append(current, banner{text: text, start: now})
+}
+
 func (data *gamedata) AmbientSpawnFreq() float64 {
 	return data.ambientSpawnFreq / data.timescale
 }
@@ -424,31 +545,63 @@ func (game *game) PlayGameMusic() {
 	}
 }
 
+// musicIntensity is how hectic things are, from 0 to 1, for the adaptive music
+func (game *game) musicIntensity() float64 {
+	if game.state != "playing" {
+		return 0.0
+	}
+
+	enemies := 0
+	blackholes := 0
+	for _, e := range game.data.entities {
+		if !e.alive || e.entityType == "essence" {
+			continue
+		}
+		enemies++
+		if e.entityType == "blackhole" && e.active {
+			blackholes++
+		}
+	}
+
+	intensity := math.Min(float64(enemies)/80.0, 0.4)
+	intensity += float64(game.data.scoreMultiplier-1) / 9.0 * 0.3
+	intensity += math.Min(float64(blackholes)*0.1, 0.2)
+
+	// close to death: on the last life, or something nasty is slowing time down
+	if game.data.lives <= 1 || game.data.timescale < 0.75 {
+		intensity += 0.3
+	}
+
+	return math.Min(intensity, 1.0)
+}
+
 func (game *game) developmentGameModeUpdate(debug bool, last time.Time, totalTime float64, player *entityData) {
 
 }
 
 func (game *game) evolvedGameModeUpdate(debug bool, last time.Time, totalTime float64, player *entityData) {
-	updateMusic(game.data.mode)
-
 	if !game.data.player.alive {
 		return
 	}
+	// bosses turn up at notoriety milestones, and everything else holds off while one's about
+	if game.data.mode == "evolved" && game.data.boss == nil && game.data.notoriety >= game.data.nextBoss {
+		milestone := int(game.data.nextBoss/bossNotorietyStep) - 1
+		game.spawnBoss(bossNames[milestone%len(bossNames)])
+		game.data.nextBoss += bossNotorietyStep
+	}
+	if game.data.boss != nil {
+		game.data.notoriety = float64(game.data.kills) / 100.0
+		return
+	}
 	// ambient spawns
 	// This spawns between 1 and 4 enemies every AmbientSpawnFreq seconds
 	if last.Sub(game.data.lastSpawn).Seconds() > game.data.AmbientSpawnFreq() && game.data.spawning {
 		// spawn
 		for i := 0; i < game.data.spawnCount; i++ {
-			pos := pixel.V(
-				float64(rand.Intn(worldWidth)-worldWidth/2),
-				float64(rand.Intn(worldHeight)-worldHeight/2),
-			)
-			// to regulate distance from player
-			for pos.Sub(player.origin).Len() < 450 {
-				pos = pixel.V(
-					float64(rand.Intn(worldWidth)-worldWidth/2),
-					float64(rand.Intn(worldHeight)-worldHeight/2),
-				)
+			pos := game.data.arena.RandomPoint(0)
+			// to regulate distance from player, as best the arena allows
+			for tries := 0; pos.Sub(player.origin).Len() < 450 && tries < 32; tries++ {
+				pos = game.data.arena.RandomPoint(0)
 			}
 
 			var enemy entityData
@@ -495,8 +648,11 @@ func (game *game) evolvedGameModeUpdate(debug bool, last time.Time, totalTime fl
 	subsequentWave := (game.data.lastWave != (time.Time{}) &&
 		(last.Sub(game.data.lastWave).Seconds() >= game.data.WaveFreq()) || waveDead)
 
+	// in rhythm mode waves hold off until the next downbeat, unless there's no music to follow
+	onBeat := !game.rhythm || !game.beat.tracking || game.beat.downbeat
+
 	// waves happen every waveFreq seconds
-	if firstWave || subsequentWave {
+	if (firstWave || subsequentWave) && onBeat {
 		// New wave, so re-assess wave frequency etc in case it was set by a custom wave
 		game.data.ambientSpawnFreq = math.Max(
 			1.0,
@@ -507,12 +663,7 @@ func (game *game) evolvedGameModeUpdate(debug bool, last time.Time, totalTime fl
 		)
 
 		game.data.spawning = false
-		corners := [4]pixel.Vec{
-			pixel.V(-(worldWidth/2)+80, -(worldHeight/2)+80),
-			pixel.V(-(worldWidth/2)+80, (worldHeight/2)-80),
-			pixel.V((worldWidth/2)-80, -(worldHeight/2)+80),
-			pixel.V((worldWidth/2)-80, (worldHeight/2)-80),
-		}
+		corners := game.data.arena.Corners(80)
 
 		if (rand.Float64() * (0.1 + math.Min(game.data.notoriety, 0.8))) > 0.5 {
 			game.data.spawning = true
@@ -699,6 +850,20 @@ func (game *game) evolvedGameModeUpdate(debug bool, last time.Time, totalTime fl
 				}
 			}
 		}
+		landed := r > 0.1
+
+		// shooters and starlings get rolls of their own, on top of whatever else landed, so they don't eat into the rest
+		if rand.Float64() < shooterPartyChance*math.Min(game.data.notoriety, 1.0) {
+			game.shooterLandingParty(player, corners)
+			landed = true
+		}
+		if rand.Float64() < starlingPartyChance*math.Min(game.data.notoriety, 1.0) {
+			game.starlingLandingParty(corners)
+			landed = true
+		}
+		if landed {
+			game.data.Announce("Landing party incoming", last)
+		}
 
 		game.data.lastWave = last
 	}
@@ -725,12 +890,7 @@ func (game *game) evolvedGameModeUpdate(debug bool, last time.Time, totalTime fl
 
 			if last.Sub(wave.lastSpawn).Seconds() > wave.spawnFreq {
 				// 4 spawn points
-				points := [4]pixel.Vec{
-					pixel.V(-(worldWidth/2)+32, -(worldHeight/2)+32),
-					pixel.V(-(worldWidth/2)+32, (worldHeight/2)-32),
-					pixel.V((worldWidth/2)-32, -(worldHeight/2)+32),
-					pixel.V((worldWidth/2)-32, (worldHeight/2)-32),
-				}
+				points := game.data.arena.Corners(32)
 
 				for _, p := range points {
 					var enemy *entityData
@@ -786,33 +946,21 @@ func (game *game) evolvedGameModeUpdate(debug bool, last time.Time, totalTime fl
 	if game.data.score >= game.data.lifeReward {
 		game.data.lifeReward += game.data.lifeReward
 		game.data.lives++
-		sound := lifeBuffer.Streamer(0, lifeBuffer.Len())
-		volume := &effects.Volume{
-			Streamer: sound,
-			Base:     10,
-			Volume:   -0.9,
-			Silent:   false,
-		}
-		speaker.Play(volume)
+		PlaySound("player/life")
+		game.data.Announce("Extra life", game.lastFrame)
 	}
 
 	if game.data.score >= game.data.bombReward {
 		game.data.bombReward += game.data.bombReward
 		game.data.bombs++
+		game.data.Announce("Extra bomb", game.lastFrame)
 	}
 
 	if game.data.killsSinceBorn >= game.data.multiplierReward && game.data.scoreMultiplier < 10 {
 		game.data.scoreMultiplier++
 		game.data.multiplierReward *= 2
-		buffer := multiplierSounds[game.data.scoreMultiplier]
-		sound := buffer.Streamer(0, buffer.Len())
-		volume := &effects.Volume{
-			Streamer: sound,
-			Base:     10,
-			Volume:   -1.0,
-			Silent:   false,
-		}
-		speaker.Play(volume)
+		PlaySound(fmt.Sprintf("multiplier/%d", game.data.scoreMultiplier))
+		game.data.Announce(fmt.Sprintf("Multiplier x%d", game.data.scoreMultiplier), game.lastFrame)
 	}
 
 	// weapon upgrading doesn't seem relevant anymore
@@ -834,12 +982,7 @@ func (game *game) pacifismGameModeUpdate(debug bool, last time.Time, totalTime f
 	// ambient spawns
 	if last.Sub(game.data.lastSpawn).Seconds() > game.data.AmbientSpawnFreq() && game.data.spawning {
 		// spawn
-		corners := [4]pixel.Vec{
-			pixel.V(-(worldWidth/2)+160, -(worldHeight/2)+160),
-			pixel.V(-(worldWidth/2)+160, (worldHeight/2)-160),
-			pixel.V((worldWidth/2)-160, -(worldHeight/2)+160),
-			pixel.V((worldWidth/2)-160, (worldHeight/2)-160),
-		}
+		corners := game.data.arena.Corners(160)
 
 		pos := corners[rand.Intn(4)]
 		// to regulate distance from player
@@ -857,16 +1000,10 @@ func (game *game) pacifismGameModeUpdate(debug bool, last time.Time, totalTime f
 			gateCount = 1
 		}
 		for i := 0; i < gateCount; i++ {
-			pos = pixel.V(
-				float64(rand.Intn(worldWidth)-worldWidth/2),
-				float64(rand.Intn(worldHeight)-worldHeight/2),
-			)
-			// to regulate distance from player
-			for pos.Sub(player.origin).Len() < 350 {
-				pos = pixel.V(
-					float64(rand.Intn(worldWidth)-worldWidth/2),
-					float64(rand.Intn(worldHeight)-worldHeight/2),
-				)
+			pos = game.data.arena.RandomPoint(0)
+			// to regulate distance from player, as best the arena allows
+			for tries := 0; pos.Sub(player.origin).Len() < 350 && tries < 32; tries++ {
+				pos = game.data.arena.RandomPoint(0)
 			}
 			game.data.newEntities = InlineAppendEntities(game.data.newEntities, *NewGate(pos.X, pos.Y))
 		}
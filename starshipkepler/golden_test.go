@@ -0,0 +1,335 @@
+package starshipkepler
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/text"
+	"golang.org/x/image/font/basicfont"
+)
+
+// goldenScene is a scripted moment of play. It's drawn with the software renderer and compared
+// against a PNG of how it looked when it was last known to be right.
+type goldenScene struct {
+	name  string
+	setup func(game *game)
+}
+
+// Everything in a scene happens relative to this, so the clock can't change how it looks
+var goldenEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// How far a pixel can be off before it counts as different, and how many can be different
+const goldenChannelTolerance = 3
+const goldenPixelTolerance = 0.001
+
+var goldenScenes = []goldenScene{
+	{"empty-arena", func(game *game) {}},
+	{"grid-explosion", func(game *game) {
+		game.grid.ApplyExplosiveForce(200, Vector3{-300, 100, 0}, 400)
+		game.grid.ApplyImplosiveForce(150, Vector3{400, -200, 0}, 300)
+		for i := 0; i < 20; i++ {
+			game.grid.Update(1.0)
+		}
+	}},
+	{"floor-shards", func(game *game) {
+		game.data.gridTheme = "shards"
+		game.grid = newWorldGrid(findGridTheme(game.data.gridTheme), game.data.arena)
+		game.projection = NewProjection("floor")
+		game.grid.ApplyDirectedForce(Vector3{0, 0, 600}, Vector3{0, 0, 0}, 300)
+		for i := 0; i < 10; i++ {
+			game.grid.Update(1.0)
+		}
+	}},
+	{"particles", func(game *game) {
+		game.data.particles.Emit("entity/die", pixel.V(-200, 0), pixel.ZV)
+		game.data.particles.Emit("bullet/edge", pixel.V(250, 150), pixel.ZV, pixel.ToRGBA(elementFireColor))
+		game.data.particles.Emit("spray", pixel.V(200, -200), pixel.V(4, 4))
+		for i := 0; i < 12; i++ {
+			game.data.particles.Update(1.0, game.data.arena)
+		}
+	}},
+	{"enemies", func(game *game) {
+		game.data.player.alive = false
+		spawns := []*entityData{
+			NewWanderer(-600, 200), NewFollower(-400, 200), NewDodger(-200, 200), NewPinkSquare(0, 200),
+			NewPinkPleb(200, 200), NewSnek(400, 200), NewAngryBubble(600, 200),
+			NewBlackHole(-400, -200), NewReplicator(-200, -200), NewGate(100, -200),
+			NewEssence(400, -200, "fire", goldenEpoch.Add(time.Second)),
+		}
+		for _, e := range spawns {
+			goldenSettle(e)
+			game.data.entities = append(game.data.entities, *e)
+		}
+
+		active := NewBlackHole(600, -200)
+		goldenSettle(active)
+		active.active = true
+		game.data.entities = append(game.data.entities, *active)
+	}},
+	{"player-wards", func(game *game) {
+		game.data.player.orientation = pixel.V(1, 1).Unit()
+		game.data.player.relativeTarget = pixel.V(1, 0)
+		game.data.player.elements = []string{"fire", "water"}
+		FireBullet(pixel.V(1, 0), game, game.data.player.origin, &game.data.player)
+		for _, b := range game.data.newBullets {
+			b.data.born = goldenEpoch.Add(-100 * time.Millisecond)
+			b.data.origin = b.data.origin.Add(b.data.orientation.Scaled(80))
+			game.data.bullets = append(game.data.bullets, b)
+		}
+	}},
+	{"bounties", func(game *game) {
+		game.data.scoreMultiplier = 4
+		for i, entityType := range []func(float64, float64) *entityData{NewWanderer, NewFollower, NewSnek} {
+			e := entityType(float64(i-1)*300, 150)
+			e.alive = false
+			e.death = goldenEpoch.Add(-100 * time.Millisecond)
+			e.expiry = goldenEpoch.Add(time.Duration(100*i) * time.Millisecond)
+			game.data.entities = append(game.data.entities, *e)
+		}
+	}},
+	{"camera-framing", func(game *game) {
+		game.data.entities = append(game.data.entities, *NewFollower(-700, 450), *NewDodger(650, -400))
+		for i := 0; i < 120; i++ {
+			game.Camera.Frame(pixel.R(0, 0, worldWidth, worldHeight), 1.0/60, pixel.V(-700, 450), pixel.V(650, -400))
+		}
+		game.Camera.Rotation = 0.1
+	}},
+	{"circle-arena", func(game *game) {
+		game.data.arena = NewArena("circle")
+		game.grid = newWorldGrid(findGridTheme(game.data.gridTheme), game.data.arena)
+		game.grid.ApplyExplosiveForce(200, Vector3{400, 300, 0}, 400)
+		for i := 0; i < 20; i++ {
+			game.grid.Update(1.0)
+		}
+	}},
+	{"octagon-arena", func(game *game) {
+		game.data.arena = NewArena("octagon")
+		game.data.gridTheme = "honeycomb"
+		game.grid = newWorldGrid(findGridTheme(game.data.gridTheme), game.data.arena)
+		game.data.particles.Emit("entity/die", pixel.V(560, 160), pixel.ZV)
+		for i := 0; i < 12; i++ {
+			game.data.particles.Update(1.0, game.data.arena)
+		}
+	}},
+	{"pillars-arena", func(game *game) {
+		game.data.arena = NewArena("pillars")
+		game.grid = newWorldGrid(findGridTheme(game.data.gridTheme), game.data.arena)
+		game.grid.ApplyExplosiveForce(200, Vector3{-300, -100, 0}, 400)
+		game.data.particles.Emit("entity/die", pixel.V(-380, -120), pixel.ZV)
+		for i := 0; i < 12; i++ {
+			game.grid.Update(1.0)
+			game.data.particles.Update(1.0, game.data.arena)
+		}
+	}},
+	{"windmill-arena", func(game *game) {
+		game.data.arena = NewArena("windmill")
+		game.data.arena.Update(1.0)
+		game.grid = newWorldGrid(findGridTheme(game.data.gridTheme), game.data.arena)
+		follower := NewFollower(-350, 300)
+		goldenSettle(follower)
+		game.data.entities = append(game.data.entities, *follower)
+	}},
+	{"boss-slam", func(game *game) {
+		b := NewBoss("warden", 400, 0)
+		b.spawning = 0
+		b.angle = 0.3
+		b.segments[1].hp = 0
+		b.segments[2].hp = 10
+		b.segments[3].flash = bossHitFlash
+		b.attack = "slam"
+		b.attackTime = 0.9
+		game.data.boss = b
+	}},
+	{"boss-charge", func(game *game) {
+		b := NewBoss("hydra", -300, 200)
+		b.spawning = 0
+		for i := range b.segments {
+			if !b.segments[i].core {
+				b.segments[i].hp = 0
+			}
+		}
+		b.attack = "charge"
+		b.attackTime = 0.6
+		b.attackTarget = game.data.player.origin
+		game.data.boss = b
+	}},
+	{"enemy-projectiles", func(game *game) {
+		turret := NewTurret(-400, 200)
+		goldenSettle(turret)
+		turret.orientation = turret.origin.To(game.data.player.origin).Unit()
+		sniper := NewSniper(450, -250)
+		goldenSettle(sniper)
+		sniper.orientation = sniper.origin.To(game.data.player.origin).Unit()
+		sniper.lastShot = goldenEpoch.Add(-time.Duration((sniperFireRate - sniperAimTime/2) * float64(time.Second)))
+		game.data.entities = append(game.data.entities, *turret, *sniper)
+
+		game.data.projectiles.Fire("turret/shot", pixel.V(-340, 170), turret.orientation, "fire")
+		game.data.projectiles.Fire("sniper/shot", pixel.V(380, -210), sniper.orientation, "lightning")
+		game.data.projectiles.Fire("boss/volley", pixel.V(300, 250), pixel.V(1, 0), "life")
+		for i := 0; i < 20; i++ {
+			game.updateProjectiles(1.0/60, &game.data.player)
+		}
+	}},
+	{"starling-flock", func(game *game) {
+		for i := 0; i < 12; i++ {
+			s := NewStarling(-300+float64(i%4)*40, 150+float64(i/4)*40)
+			goldenSettle(s)
+			s.orientation = pixel.V(1, -0.5).Unit().Rotated(float64(i%3-1) * 0.2)
+			game.data.entities = append(game.data.entities, *s)
+		}
+	}},
+	{"high-contrast-glyphs", func(game *game) {
+		SetElementPalette("high-contrast")
+		elementGlyphsOn = true
+		game.data.player.elements = []string{"chaos", "wind"}
+		for i, element := range []string{"water", "chaos", "spirit", "fire", "lightning", "wind", "life"} {
+			e := NewEssence(float64(i-3)*200, -250, element, goldenEpoch.Add(time.Second))
+			goldenSettle(e)
+			game.data.entities = append(game.data.entities, *e)
+		}
+	}},
+}
+
+// Entities need a font for their labels, even in tests that never draw them
+func init() {
+	basicFont = text.NewAtlas(basicfont.Face7x13, text.ASCII)
+}
+
+// goldenSettle finishes spawning an entity, as though it appeared a couple of seconds ago
+func goldenSettle(e *entityData) {
+	e.born = goldenEpoch.Add(-2 * time.Second)
+	e.spawning = false
+}
+
+// newGoldenGame is an evolved game frozen at goldenEpoch, with the player sat in the middle
+func newGoldenGame() *game {
+	game := NewGame(LocalData{})
+	game.state = "playing"
+	game.data = *NewEvolvedGame()
+	game.data.player.born = goldenEpoch.Add(-2 * time.Second)
+	game.data.player.spawning = false
+	game.grid = newWorldGrid(findGridTheme(game.data.gridTheme), game.data.arena)
+	game.lastFrame = goldenEpoch
+	game.totalTime = 10.0
+	return game
+}
+
+// renderGoldenScene draws a scene the same way every time, big enough to fit the whole arena
+func renderGoldenScene(scene goldenScene, art worldArt) *image.RGBA {
+	// particles and some enemies pick random directions
+	rand.Seed(1)
+	serial := serialUpdates
+	SetSerialUpdates(true)
+	defer SetSerialUpdates(serial)
+	palette, glyphs := elementPalette, elementGlyphsOn
+	defer func() { elementPalette, elementGlyphsOn = palette, glyphs }()
+
+	game := newGoldenGame()
+	scene.setup(game)
+
+	bounds := game.data.arena.Bounds()
+	r := NewSoftwareRenderer(int(bounds.W())+32, int(bounds.H())+32)
+	drawWorld(r, game, art)
+	drawBounties(r, game)
+	return r.Image()
+}
+
+var update = flag.Bool("update", false, "rewrite the golden PNGs with how the scenes look now")
+
+// goldenDir is where the scenes are checked in, relative to this package
+const goldenDir = "../testdata/golden"
+
+// TestGolden renders every golden scene and compares it against <goldenDir>/<name>.png.
+// When a scene doesn't match, what it looked like is saved next to it as <name>.actual.png,
+// along with <name>.diff.png showing where. With -update the PNGs are rewritten instead.
+func TestGolden(t *testing.T) {
+	InitAssets("..", nil)
+	art := loadWorldArt()
+
+	for _, scene := range goldenScenes {
+		scene := scene
+		t.Run(scene.name, func(t *testing.T) {
+			actual := renderGoldenScene(scene, art)
+			path := filepath.Join(goldenDir, scene.name+".png")
+
+			if *update {
+				if err := writePNG(path, actual); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			expected, err := readPNG(path)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+
+			diff, different := diffImages(expected, actual)
+			total := actual.Bounds().Dx() * actual.Bounds().Dy()
+			if different > int(math.Ceil(float64(total)*goldenPixelTolerance)) {
+				writePNG(filepath.Join(goldenDir, scene.name+".actual.png"), actual)
+				writePNG(filepath.Join(goldenDir, scene.name+".diff.png"), diff)
+				t.Errorf("%d of %d pixels differ", different, total)
+			}
+		})
+	}
+}
+
+// diffImages paints each differing pixel red on a dimmed copy of what was expected
+func diffImages(expected image.Image, actual *image.RGBA) (*image.RGBA, int) {
+	bounds := actual.Bounds()
+	diff := image.NewRGBA(bounds)
+	if expected.Bounds() != bounds {
+		return diff, bounds.Dx() * bounds.Dy()
+	}
+
+	different := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			e := color.RGBAModel.Convert(expected.At(x, y)).(color.RGBA)
+			a := actual.RGBAAt(x, y)
+			if channelDiff(e.R, a.R) > goldenChannelTolerance || channelDiff(e.G, a.G) > goldenChannelTolerance ||
+				channelDiff(e.B, a.B) > goldenChannelTolerance || channelDiff(e.A, a.A) > goldenChannelTolerance {
+				different++
+				diff.SetRGBA(x, y, color.RGBA{255, 0, 0, 255})
+				continue
+			}
+			diff.SetRGBA(x, y, color.RGBA{e.R / 4, e.G / 4, e.B / 4, 255})
+		}
+	}
+	return diff, different
+}
+
+func channelDiff(a uint8, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+func readPNG(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return png.Decode(file)
+}
+
+func writePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return png.Encode(file, img)
+}
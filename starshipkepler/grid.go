@@ -1,6 +1,10 @@
 package starshipkepler
 
-import "github.com/faiface/pixel"
+import (
+	"math"
+
+	"github.com/faiface/pixel"
+)
 
 type pointMass struct {
 	origin       Vector3
@@ -30,16 +34,16 @@ func (pm *pointMass) IncreaseDamping(factor float64) {
 
 // // spring simulation using "symplectic Euler integration"
 // via https://gamedevelopment.tutsplus.com/tutorials/make-a-neon-vector-shooter-in-xna-the-warping-grid--gamedev-9904
-func (pm *pointMass) Update() {
+// step is in 60ths of a second. Forces are applied in full as a kick, so anything pushing every frame should scale by the frame time
+func (pm *pointMass) Update(step float64) {
 	pm.velocity = pm.velocity.Add(pm.acceleration)
-	pm.origin = pm.origin.Add(pm.velocity)
+	pm.origin = pm.origin.Add(pm.velocity.Mul(step))
 	pm.acceleration = v3zero()
 	if pm.velocity.LengthSquared() < 0.001*0.001 {
 		pm.velocity = v3zero()
 	}
 
-	pm.velocity = pm.velocity.Mul(pm.damping)
-	pm.damping = 0.98
+	pm.velocity = pm.velocity.Mul(math.Pow(pm.damping, step))
 }
 
 type spring struct {
@@ -61,7 +65,7 @@ func NewSpring(end1 *pointMass, end2 *pointMass, stiffness float64, damping floa
 	return &s
 }
 
-func (s *spring) Update() {
+func (s *spring) Update(step float64) {
 	x := s.end1.origin.Sub(s.end2.origin)
 	len := x.Len()
 	if len <= s.targetLength {
@@ -74,157 +78,177 @@ func (s *spring) Update() {
 		dv.Mul(s.damping),
 	)
 
-	s.end1.ApplyForce(force.Mul(-1))
-	s.end2.ApplyForce(force)
+	s.end1.ApplyForce(force.Mul(-step))
+	s.end2.ApplyForce(force.Mul(step))
 }
 
 type grid struct {
 	springs []*spring
-	points  [][]*pointMass
+
+	// What gets drawn: lines between point masses (or the midpoints of pairs of them), and cells to fill
+	lines []gridLine
+	cells [][]*pointMass
+	theme gridTheme
+	arena *Arena // what it was laid out to cover, and what it's drawn inside of
+
+	// For updating in parallel: the springs split into sets where no two springs share a point mass,
+	// and every (non-fixed) point mass in one list
+	springSets [][]*spring
+	masses     []*pointMass
+}
+
+// gridLine runs between two ends, each the midpoint of a pair of point masses (usually the same one twice)
+type gridLine struct {
+	from      [2]*pointMass
+	to        [2]*pointMass
+	thickness float64
 }
 
-func NewGrid(size pixel.Rect, spacing pixel.Vec) grid {
-	g := grid{}
+func (l gridLine) ends(view projection) (pixel.Vec, pixel.Vec) {
+	from := view.Project(l.from[0].origin).Add(view.Project(l.from[1].origin)).Scaled(0.5)
+	to := view.Project(l.to[0].origin).Add(view.Project(l.to[1].origin)).Scaled(0.5)
+	return from, to
+}
+
+// NewGrid covers size in point masses roughly spacing apart, laid out in the theme's shape
+func NewGrid(size pixel.Rect, spacing pixel.Vec, theme gridTheme) grid {
+	b := &gridBuilder{}
+	b.g.theme = theme
 
 	// fmt.Printf(
 	// 	"[NewGrid] size: [%f, %f], [%f, %f], spacing: [%f, %f]\n",
 	// 	size.Min.X, size.Min.Y, size.Max.X, size.Max.Y, spacing.X, spacing.Y,
 	// )
-	numCols := int(size.W()/spacing.X) + 1
-	numRows := int(size.H()/spacing.Y) + 1
-
-	g.points = make([][]*pointMass, numCols)
-	for c := range g.points {
-		g.points[c] = make([]*pointMass, numRows)
+	switch theme.shape {
+	case "hex":
+		b.hex(size, spacing.X)
+	case "radial":
+		b.radial(size, spacing.X)
+	case "triangle":
+		b.triangle(size, spacing.X)
+	default:
+		b.square(size, spacing)
 	}
 
-	// these fixed points will be used to anchor the grid to fixed positions on the screen
-	fixedPoints := make([][]*pointMass, numCols)
-	for c := range fixedPoints {
-		fixedPoints[c] = make([]*pointMass, numRows)
-	}
+	b.g.partition()
+	return b.g
+}
 
-	// create the point masses
-	column, row := 0, 0
-	for y := size.Min.Y; y <= size.Max.Y; y += spacing.Y {
-		for x := size.Min.X; x <= size.Max.X; x += spacing.X {
-			g.points[column][row] = NewPointMass(
-				Vector3{x, y, 0.0}, 1.0,
-			)
-			fixedPoints[column][row] = NewPointMass(
-				Vector3{x, y, 0.0}, 0.0,
-			)
-			column++
+// partition colours the springs so that each set can be updated at once without two workers pushing on the same point
+func (g *grid) partition() {
+	g.springSets = [][]*spring{}
+	used := map[*pointMass][]bool{}
+	for _, s := range g.springs {
+		if s == nil {
+			continue
 		}
-		row++
-		column = 0
-	}
-
-	// link the point masses together with springs
-	g.springs = make([]*spring, numRows*numCols)
-	for y := 0; y < numRows; y++ {
-		for x := 0; x < numCols; x++ {
-			if x == 0 || y == 0 || x == (numCols-1) || y == (numRows-1) {
-				// anchor the border of the grid
-				g.springs = append(
-					g.springs,
-					NewSpring(fixedPoints[x][y], g.points[x][y], 0.1, 0.1),
-				)
-			} else if x%3 == 0 && y%3 == 0 {
-				// loosely anchor 1/9th of the point masses
-				g.springs = append(
-					g.springs,
-					NewSpring(fixedPoints[x][y], g.points[x][y], 0.002, 0.002),
-				)
+		set := 0
+		for ; set < len(g.springSets); set++ {
+			if !inSet(used[s.end1], set) && !inSet(used[s.end2], set) {
+				break
 			}
+		}
+		if set == len(g.springSets) {
+			g.springSets = append(g.springSets, []*spring{})
+		}
+		g.springSets[set] = append(g.springSets[set], s)
+		used[s.end1] = markSet(used[s.end1], set)
+		used[s.end2] = markSet(used[s.end2], set)
+	}
+}
 
-			stiffness := 0.28
-			damping := 0.06
+func inSet(sets []bool, set int) bool {
+	return set < len(sets) && sets[set]
+}
 
-			if x > 0 {
-				g.springs = append(
-					g.springs,
-					NewSpring(
-						g.points[x-1][y], g.points[x][y], stiffness, damping,
-					),
-				)
-			}
-			if y > 0 {
-				g.springs = append(
-					g.springs,
-					NewSpring(
-						g.points[x][y-1], g.points[x][y], stiffness, damping,
-					),
-				)
-			}
-		}
+func markSet(sets []bool, set int) []bool {
+	for len(sets) <= set {
+		sets = append(sets, false)
 	}
-	return g
+	sets[set] = true
+	return sets
 }
 
-func (g *grid) Update() {
-	for _, s := range g.springs {
-		if s != nil {
-			s.Update()
-		}
+// Update runs the springs for the given number of 60ths of a second.
+// Long frames are split up so the springs never take a bigger step than they were tuned for.
+func (g *grid) Update(frames float64) {
+	steps := int(math.Ceil(frames))
+	if steps <= 0 {
+		return
 	}
+	step := frames / float64(steps)
+
+	for i := 0; i < steps; i++ {
+		for _, set := range g.springSets {
+			parallelFor(len(set), func(worker int, from int, to int) {
+				for _, s := range set[from:to] {
+					s.Update(step)
+				}
+			})
+		}
 
-	for _, col := range g.points {
-		for _, point := range col {
-			if point != nil {
-				point.Update()
+		parallelFor(len(g.masses), func(worker int, from int, to int) {
+			for _, point := range g.masses[from:to] {
+				point.Update(step)
 			}
+		})
+	}
+
+	for _, point := range g.masses {
+		point.damping = 0.98
+	}
+}
+
+// pin holds down every point mass that's somewhere fixed, so the grid looks attached to it
+func (g *grid) pin(fixed func(pos pixel.Vec) bool) {
+	for _, p := range g.masses {
+		if fixed(pixel.V(p.origin.X, p.origin.Y)) {
+			anchor := NewPointMass(p.origin, 0.0)
+			g.springs = append(g.springs, NewSpring(anchor, p, gridEdgeAnchor, gridEdgeAnchor))
 		}
 	}
+	g.partition()
 }
 
 func (g *grid) ApplyDirectedForce(force Vector3, origin Vector3, radius float64) {
-	for _, col := range g.points {
-		for _, point := range col {
-			if origin.Sub(point.origin).LengthSquared() < radius*radius {
-				point.ApplyForce(
-					force.Mul(10).Div(origin.Sub(point.origin).Len() + 10),
-				)
-			}
+	for _, point := range g.masses {
+		if origin.Sub(point.origin).LengthSquared() < radius*radius {
+			point.ApplyForce(
+				force.Mul(10).Div(origin.Sub(point.origin).Len() + 10),
+			)
 		}
 	}
 }
 
 func (g *grid) ApplyImplosiveForce(force float64, origin Vector3, radius float64) {
-	for _, col := range g.points {
-		for _, point := range col {
-			dist2 := origin.Sub(point.origin).LengthSquared()
-			if dist2 < radius*radius {
-				forceMultiplier := origin.Sub(point.origin).Mul(10 * force).Div(100 + dist2)
-				point.ApplyForce(forceMultiplier)
-				point.IncreaseDamping(0.6)
-			}
+	for _, point := range g.masses {
+		dist2 := origin.Sub(point.origin).LengthSquared()
+		if dist2 < radius*radius {
+			forceMultiplier := origin.Sub(point.origin).Mul(10 * force).Div(100 + dist2)
+			point.ApplyForce(forceMultiplier)
+			point.IncreaseDamping(0.6)
 		}
 	}
 }
 
 func (g *grid) ApplyTightImplosiveForce(force float64, origin Vector3, radius float64) {
-	for _, col := range g.points {
-		for _, point := range col {
-			dist2 := origin.Sub(point.origin).LengthSquared()
-			if dist2 < radius*radius {
-				forceMultiplier := origin.Sub(point.origin).Mul(100 * force).Div(10000 + dist2)
-				point.ApplyForce(forceMultiplier)
-				point.IncreaseDamping((0.6))
-			}
+	for _, point := range g.masses {
+		dist2 := origin.Sub(point.origin).LengthSquared()
+		if dist2 < radius*radius {
+			forceMultiplier := origin.Sub(point.origin).Mul(100 * force).Div(10000 + dist2)
+			point.ApplyForce(forceMultiplier)
+			point.IncreaseDamping((0.6))
 		}
 	}
 }
 
 func (g *grid) ApplyExplosiveForce(force float64, origin Vector3, radius float64) {
-	for _, col := range g.points {
-		for _, point := range col {
-			dist2 := origin.Sub(point.origin).LengthSquared()
-			if dist2 < radius*radius {
-				forceMultiplier := point.origin.Sub(origin).Mul(100 * force).Div(10000 + dist2)
-				point.ApplyForce(forceMultiplier)
-				point.IncreaseDamping((0.6))
-			}
+	for _, point := range g.masses {
+		dist2 := origin.Sub(point.origin).LengthSquared()
+		if dist2 < radius*radius {
+			forceMultiplier := point.origin.Sub(origin).Mul(100 * force).Div(10000 + dist2)
+			point.ApplyForce(forceMultiplier)
+			point.IncreaseDamping((0.6))
 		}
 	}
 }
@@ -0,0 +1,297 @@
+package starshipkepler
+
+import (
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// gridTheme is how the background grid is built and drawn
+type gridTheme struct {
+	name       string
+	shape      string  // square, hex, radial or triangle
+	style      string  // lines, dots or cells
+	hue        float64 // added to the slowly cycling hue
+	saturation float64
+	alpha      float64 // the music brightens it from here
+}
+
+// In the order the debug key cycles through them
+var gridThemes = []gridTheme{
+	{name: "classic", shape: "square", style: "lines", hue: 3.6, saturation: 0.5, alpha: 0.1},
+	{name: "honeycomb", shape: "hex", style: "lines", hue: 0.8, saturation: 0.6, alpha: 0.12},
+	{name: "vortex", shape: "radial", style: "dots", hue: 4.5, saturation: 0.4, alpha: 0.25},
+	{name: "shards", shape: "triangle", style: "cells", hue: 2.4, saturation: 0.7, alpha: 0.06},
+}
+
+func findGridTheme(name string) gridTheme {
+	for _, theme := range gridThemes {
+		if theme.name == name {
+			return theme
+		}
+	}
+	return gridThemes[0]
+}
+
+func nextGridTheme(name string) string {
+	for i, theme := range gridThemes {
+		if theme.name == name {
+			return gridThemes[(i+1)%len(gridThemes)].name
+		}
+	}
+	return gridThemes[0].name
+}
+
+// Spring settings shared by every shape
+const gridStiffness = 0.28
+const gridDamping = 0.06
+const gridEdgeAnchor = 0.1    // the edges are held firmly in place
+const gridLooseAnchor = 0.002 // some of the rest are loosely held so the grid drifts back
+
+type gridBuilder struct {
+	g grid
+}
+
+func (b *gridBuilder) point(pos pixel.Vec) *pointMass {
+	p := NewPointMass(Vector3{pos.X, pos.Y, 0.0}, 1.0)
+	b.g.masses = append(b.g.masses, p)
+	return p
+}
+
+// anchor ties a point mass to where it started
+func (b *gridBuilder) anchor(p *pointMass, stiffness float64) {
+	fixed := NewPointMass(p.origin, 0.0)
+	b.g.springs = append(b.g.springs, NewSpring(fixed, p, stiffness, stiffness))
+}
+
+// link joins two point masses with a spring, and a line when thickness is above 0
+func (b *gridBuilder) link(p1 *pointMass, p2 *pointMass, thickness float64) {
+	b.g.springs = append(b.g.springs, NewSpring(p1, p2, gridStiffness, gridDamping))
+	if thickness > 0 {
+		b.g.lines = append(b.g.lines, gridLine{from: [2]*pointMass{p1, p1}, to: [2]*pointMass{p2, p2}, thickness: thickness})
+	}
+}
+
+func (b *gridBuilder) cell(points ...*pointMass) {
+	b.g.cells = append(b.g.cells, points)
+}
+
+// square is the original lattice, thick and thin lines alternating with thinner ones between them
+func (b *gridBuilder) square(size pixel.Rect, spacing pixel.Vec) {
+	numCols := int(size.W()/spacing.X) + 1
+	numRows := int(size.H()/spacing.Y) + 1
+
+	points := make([][]*pointMass, numCols)
+	for x := range points {
+		points[x] = make([]*pointMass, numRows)
+	}
+	for y := 0; y < numRows; y++ {
+		for x := 0; x < numCols; x++ {
+			points[x][y] = b.point(size.Min.Add(pixel.V(float64(x)*spacing.X, float64(y)*spacing.Y)))
+		}
+	}
+
+	for y := 0; y < numRows; y++ {
+		for x := 0; x < numCols; x++ {
+			p := points[x][y]
+			if x == 0 || y == 0 || x == (numCols-1) || y == (numRows-1) {
+				b.anchor(p, gridEdgeAnchor)
+			} else if x%3 == 0 && y%3 == 0 {
+				b.anchor(p, gridLooseAnchor)
+			}
+
+			if x > 0 {
+				thickness := 1.0
+				if y%2 == 0 {
+					thickness = 4.0
+				}
+				b.link(points[x-1][y], p, thickness)
+			}
+			if y > 0 {
+				thickness := 1.0
+				if x%2 == 0 {
+					thickness = 4.0
+				}
+				b.link(points[x][y-1], p, thickness)
+			}
+
+			if x > 0 && y > 0 {
+				left, up, upLeft := points[x-1][y], points[x][y-1], points[x-1][y-1]
+				b.g.lines = append(b.g.lines,
+					gridLine{from: [2]*pointMass{upLeft, up}, to: [2]*pointMass{left, p}, thickness: 1.0},
+					gridLine{from: [2]*pointMass{upLeft, left}, to: [2]*pointMass{up, p}, thickness: 1.0},
+				)
+				b.cell(upLeft, up, p, left)
+			}
+		}
+	}
+}
+
+// triangle is rows of points, every other row shifted along by half, each joined to its six neighbours
+func (b *gridBuilder) triangle(size pixel.Rect, spacing float64) {
+	rowHeight := spacing * math.Sqrt(3) / 2
+	numCols := int(size.W()/spacing) + 2
+	numRows := int(size.H()/rowHeight) + 1
+
+	points := make([][]*pointMass, numRows)
+	for r := range points {
+		points[r] = make([]*pointMass, numCols)
+		offset := -spacing / 2
+		if r%2 == 1 {
+			offset = 0
+		}
+		for c := range points[r] {
+			points[r][c] = b.point(size.Min.Add(pixel.V(float64(c)*spacing+offset, float64(r)*rowHeight)))
+		}
+	}
+
+	for r := 0; r < numRows; r++ {
+		for c := 0; c < numCols; c++ {
+			p := points[r][c]
+			if r == 0 || c == 0 || r == numRows-1 || c == numCols-1 {
+				b.anchor(p, gridEdgeAnchor)
+			} else if r%3 == 0 && c%3 == 0 {
+				b.anchor(p, gridLooseAnchor)
+			}
+
+			if c > 0 {
+				thickness := 1.0
+				if r%3 == 0 {
+					thickness = 3.0
+				}
+				b.link(points[r][c-1], p, thickness)
+			}
+			if r == 0 {
+				continue
+			}
+
+			// the two points below, which depends on which way this row is shifted
+			downLeft, downRight := c-1, c
+			if r%2 == 1 {
+				downLeft, downRight = c, c+1
+			}
+			if downLeft >= 0 {
+				b.link(points[r-1][downLeft], p, 1.0)
+			}
+			if downRight < numCols {
+				b.link(points[r-1][downRight], p, 1.0)
+			}
+			if downLeft >= 0 && downRight < numCols {
+				b.cell(p, points[r-1][downLeft], points[r-1][downRight])
+			}
+			if c > 0 && downLeft >= 0 {
+				b.cell(points[r][c-1], p, points[r-1][downLeft])
+			}
+		}
+	}
+}
+
+// hex is a honeycomb of pointy topped hexagons, spacing across each side.
+// Hexagons share their corners, so each corner is only made once.
+func (b *gridBuilder) hex(size pixel.Rect, spacing float64) {
+	width := math.Sqrt(3) * spacing
+	rowHeight := 1.5 * spacing
+	numCols := int(size.W()/width) + 2
+	numRows := int(size.H()/rowHeight) + 2
+
+	inner := pixel.R(size.Min.X+spacing, size.Min.Y+spacing, size.Max.X-spacing, size.Max.Y-spacing)
+	corners := map[[2]int64]*pointMass{}
+	corner := func(pos pixel.Vec) *pointMass {
+		key := [2]int64{int64(math.Round(pos.X * 10)), int64(math.Round(pos.Y * 10))}
+		if p, ok := corners[key]; ok {
+			return p
+		}
+		p := b.point(pos)
+		corners[key] = p
+
+		if !inner.Contains(pos) {
+			b.anchor(p, gridEdgeAnchor)
+		} else if len(corners)%9 == 0 {
+			b.anchor(p, gridLooseAnchor)
+		}
+		return p
+	}
+
+	linked := map[[2]*pointMass]bool{}
+	for r := 0; r < numRows; r++ {
+		for c := 0; c < numCols; c++ {
+			centre := size.Min.Add(pixel.V(float64(c)*width, float64(r)*rowHeight))
+			if r%2 == 1 {
+				centre.X += width / 2
+			}
+
+			hexagon := make([]*pointMass, 6)
+			for i := range hexagon {
+				angle := math.Pi/6 + float64(i)*math.Pi/3
+				hexagon[i] = corner(centre.Add(pixel.V(math.Cos(angle), math.Sin(angle)).Scaled(spacing)))
+			}
+			for i, p := range hexagon {
+				next := hexagon[(i+1)%6]
+				if !linked[[2]*pointMass{p, next}] && !linked[[2]*pointMass{next, p}] {
+					linked[[2]*pointMass{p, next}] = true
+					b.link(p, next, 2.0)
+				}
+			}
+			// a honeycomb folds up on its own, so brace each cell across the middle
+			for i := 0; i < 3; i++ {
+				b.link(hexagon[i], hexagon[i+3], 0.0)
+			}
+			b.cell(hexagon...)
+		}
+	}
+}
+
+// radial is rings around the middle of the arena joined by spokes.
+// Rings further out have more spokes so the points stay about spacing apart.
+func (b *gridBuilder) radial(size pixel.Rect, spacing float64) {
+	centre := size.Center()
+	ringSpacing := spacing * 1.2
+	numRings := int(math.Ceil(size.Max.Sub(centre).Len()/ringSpacing)) + 1
+
+	middle := b.point(centre)
+	b.anchor(middle, gridEdgeAnchor)
+
+	inner := []*pointMass{middle}
+	for k := 1; k <= numRings; k++ {
+		radius := float64(k) * ringSpacing
+		spokes := 8 * int(math.Pow(2, math.Round(math.Log2(math.Max(1, 2*math.Pi*radius/spacing/8)))))
+
+		ring := make([]*pointMass, spokes)
+		for j := range ring {
+			angle := 2 * math.Pi * float64(j) / float64(spokes)
+			ring[j] = b.point(centre.Add(pixel.V(math.Cos(angle), math.Sin(angle)).Scaled(radius)))
+
+			if k == numRings {
+				b.anchor(ring[j], gridEdgeAnchor)
+			} else if k%3 == 0 && j%3 == 0 {
+				b.anchor(ring[j], gridLooseAnchor)
+			}
+		}
+
+		for j, p := range ring {
+			// around the ring
+			thickness := 1.0
+			if k%3 == 0 {
+				thickness = 3.0
+			}
+			b.link(ring[(j+spokes-1)%spokes], p, thickness)
+
+			// out from the ring inside, with the 8 main spokes drawn thicker
+			thickness = 1.0
+			if j%(spokes/8) == 0 {
+				thickness = 3.0
+			}
+			from := inner[j*len(inner)/spokes]
+			b.link(from, p, thickness)
+
+			next := ring[(j+1)%spokes]
+			nextFrom := inner[((j+1)%spokes)*len(inner)/spokes]
+			if from == nextFrom {
+				b.cell(from, p, next)
+			} else {
+				b.cell(from, p, next, nextFrom)
+			}
+		}
+		inner = ring
+	}
+}
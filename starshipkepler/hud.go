@@ -0,0 +1,216 @@
+package starshipkepler
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"github.com/faiface/pixel/text"
+	"golang.org/x/image/colornames"
+)
+
+// HUD elements are placed relative to an edge or corner of the screen, so they stay put at any resolution
+var hudAnchors = map[string]pixel.Vec{
+	"top-left":     pixel.V(-1, 1),
+	"top":          pixel.V(0, 1),
+	"top-right":    pixel.V(1, 1),
+	"centre":       pixel.V(0, 0),
+	"bottom-left":  pixel.V(-1, -1),
+	"bottom":       pixel.V(0, -1),
+	"bottom-right": pixel.V(1, -1),
+}
+
+// anchored is offset away from an anchor on the edge of bounds
+func anchored(bounds pixel.Rect, anchor string, offset pixel.Vec) pixel.Vec {
+	a := hudAnchors[anchor]
+	return bounds.Center().Add(pixel.V(a.X*bounds.W()/2, a.Y*bounds.H()/2)).Add(offset)
+}
+
+// Most icons the HUD will draw in a row before it switches to a count
+const hudMaxIcons = 6
+
+var hudBarBackground = color.RGBA{0x40, 0x40, 0x40, 0xaa}
+var hudMultiplierColour = colornames.Lightgoldenrodyellow
+
+const hudBossBarWidth = 600.0
+
+type hud struct {
+	imd     *imdraw.IMDraw
+	txt     *text.Text
+	small   *text.Text
+	sprites map[string]*pixel.Sprite
+}
+
+func NewHUD(font *text.Atlas, smallFont *text.Atlas) *hud {
+	h := &hud{
+		imd:     imdraw.New(nil),
+		txt:     text.New(pixel.ZV, font),
+		small:   text.New(pixel.ZV, smallFont),
+		sprites: map[string]*pixel.Sprite{},
+	}
+	for element, glyph := range loadElementGlyphs() {
+		h.sprites[element] = pixel.NewSprite(glyph, glyph.Bounds())
+	}
+	return h
+}
+
+// write puts s at pos, with align 0 for left aligned, 0.5 centred and 1 right aligned
+func (h *hud) write(t pixel.Target, txt *text.Text, colour color.Color, pos pixel.Vec, align float64, scale float64, s string) {
+	txt.Clear()
+	txt.Orig = pos
+	txt.Dot = pos
+	txt.Dot.X -= txt.BoundsOf(s).W() * align
+	txt.Color = colour
+	txt.WriteString(s)
+	txt.Draw(t, pixel.IM.Scaled(pos, scale))
+}
+
+// bar is a progress bar filled from the left
+func (h *hud) bar(min pixel.Vec, size pixel.Vec, progress float64, colour color.Color) {
+	progress = math.Max(0, math.Min(1, progress))
+	h.imd.Color = hudBarBackground
+	h.imd.Push(min, min.Add(size))
+	h.imd.Rectangle(0)
+	if progress > 0 {
+		h.imd.Color = colour
+		h.imd.Push(min, min.Add(pixel.V(size.X*progress, size.Y)))
+		h.imd.Rectangle(0)
+	}
+}
+
+// icons lays out count icons in a row centred on pos, with a count after them if there's too many
+func (h *hud) icons(pos pixel.Vec, count int, spacing float64, icon func(pixel.Vec)) (overflow pixel.Vec, shown int) {
+	shown = int(math.Min(float64(count), hudMaxIcons))
+	left := pos.X - float64(shown-1)*spacing/2
+	for i := 0; i < shown; i++ {
+		icon(pixel.V(left+float64(i)*spacing, pos.Y))
+	}
+	return pixel.V(left+float64(shown)*spacing-spacing/2, pos.Y), shown
+}
+
+func (h *hud) lifeIcon(pos pixel.Vec) {
+	h.imd.Color = colornames.White
+	h.imd.Push(pos)
+	h.imd.Circle(7, 2)
+	h.imd.Push(pos)
+	h.imd.CircleArc(11, math.Pi/2+0.4, math.Pi/2-0.4, 1.5)
+}
+
+func (h *hud) bombIcon(pos pixel.Vec) {
+	h.imd.Color = colornames.Orange
+	h.imd.Push(pos)
+	h.imd.Circle(8, 2)
+	h.imd.Push(pos)
+	h.imd.Circle(3, 0)
+}
+
+// Draw puts the HUD over a screen the size of bounds
+// multiplierProgress is how far through the kills for the next multiplier the player is. The kills
+// needed double each time and aren't reset, so it's measured from the last one.
+func multiplierProgress(data *gamedata) float64 {
+	if data.scoreMultiplier >= 10 || data.multiplierReward <= 0 {
+		return 1.0
+	}
+	previous := 0
+	if data.scoreMultiplier > 1 {
+		previous = data.multiplierReward / 2
+	}
+	return float64(data.killsSinceBorn-previous) / float64(data.multiplierReward-previous)
+}
+
+func (h *hud) Draw(t pixel.Target, bounds pixel.Rect, game *game) {
+	h.imd.Clear()
+	data := &game.data
+
+	// top left: score and multiplier, with how far there is to go until the next one
+	scorePos := anchored(bounds, "top-left", pixel.V(40, -50))
+	multiplierPos := scorePos.Add(pixel.V(0, -32))
+	h.bar(multiplierPos.Add(pixel.V(56, 2)), pixel.V(160, 8), multiplierProgress(data), hudMultiplierColour)
+
+	// top: lives, and bombs under them
+	livesPos := anchored(bounds, "top", pixel.V(0, -44))
+	bombsPos := livesPos.Add(pixel.V(0, -32))
+	livesOverflow, livesShown := h.icons(livesPos, data.lives, 30, h.lifeIcon)
+	bombsOverflow, bombsShown := h.icons(bombsPos, data.bombs, 30, h.bombIcon)
+
+	// bottom: the two ward slots, and the bomb cooldown under them
+	slotsPos := anchored(bounds, "bottom", pixel.V(0, 84))
+	slotSize := 48.0
+	slots := []pixel.Vec{slotsPos.Add(pixel.V(-slotSize*0.65, 0)), slotsPos.Add(pixel.V(slotSize*0.65, 0))}
+	for i, slot := range slots {
+		min, max := slot.Sub(pixel.V(slotSize/2, slotSize/2)), slot.Add(pixel.V(slotSize/2, slotSize/2))
+		if i < len(data.player.elements) {
+			h.imd.Color = elementColour(data.player.elements[i])
+			h.imd.Push(min, max)
+			h.imd.Rectangle(3)
+		} else {
+			h.imd.Color = pixel.Alpha(0.3)
+			h.imd.Push(min, max)
+			h.imd.Rectangle(1)
+		}
+	}
+	cooldown := game.lastFrame.Sub(data.lastBomb).Seconds() / bombCooldown
+	cooldownColour := color.Color(colornames.Grey)
+	if cooldown >= 1 && len(data.player.elements) > 0 {
+		cooldownColour = colornames.White
+	}
+	h.bar(slotsPos.Add(pixel.V(-slotSize*1.15, -slotSize/2-14)), pixel.V(slotSize*2.3, 4), cooldown, cooldownColour)
+
+	// under the bombs: the boss's health, notched where each phase starts
+	bossPos := anchored(bounds, "top", pixel.V(0, -140))
+	if b := data.boss; b != nil {
+		min := bossPos.Add(pixel.V(-hudBossBarWidth/2, 0))
+		h.bar(min, pixel.V(hudBossBarWidth, 10), b.Health(), bossTelegraphColour)
+		h.imd.Color = colornames.White
+		for _, phase := range b.phases[1:] {
+			x := min.X + hudBossBarWidth*phase.threshold
+			h.imd.Push(pixel.V(x, min.Y-3), pixel.V(x, min.Y+13))
+			h.imd.Line(2)
+		}
+	}
+
+	h.imd.Draw(t)
+
+	for i, element := range data.player.elements {
+		if sprite, ok := h.sprites[element]; ok && i < len(slots) {
+			sprite.Draw(t, pixel.IM.Scaled(pixel.ZV, (slotSize-12)/sprite.Frame().W()).Moved(slots[i]))
+		}
+	}
+
+	h.write(t, h.txt, colornames.White, scorePos, 0, 1, fmt.Sprintf("Score: %d", data.score))
+	h.write(t, h.txt, hudMultiplierColour, multiplierPos, 0, 1.2, fmt.Sprintf("x%d", data.scoreMultiplier))
+	if livesShown < data.lives {
+		h.write(t, h.small, colornames.White, livesOverflow.Add(pixel.V(8, -5)), 0, 1, fmt.Sprintf("+%d", data.lives-livesShown))
+	}
+	if bombsShown < data.bombs {
+		h.write(t, h.small, colornames.Orange, bombsOverflow.Add(pixel.V(8, -5)), 0, 1, fmt.Sprintf("+%d", data.bombs-bombsShown))
+	}
+
+	// top right: the score to beat
+	highscore := game.localData.Highscore()
+	if highscore.Score > 0 {
+		h.write(t, h.txt, colornames.White, anchored(bounds, "top-right", pixel.V(-40, -50)), 1, 1,
+			fmt.Sprintf("%s: %d", highscore.Name, highscore.Score))
+	}
+
+	if b := data.boss; b != nil {
+		h.write(t, h.small, colornames.White, bossPos.Add(pixel.V(0, 18)), 0.5, 1, b.title)
+	}
+
+	// banners fade in and out under the lives (and the boss), newest at the top
+	bannerPos := anchored(bounds, "top", pixel.V(0, -150))
+	if data.boss != nil {
+		bannerPos = bannerPos.Add(pixel.V(0, -40))
+	}
+	for i := len(data.banners) - 1; i >= 0; i-- {
+		age := game.lastFrame.Sub(data.banners[i].start).Seconds()
+		if age < 0 || age >= bannerDuration {
+			continue
+		}
+		alpha := math.Min(1, math.Min(age*4, (bannerDuration-age)*2))
+		h.write(t, h.txt, pixel.Alpha(alpha), bannerPos, 0.5, 1.6, data.banners[i].text)
+		bannerPos = bannerPos.Add(pixel.V(0, -40))
+	}
+}
@@ -0,0 +1,27 @@
+package starshipkepler
+
+import "testing"
+
+func TestMultiplierProgress(t *testing.T) {
+	cases := []struct {
+		name       string
+		multiplier int
+		reward     int
+		kills      int
+		want       float64
+	}{
+		{"first level, empty", 1, 25, 0, 0},
+		{"first level, halfway", 1, 25, 12, 0.48},
+		{"just levelled up", 2, 50, 25, 0},
+		{"second level, halfway", 2, 50, 37, 0.48},
+		{"third level, nearly there", 3, 100, 99, 0.98},
+		{"maxed out", 10, 12800, 7000, 1},
+	}
+	for _, c := range cases {
+		data := NewGameData()
+		data.scoreMultiplier, data.multiplierReward, data.killsSinceBorn = c.multiplier, c.reward, c.kills
+		if got := multiplierProgress(data); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package starshipkepler
+
+import (
+	"math"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/effects"
+)
+
+// Audio buses. Every sound is played on exactly one of these.
+const (
+	musicBus = "music"
+	sfxBus   = "sfx"
+	uiBus    = "ui"
+)
+
+// Options menu items, and the bus they control
+var volumeMenuItems = map[string]string{
+	"Master Volume":  "master",
+	"Music Volume":   musicBus,
+	"Effects Volume": sfxBus,
+	"Menu Volume":    uiBus,
+}
+
+const volumeStep = 0.1
+
+// How long the music stays ducked after a big event, and how long it takes to come back
+const duckHold = 0.6
+const duckRelease = 1.5
+
+type audioBus struct {
+	mixer  *beep.Mixer
+	duck   *effects.Volume
+	volume *effects.Volume
+	level  float64 // 0-1, as displayed in the options menu
+	muted  bool
+}
+
+func newAudioBus(level float64) *audioBus {
+	b := &audioBus{
+		mixer: &beep.Mixer{},
+		level: level,
+	}
+	b.duck = &effects.Volume{Streamer: b.mixer, Base: 2}
+	b.volume = &effects.Volume{Streamer: b.duck, Base: 2}
+	b.apply()
+	return b
+}
+
+// must be called with the backend locked
+func (b *audioBus) apply() {
+	b.volume.Silent = b.muted || b.level <= 0.001
+	if !b.volume.Silent {
+		b.volume.Volume = math.Log2(b.level)
+	}
+}
+
+// The buses all feed into the master bus, which is the only thing handed to the backend.
+// Clearing one bus (e.g. switching songs) leaves the others playing.
+type audioMixer struct {
+	backend AudioBackend
+	master  *audioBus
+	buses   map[string]*audioBus
+
+	duckAmount float64 // 0 is full volume, 1 is silent
+	duckTimer  float64
+	lastUpdate time.Time
+}
+
+var audio = newAudioMixer()
+
+func newAudioMixer() *audioMixer {
+	m := &audioMixer{
+		backend: NewNullBackend(),
+		master:  newAudioBus(1.0),
+		buses: map[string]*audioBus{
+			musicBus: newAudioBus(0.8),
+			sfxBus:   newAudioBus(1.0),
+			uiBus:    newAudioBus(1.0),
+		},
+		lastUpdate: time.Now(),
+	}
+	for _, bus := range m.buses {
+		m.master.mixer.Add(bus.volume)
+	}
+	return m
+}
+
+func (m *audioMixer) Streamer() beep.Streamer {
+	return m.master.volume
+}
+
+func (m *audioMixer) bus(name string) *audioBus {
+	if name == "master" {
+		return m.master
+	}
+	bus, ok := m.buses[name]
+	if !ok {
+		return m.buses[sfxBus]
+	}
+	return bus
+}
+
+func (m *audioMixer) Play(bus string, s ...beep.Streamer) {
+	m.backend.Lock()
+	m.bus(bus).mixer.Add(s...)
+	m.backend.Unlock()
+}
+
+func (m *audioMixer) Clear(bus string) {
+	m.backend.Lock()
+	m.bus(bus).mixer.Clear()
+	m.backend.Unlock()
+}
+
+func (m *audioMixer) Level(bus string) float64 {
+	return m.bus(bus).level
+}
+
+func (m *audioMixer) SetLevel(bus string, level float64) {
+	m.backend.Lock()
+	b := m.bus(bus)
+	b.level = math.Max(0.0, math.Min(1.0, level))
+	b.apply()
+	m.backend.Unlock()
+}
+
+func (m *audioMixer) Muted(bus string) bool {
+	return m.bus(bus).muted
+}
+
+func (m *audioMixer) SetMuted(bus string, muted bool) {
+	m.backend.Lock()
+	b := m.bus(bus)
+	b.muted = muted
+	b.apply()
+	m.backend.Unlock()
+}
+
+// Duck pulls the music down so that big moments (deaths, bombs) cut through
+func (m *audioMixer) Duck(amount float64) {
+	m.duckAmount = math.Max(m.duckAmount, math.Min(amount, 1.0))
+	m.duckTimer = duckHold
+	m.applyDuck()
+}
+
+// Update releases any ducking. It uses wall clock time so that slow motion doesn't hold the duck.
+func (m *audioMixer) Update() {
+	m.backend.EndFrame()
+
+	dt := time.Since(m.lastUpdate).Seconds()
+	m.lastUpdate = time.Now()
+
+	if m.duckAmount <= 0 {
+		return
+	}
+
+	if m.duckTimer > 0 {
+		m.duckTimer -= dt
+		return
+	}
+
+	m.duckAmount = math.Max(0.0, m.duckAmount-(dt/duckRelease))
+	m.applyDuck()
+}
+
+func (m *audioMixer) applyDuck() {
+	m.backend.Lock()
+	duck := m.buses[musicBus].duck
+	duck.Silent = m.duckAmount >= 0.999
+	duck.Volume = math.Log2(1.0 - math.Min(m.duckAmount, 0.999))
+	m.backend.Unlock()
+}
+
+// AdjustMenuOption changes the volume for a volume menu item, returning false for other items
+func (m *audioMixer) AdjustMenuOption(option string, change int) bool {
+	bus, ok := volumeMenuItems[option]
+	if !ok {
+		return false
+	}
+	level := math.Round((m.Level(bus)+float64(change)*volumeStep)*10) / 10
+	m.SetLevel(bus, level)
+	m.SetMuted(bus, false)
+	return true
+}
+
+// ToggleMenuOption mutes or unmutes the bus for a volume menu item, returning false for other items
+func (m *audioMixer) ToggleMenuOption(option string) bool {
+	bus, ok := volumeMenuItems[option]
+	if !ok {
+		return false
+	}
+	m.SetMuted(bus, !m.Muted(bus))
+	return true
+}
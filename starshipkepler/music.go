@@ -0,0 +1,291 @@
+package starshipkepler
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/faiface/beep"
+	"gopkg.in/yaml.v3"
+)
+
+const musicFile = "sound/music.yml"
+
+// How long a layer takes to fade in or out, unless music.yml says otherwise
+const defaultLayerFade = 1.0
+
+type musicLayerConfig struct {
+	File      string  `yaml:"file"`
+	Volume    float64 `yaml:"volume"`
+	Intensity float64 `yaml:"intensity"`
+	Fade      float64 `yaml:"fade"`
+}
+
+type songConfig struct {
+	Bpm    float64            `yaml:"bpm"`
+	Beats  int                `yaml:"beats"`
+	Layers []musicLayerConfig `yaml:"layers"`
+}
+
+type musicConfig struct {
+	Crossfade float64               `yaml:"crossfade"`
+	Songs     map[string]songConfig `yaml:"songs"`
+}
+
+type musicLayer struct {
+	source    beep.StreamSeekCloser
+	streamer  beep.Streamer // the source, resampled to the mix format if it needs to be
+	amplitude float64
+	threshold float64
+	gain      float64
+	target    float64
+	fadeStep  float64 // gain change per sample
+}
+
+// stream fills samples from the layer, looping it when it runs out. A source that's broken
+// (it errors, won't seek, or has nothing to give even from the start) is left silent rather than
+// spinning the audio callback forever.
+func (l *musicLayer) stream(samples [][2]float64) {
+	filled := 0
+	seeked := false
+	for filled < len(samples) {
+		n, ok := l.streamer.Stream(samples[filled:])
+		filled += n
+		if ok && n > 0 {
+			seeked = false
+			continue
+		}
+		// playlists report no length, they handle repeating themselves
+		if l.source.Len() == 0 || seeked || l.streamer.Err() != nil {
+			break
+		}
+		if err := l.source.Seek(0); err != nil {
+			break
+		}
+		seeked = true
+	}
+	for i := filled; i < len(samples); i++ {
+		samples[i] = [2]float64{}
+	}
+}
+
+type song struct {
+	name      string
+	layers    []*musicLayer
+	analysis  *trackAnalysis // of the first layer
+	length    int            // of the first layer, in samples at the mix rate
+	rate      beep.SampleRate
+	period    int // samples between points where layers can change, a whole number of beats
+	pos       int
+	level     float64
+	target    float64
+	levelStep float64
+}
+
+func (s *song) restart(intensity float64) {
+	for _, l := range s.layers {
+		l.source.Seek(0)
+		l.target = l.targetFor(intensity)
+		l.gain = l.target
+	}
+	s.pos = 0
+	s.level = 0
+}
+
+func (l *musicLayer) targetFor(intensity float64) float64 {
+	if intensity >= l.threshold {
+		return 1
+	}
+	return 0
+}
+
+// mix adds the song into out. Layers only start fading on the beat, so they come in with the music.
+func (s *song) mix(out [][2]float64, scratch [][2]float64, intensity float64) {
+	for i := 0; i < len(out); {
+		if s.pos%s.period == 0 {
+			for _, l := range s.layers {
+				l.target = l.targetFor(intensity)
+			}
+		}
+
+		n := s.period - s.pos%s.period
+		if n > len(out)-i {
+			n = len(out) - i
+		}
+		chunk := out[i : i+n]
+
+		for _, l := range s.layers {
+			l.stream(scratch[:n])
+			gain := l.gain
+			level := s.level
+			for j := range chunk {
+				gain = approach(gain, l.target, l.fadeStep)
+				level = approach(level, s.target, s.levelStep)
+				amp := gain * level * l.amplitude
+				chunk[j][0] += scratch[j][0] * amp
+				chunk[j][1] += scratch[j][1] * amp
+			}
+			l.gain = gain
+		}
+		for range chunk {
+			s.level = approach(s.level, s.target, s.levelStep)
+		}
+
+		s.pos += n
+		i += n
+	}
+}
+
+func approach(value float64, target float64, step float64) float64 {
+	if value < target {
+		return math.Min(target, value+step)
+	}
+	return math.Max(target, value-step)
+}
+
+// musicPlayer lives on the music bus. The current song fades in while the previous ones fade out.
+type musicPlayer struct {
+	crossfade float64
+	songs     map[string]*song
+	current   *song
+	playing   []*song
+	intensity float64
+	scratch   [][2]float64
+}
+
+var music = &musicPlayer{crossfade: 1.5, songs: map[string]*song{}}
+
+func loadMusic(file string, format beep.Format) {
+	conf := musicConfig{}
+	data, err := assets.ReadFile(file)
+	if err == nil {
+		err = yaml.Unmarshal(data, &conf)
+	}
+	if err != nil {
+		assets.Placeholder(file, err)
+		return
+	}
+
+	crossfade := math.Max(conf.Crossfade, 0.01)
+	music.crossfade = crossfade
+	for name, sc := range conf.Songs {
+		bpm := sc.Bpm
+		if bpm <= 0 {
+			bpm = 120
+		}
+		beats := sc.Beats
+		if beats <= 0 {
+			beats = 1
+		}
+
+		s := &song{
+			name:      name,
+			rate:      format.SampleRate,
+			period:    int(math.Max(1, float64(format.SampleRate)*60.0/bpm*float64(beats))),
+			levelStep: 1.0 / (crossfade * float64(format.SampleRate)),
+		}
+		for i, lc := range sc.Layers {
+			source, layerFormat := prepareStreamer(lc.File)
+			if i == 0 {
+				s.analysis = analyseAsset(lc.File)
+				s.length = int(float64((*source).Len()) * float64(format.SampleRate) / float64(layerFormat.SampleRate))
+			}
+			var streamer beep.Streamer = *source
+			if layerFormat.SampleRate != format.SampleRate {
+				streamer = beep.Resample(4, layerFormat.SampleRate, format.SampleRate, streamer)
+			}
+
+			fade := lc.Fade
+			if fade <= 0 {
+				fade = defaultLayerFade
+			}
+			s.layers = append(s.layers, &musicLayer{
+				source:    *source,
+				streamer:  streamer,
+				amplitude: math.Pow(10, lc.Volume),
+				threshold: lc.Intensity,
+				fadeStep:  1.0 / (fade * float64(format.SampleRate)),
+			})
+		}
+		music.songs[name] = s
+	}
+}
+
+func (m *musicPlayer) Stream(samples [][2]float64) (n int, ok bool) {
+	if len(m.scratch) < len(samples) {
+		m.scratch = make([][2]float64, len(samples))
+	}
+	for i := range samples {
+		samples[i] = [2]float64{}
+	}
+
+	playing := m.playing[:0]
+	for _, s := range m.playing {
+		s.mix(samples, m.scratch, m.intensity)
+		if s == m.current || s.level > 0 {
+			playing = append(playing, s)
+		}
+	}
+	m.playing = playing
+
+	return len(samples), true
+}
+
+func (m *musicPlayer) Err() error { return nil }
+
+// beatPosition is the analysis of what's playing, and how far into it we are in seconds.
+// Must be called with the backend locked.
+func (m *musicPlayer) beatPosition() (*trackAnalysis, float64) {
+	s := m.current
+	if s == nil || len(s.layers) == 0 {
+		return nil, 0
+	}
+	if p, ok := s.layers[0].source.(*playlist); ok {
+		return p.beatPosition()
+	}
+	if s.analysis == nil || s.length <= 0 {
+		return nil, 0
+	}
+	return s.analysis, float64(s.pos%s.length) / float64(s.rate)
+}
+
+// SetMusicIntensity sets how intense the game currently is, from 0 to 1
+func SetMusicIntensity(intensity float64) {
+	audio.backend.Lock()
+	music.intensity = math.Max(0.0, math.Min(1.0, intensity))
+	audio.backend.Unlock()
+}
+
+// PlaySong crossfades from whatever is playing to the named song.
+// If the song is already playing it carries on from where it is.
+func PlaySong(songName string) {
+	audio.backend.Lock()
+	defer audio.backend.Unlock()
+
+	s, ok := music.songs[songName]
+	if !ok {
+		fmt.Printf("[Music] Unknown song: %s\n", songName)
+	}
+
+	if music.current == s && s != nil {
+		return
+	}
+	if music.current != nil {
+		music.current.target = 0
+	}
+	music.current = s
+	if s == nil {
+		return
+	}
+
+	fadingOut := false
+	for _, p := range music.playing {
+		if p == s {
+			fadingOut = true
+		}
+	}
+	if !fadingOut {
+		s.restart(music.intensity)
+		music.playing = append(music.playing, s)
+	}
+	s.target = 1
+}
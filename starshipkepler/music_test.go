@@ -0,0 +1,53 @@
+package starshipkepler
+
+import (
+	"errors"
+	"testing"
+)
+
+// brokenSource claims to have a length but never gives anything back
+type brokenSource struct {
+	seekErr error
+	err     error
+	seeks   int
+}
+
+func (b *brokenSource) Stream(samples [][2]float64) (int, bool) { return 0, false }
+func (b *brokenSource) Err() error                              { return b.err }
+func (b *brokenSource) Len() int                                { return 1000 }
+func (b *brokenSource) Position() int                           { return 0 }
+func (b *brokenSource) Close() error                            { return nil }
+func (b *brokenSource) Seek(p int) error {
+	b.seeks++
+	return b.seekErr
+}
+
+func TestMusicLayerBrokenSource(t *testing.T) {
+	cases := []struct {
+		name   string
+		source *brokenSource
+		seeks  int
+	}{
+		{"empty after seeking", &brokenSource{}, 1},
+		{"seek fails", &brokenSource{seekErr: errors.New("can't seek")}, 1},
+		{"decoder error", &brokenSource{err: errors.New("bad frame")}, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l := &musicLayer{source: c.source, streamer: c.source}
+			samples := make([][2]float64, 64)
+			for i := range samples {
+				samples[i] = [2]float64{1, 1}
+			}
+			l.stream(samples)
+			if c.source.seeks != c.seeks {
+				t.Errorf("expected %d seeks, got %d", c.seeks, c.source.seeks)
+			}
+			for i, s := range samples {
+				if s != [2]float64{} {
+					t.Fatalf("expected silence, sample %d is %v", i, s)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package starshipkepler
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/faiface/beep"
+	"gopkg.in/yaml.v3"
+)
+
+// Tracks are analysed once and the result is cached: built in tracks when they're loaded, in the user's
+// cache directory, and tracks from the music folder the first time they're played, next to themselves.
+// Bump this when the analysis changes so old caches get thrown away.
+const analysisVersion = 2
+const analysisSuffix = ".analysis.yml"
+
+// The analysis works on 10ms windows, and keeps the energy at a coarser rate
+const analysisWindowRate = 100
+const analysisEnergyRate = 20
+
+// Kicks are found in everything below this frequency
+const kickCutoff = 150.0
+
+type trackAnalysis struct {
+	Version   int       `yaml:"version"`
+	Duration  float64   `yaml:"duration"`
+	Bpm       float64   `yaml:"bpm"`
+	FirstBeat float64   `yaml:"firstBeat"` // the first downbeat, in seconds
+	Kicks     []float64 `yaml:"kicks"`
+	Energy    []float64 `yaml:"energy"` // 0-1, analysisEnergyRate values per second
+
+	// The size and modification time of the track that was analysed, so the cache of one that's been replaced isn't used
+	Size    int64 `yaml:"size"`
+	ModTime int64 `yaml:"modTime"`
+}
+
+// stamp records which version of a track was analysed. Embedded tracks don't have a modification time.
+func (t *trackAnalysis) stamp(source fs.FileInfo) {
+	t.Size = source.Size()
+	t.ModTime = 0
+	if !source.ModTime().IsZero() {
+		t.ModTime = source.ModTime().UnixNano()
+	}
+}
+
+func (t *trackAnalysis) beatLength() float64 {
+	return 60.0 / t.Bpm
+}
+
+// beatAt is which beat of the track a time falls in, counting from the first downbeat
+func (t *trackAnalysis) beatAt(seconds float64) int {
+	return int(math.Floor((seconds - t.FirstBeat) / t.beatLength()))
+}
+
+func (t *trackAnalysis) energyAt(seconds float64) float64 {
+	i := int(seconds * analysisEnergyRate)
+	if i < 0 || i >= len(t.Energy) {
+		return 0.0
+	}
+	return t.Energy[i]
+}
+
+// parseAnalysis reads a cached analysis, returning nil if it's out of date or of a different version of the track
+func parseAnalysis(data []byte, source fs.FileInfo) *trackAnalysis {
+	t := &trackAnalysis{}
+	if yaml.Unmarshal(data, t) != nil || t.Version != analysisVersion || t.Bpm <= 0 {
+		return nil
+	}
+	current := trackAnalysis{}
+	current.stamp(source)
+	if t.Size != current.Size || t.ModTime != current.ModTime {
+		return nil
+	}
+	return t
+}
+
+// analyseAsset analyses a track from the game's assets
+func analyseAsset(file string) *trackAnalysis {
+	source, err := assets.Stat(file)
+	if err != nil {
+		return nil
+	}
+	// an analysis can ship alongside the track, otherwise it's cached out of the way
+	if data, err := assets.ReadFile(file + analysisSuffix); err == nil {
+		if t := parseAnalysis(data, source); t != nil {
+			return t
+		}
+	}
+	cache, cacheErr := analysisCachePath(file)
+	if cacheErr == nil {
+		if data, err := ioutil.ReadFile(cache); err == nil {
+			if t := parseAnalysis(data, source); t != nil {
+				return t
+			}
+		}
+	}
+
+	sound, err := assets.Open(file)
+	if err != nil {
+		return nil
+	}
+	streamer, format, err := decodeAudio(file, sound)
+	if err != nil {
+		return nil
+	}
+	t := analyseTrack(streamer, format)
+	t.stamp(source)
+	streamer.Close()
+
+	if cacheErr == nil {
+		data, _ := yaml.Marshal(t)
+		cacheErr = os.MkdirAll(filepath.Dir(cache), 0755)
+		if cacheErr == nil {
+			cacheErr = ioutil.WriteFile(cache, data, 0644)
+		}
+	}
+	if cacheErr != nil {
+		fmt.Printf("[Music] Couldn't cache analysis of %s: %s\n", file, cacheErr)
+	}
+	return t
+}
+
+// analysisCachePath is where the analysis of a built in track is kept, so running from a checkout doesn't leave files in it
+func analysisCachePath(file string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "starship-kepler", "analysis", filepath.FromSlash(cleanAssetPath(file))+analysisSuffix), nil
+}
+
+// analyseFile analyses a track from the user's music folder
+func analyseFile(path string) *trackAnalysis {
+	source, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	cache := path + analysisSuffix
+	if data, err := ioutil.ReadFile(cache); err == nil {
+		if t := parseAnalysis(data, source); t != nil {
+			return t
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	streamer, format, err := decodeAudio(path, f)
+	if err != nil {
+		f.Close()
+		return nil
+	}
+	t := analyseTrack(streamer, format)
+	t.stamp(source)
+	streamer.Close()
+
+	data, _ := yaml.Marshal(t)
+	err = ioutil.WriteFile(cache, data, 0644)
+	if err != nil {
+		fmt.Printf("[Music] Couldn't cache analysis of %s: %s\n", path, err)
+	}
+	return t
+}
+
+// analyseTrack finds the kicks, tempo and loudness of a whole track
+func analyseTrack(streamer beep.Streamer, format beep.Format) *trackAnalysis {
+	window := int(format.SampleRate) / analysisWindowRate
+
+	alpha := 1.0 - math.Exp(-2.0*math.Pi*kickCutoff/float64(format.SampleRate))
+	low := 0.0
+
+	lowEnergy := []float64{}
+	fullEnergy := []float64{}
+	buf := make([][2]float64, window)
+	for {
+		n, ok := streamer.Stream(buf)
+		if n == 0 || !ok {
+			break
+		}
+		l, f := 0.0, 0.0
+		for _, s := range buf[:n] {
+			mono := (s[0] + s[1]) / 2
+			low += alpha * (mono - low)
+			l += low * low
+			f += mono * mono
+		}
+		lowEnergy = append(lowEnergy, l/float64(n))
+		fullEnergy = append(fullEnergy, f/float64(n))
+	}
+
+	t := &trackAnalysis{
+		Version:  analysisVersion,
+		Duration: float64(len(lowEnergy)) / analysisWindowRate,
+		Bpm:      120,
+	}
+	if len(lowEnergy) == 0 {
+		return t
+	}
+
+	// onset strength is how much the bass jumped since the last window
+	onset := make([]float64, len(lowEnergy))
+	for i := 1; i < len(lowEnergy); i++ {
+		onset[i] = math.Max(0, lowEnergy[i]-lowEnergy[i-1])
+	}
+
+	// kicks are bass peaks well above the last half second
+	lastKick := -analysisWindowRate
+	for i := 2; i < len(lowEnergy)-2; i++ {
+		avg := 0.0
+		from := int(math.Max(0, float64(i-analysisWindowRate/2)))
+		for j := from; j < i; j++ {
+			avg += lowEnergy[j]
+		}
+		avg /= math.Max(1, float64(i-from))
+
+		e := lowEnergy[i]
+		peak := e >= lowEnergy[i-1] && e >= lowEnergy[i-2] && e > lowEnergy[i+1] && e > lowEnergy[i+2]
+		if peak && e > avg*1.6 && e > 0.0005 && i-lastKick >= analysisWindowRate/5 {
+			t.Kicks = append(t.Kicks, float64(i)/analysisWindowRate)
+			lastKick = i
+		}
+	}
+
+	// tempo is the beat length (between 70 and 180bpm) the onsets line up with best
+	bestLag, bestScore := analysisWindowRate/2, 0.0
+	for lag := (analysisWindowRate*60 + 179) / 180; lag <= analysisWindowRate*60/70; lag++ {
+		score := 0.0
+		for i := lag; i < len(onset); i++ {
+			score += onset[i] * onset[i-lag]
+		}
+		if score > bestScore {
+			bestLag, bestScore = lag, score
+		}
+	}
+	t.Bpm = 60.0 * analysisWindowRate / float64(bestLag)
+
+	// the downbeat is whichever beat of the bar has the strongest onsets
+	bar := bestLag * 4
+	bestOffset, bestScore := 0, -1.0
+	for offset := 0; offset < bar && offset < len(onset); offset++ {
+		score := 0.0
+		for i := offset; i < len(onset); i += bar {
+			score += onset[i]
+		}
+		// a little credit for the other beats of the bar, so we lock to the beat and not between them
+		for i := offset; i < len(onset); i += bestLag {
+			score += onset[i] * 0.25
+		}
+		if score > bestScore {
+			bestOffset, bestScore = offset, score
+		}
+	}
+	t.FirstBeat = float64(bestOffset) / analysisWindowRate
+
+	// loudness, normalised to the loudest part of the track
+	step := analysisWindowRate / analysisEnergyRate
+	maxEnergy := 0.0
+	for i := 0; i < len(fullEnergy); i += step {
+		e := 0.0
+		for j := i; j < i+step && j < len(fullEnergy); j++ {
+			e += fullEnergy[j]
+		}
+		e = math.Sqrt(e / float64(step))
+		t.Energy = append(t.Energy, e)
+		maxEnergy = math.Max(maxEnergy, e)
+	}
+	if maxEnergy > 0 {
+		for i := range t.Energy {
+			t.Energy[i] = math.Round(t.Energy[i]/maxEnergy*1000) / 1000
+		}
+	}
+
+	return t
+}
+
+// musicEvents is what happened in the music since the last frame
+type musicEvents struct {
+	tracking bool // false when there's no analysed music playing
+	kick     bool
+	beat     bool
+	downbeat bool
+	energy   float64
+}
+
+var lastBeatTrack *trackAnalysis
+var lastBeatTime float64
+
+// pollMusicEvents checks the current song's analysis for kicks and beats that have played since it was last called
+func pollMusicEvents() musicEvents {
+	events := musicEvents{}
+	if audio.Muted(musicBus) {
+		lastBeatTrack = nil
+		return events
+	}
+
+	audio.backend.Lock()
+	track, now := music.beatPosition()
+	audio.backend.Unlock()
+
+	if track == nil {
+		lastBeatTrack = nil
+		return events
+	}
+
+	events.tracking = true
+	events.energy = track.energyAt(now)
+
+	if track != lastBeatTrack {
+		// new track, nothing has happened in it yet
+		lastBeatTrack = track
+		lastBeatTime = now
+		return events
+	}
+
+	from := lastBeatTime
+	lastBeatTime = now
+	if now < from {
+		// looped back round to the start
+		events.merge(track.eventsBetween(from, track.Duration))
+		from = -1.0
+	}
+	events.merge(track.eventsBetween(from, now))
+	return events
+}
+
+func (t *trackAnalysis) eventsBetween(from float64, to float64) musicEvents {
+	events := musicEvents{}
+	for _, k := range t.Kicks {
+		if k > from && k <= to {
+			events.kick = true
+			break
+		}
+	}
+
+	first, last := t.beatAt(from), t.beatAt(to)
+	for b := first + 1; b <= last; b++ {
+		if b < 0 {
+			continue
+		}
+		events.beat = true
+		if b%4 == 0 {
+			events.downbeat = true
+		}
+	}
+	return events
+}
+
+func (e *musicEvents) merge(other musicEvents) {
+	e.kick = e.kick || other.kick
+	e.beat = e.beat || other.beat
+	e.downbeat = e.downbeat || other.downbeat
+}
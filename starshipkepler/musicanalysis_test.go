@@ -0,0 +1,77 @@
+package starshipkepler
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseAnalysisStamp(t *testing.T) {
+	changed := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tracks := fstest.MapFS{
+		"embedded.ogg": {Data: make([]byte, 100)},
+		"override.ogg": {Data: make([]byte, 100), ModTime: changed},
+		"bigger.ogg":   {Data: make([]byte, 200), ModTime: changed},
+		"touched.ogg":  {Data: make([]byte, 100), ModTime: changed.Add(time.Second)},
+	}
+	stat := func(name string) fs.FileInfo {
+		info, err := fs.Stat(tracks, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	cases := []struct {
+		name     string
+		analysed string
+		source   string
+		ok       bool
+	}{
+		{"same track", "override.ogg", "override.ogg", true},
+		{"same embedded track", "embedded.ogg", "embedded.ogg", true},
+		{"resized", "override.ogg", "bigger.ogg", false},
+		{"touched", "override.ogg", "touched.ogg", false},
+		{"embedded track overridden", "embedded.ogg", "override.ogg", false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			analysed := &trackAnalysis{Version: analysisVersion, Bpm: 120}
+			analysed.stamp(stat(c.analysed))
+			data, _ := yaml.Marshal(analysed)
+
+			if got := parseAnalysis(data, stat(c.source)); (got != nil) != c.ok {
+				t.Errorf("expected the cache to be used: %v, got %v", c.ok, got != nil)
+			}
+		})
+	}
+}
+
+// Replacing a track in the music folder gets it analysed again, rather than using the old track's cache
+func TestAnalysisOfReplacedTrack(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.wav")
+	writeTestTrack(t, file, 8000, 0.5)
+
+	first := analyseFile(file)
+	if first == nil {
+		t.Fatal("the track wasn't analysed")
+	}
+	if _, err := os.Stat(file + analysisSuffix); err != nil {
+		t.Fatalf("expected the analysis to be cached: %s", err)
+	}
+
+	writeTestTrack(t, file, 16000, 0.5)
+	second := analyseFile(file)
+	if second == nil {
+		t.Fatal("the replaced track wasn't analysed")
+	}
+	if second.Duration <= first.Duration {
+		t.Errorf("expected the longer track to be analysed, got %.2fs then %.2fs", first.Duration, second.Duration)
+	}
+}
@@ -0,0 +1,169 @@
+package starshipkepler
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// The flow field covers the arena in cells, each knowing how far it is from the player going around
+// the obstacles. Enemies chasing the player just roll downhill.
+
+const flowFieldCellSize = 40.0
+
+// How wide a gap has to be for enemies to be sent through it
+const flowFieldClearance = 20.0
+
+// How often the field is rebuilt even if the player hasn't changed cell, so turning bars get picked up
+const flowFieldRefresh = 0.25
+
+type flowField struct {
+	arena  *Arena
+	bounds pixel.Rect
+	cols   int
+	rows   int
+
+	blocked  []bool
+	distance []float64
+
+	goal    int
+	sinceUp float64
+}
+
+func NewFlowField(arena *Arena) *flowField {
+	bounds := arena.Bounds()
+	f := &flowField{
+		arena:  arena,
+		bounds: bounds,
+		cols:   int(math.Ceil(bounds.W() / flowFieldCellSize)),
+		rows:   int(math.Ceil(bounds.H() / flowFieldCellSize)),
+		goal:   -1,
+	}
+	f.blocked = make([]bool, f.cols*f.rows)
+	f.distance = make([]float64, f.cols*f.rows)
+	return f
+}
+
+func (f *flowField) cell(v pixel.Vec) int {
+	col := int((v.X - f.bounds.Min.X) / flowFieldCellSize)
+	row := int((v.Y - f.bounds.Min.Y) / flowFieldCellSize)
+	if col < 0 || col >= f.cols || row < 0 || row >= f.rows {
+		return -1
+	}
+	return row*f.cols + col
+}
+
+func (f *flowField) centre(cell int) pixel.Vec {
+	return pixel.V(
+		f.bounds.Min.X+(float64(cell%f.cols)+0.5)*flowFieldCellSize,
+		f.bounds.Min.Y+(float64(cell/f.cols)+0.5)*flowFieldCellSize,
+	)
+}
+
+// Update rebuilds the field when the player moves into another cell, or every so often anyway
+func (f *flowField) Update(goal pixel.Vec, dt float64) {
+	if len(f.arena.obstacles) == 0 {
+		return
+	}
+	f.sinceUp += dt
+	cell := f.cell(goal)
+	if cell == f.goal && f.sinceUp < flowFieldRefresh {
+		return
+	}
+	f.goal = cell
+	f.sinceUp = 0
+
+	for i := range f.blocked {
+		f.blocked[i] = f.arena.Blocked(f.centre(i), flowFieldClearance)
+		f.distance[i] = math.Inf(1)
+	}
+	if cell < 0 {
+		return
+	}
+
+	// Dijkstra out from the player's cell, diagonals cost a bit more and can't cut blocked corners
+	f.distance[cell] = 0
+	open := &flowQueue{{cell, 0}}
+	for open.Len() > 0 {
+		current := heap.Pop(open).(flowQueueItem)
+		if current.distance > f.distance[current.cell] {
+			continue
+		}
+		col, row := current.cell%f.cols, current.cell/f.cols
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				next, ok := f.neighbour(col, row, dx, dy)
+				if !ok {
+					continue
+				}
+				distance := current.distance + math.Hypot(float64(dx), float64(dy))
+				if distance < f.distance[next] {
+					f.distance[next] = distance
+					heap.Push(open, flowQueueItem{next, distance})
+				}
+			}
+		}
+	}
+}
+
+// neighbour is the cell dx, dy away, if it can be moved into
+func (f *flowField) neighbour(col int, row int, dx int, dy int) (int, bool) {
+	if dx == 0 && dy == 0 {
+		return 0, false
+	}
+	c, r := col+dx, row+dy
+	if c < 0 || c >= f.cols || r < 0 || r >= f.rows || f.blocked[r*f.cols+c] {
+		return 0, false
+	}
+	if dx != 0 && dy != 0 && (f.blocked[row*f.cols+c] || f.blocked[r*f.cols+col]) {
+		return 0, false
+	}
+	return r*f.cols + c, true
+}
+
+// Direction is which way to go from a point to get to the goal. It's a straight line when
+// nothing's in the way, which is all there is to it in arenas without obstacles.
+func (f *flowField) Direction(from pixel.Vec, goal pixel.Vec) pixel.Vec {
+	straight := from.To(goal).Unit()
+	if len(f.arena.obstacles) == 0 || f.arena.LineOfSight(from, goal, flowFieldClearance) {
+		return straight
+	}
+	cell := f.cell(from)
+	if cell < 0 || math.IsInf(f.distance[cell], 1) {
+		return straight
+	}
+
+	col, row := cell%f.cols, cell/f.cols
+	best, bestDistance := -1, f.distance[cell]
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if next, ok := f.neighbour(col, row, dx, dy); ok && f.distance[next] < bestDistance {
+				best, bestDistance = next, f.distance[next]
+			}
+		}
+	}
+	if best < 0 {
+		return straight
+	}
+	return from.To(f.centre(best)).Unit()
+}
+
+type flowQueueItem struct {
+	cell     int
+	distance float64
+}
+
+// flowQueue is a priority queue of cells, closest first
+type flowQueue []flowQueueItem
+
+func (q flowQueue) Len() int            { return len(q) }
+func (q flowQueue) Less(i, j int) bool  { return q[i].distance < q[j].distance }
+func (q flowQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *flowQueue) Push(x interface{}) { *q = append(*q, x.(flowQueueItem)) }
+func (q *flowQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,65 @@
+package starshipkepler
+
+import (
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// followFlow walks from start towards goal the way a seeking enemy would, and says whether it got there
+// without going through anything
+func followFlow(t *testing.T, arena *Arena, start pixel.Vec, goal pixel.Vec) bool {
+	t.Helper()
+	f := NewFlowField(arena)
+	f.Update(goal, 0)
+
+	pos := start
+	for i := 0; i < 500; i++ {
+		if pos.To(goal).Len() < 10 {
+			return true
+		}
+		pos = pos.Add(f.Direction(pos, goal).Scaled(5))
+		if arena.Blocked(pos, 0) {
+			t.Fatalf("walked into an obstacle at %v after %d steps", pos, i)
+		}
+	}
+	return false
+}
+
+// With a pillar in the way, the field should send enemies round it rather than straight into it
+func TestFlowFieldRoutesAroundPillar(t *testing.T) {
+	arena := NewArena("pillars")
+	pillar := arena.Corners(360)[0]
+	start, goal := pillar.Sub(pixel.V(200, 0)), pillar.Add(pixel.V(200, 0))
+
+	if arena.LineOfSight(start, goal, flowFieldClearance) {
+		t.Fatal("expected the pillar to block the line of sight")
+	}
+	f := NewFlowField(arena)
+	f.Update(goal, 0)
+	if dir := f.Direction(start, goal); dir.Dot(pixel.V(1, 0)) > 0.99 {
+		t.Errorf("expected to be steered off the straight line, got %v", dir)
+	}
+	if !followFlow(t, arena, start, goal) {
+		t.Error("never got round the pillar")
+	}
+}
+
+// Through the gap between the walls, from one side of the arena to the other
+func TestFlowFieldRoutesThroughWalls(t *testing.T) {
+	arena := NewArena("walls")
+	if !followFlow(t, arena, pixel.V(-250, 300), pixel.V(250, 300)) {
+		t.Error("never got through the gap")
+	}
+}
+
+// Nothing in the way is just a straight line
+func TestFlowFieldLineOfSight(t *testing.T) {
+	arena := NewArena("pillars")
+	f := NewFlowField(arena)
+	start, goal := pixel.V(-100, 0), pixel.V(100, 50)
+	f.Update(goal, 0)
+	if dir := f.Direction(start, goal); dir != start.To(goal).Unit() {
+		t.Errorf("expected straight at the goal, got %v", dir)
+	}
+}
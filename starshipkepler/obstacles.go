@@ -0,0 +1,295 @@
+package starshipkepler
+
+import (
+	"math"
+
+	"github.com/faiface/pixel"
+	"golang.org/x/image/colornames"
+)
+
+// Obstacles are solid things inside the arena. They're all capsules (a line with a thickness,
+// rounded off at the ends) which covers walls, pillars (a capsule with no length) and bars.
+type obstacle struct {
+	kind     string // wall, pillar or bar
+	centre   pixel.Vec
+	length   float64 // end to end, not counting the rounded ends
+	radius   float64 // half the thickness
+	angle    float64
+	spin     float64 // radians per second, bars turn around their centre
+	ricochet bool    // bullets bounce off it instead of stopping
+}
+
+// How many points each rounded end gets when it's drawn
+const obstacleCapSegments = 12
+
+func NewWall(from pixel.Vec, to pixel.Vec, thickness float64) *obstacle {
+	return &obstacle{
+		kind:     "wall",
+		centre:   pixel.Lerp(from, to, 0.5),
+		length:   from.To(to).Len(),
+		radius:   thickness / 2,
+		angle:    from.To(to).Angle(),
+		ricochet: true,
+	}
+}
+
+func NewPillar(centre pixel.Vec, radius float64) *obstacle {
+	return &obstacle{kind: "pillar", centre: centre, radius: radius}
+}
+
+// NewBar is a wall that turns around its middle, spin radians a second
+func NewBar(centre pixel.Vec, length float64, thickness float64, spin float64) *obstacle {
+	return &obstacle{kind: "bar", centre: centre, length: length, radius: thickness / 2, spin: spin}
+}
+
+func (o *obstacle) Update(dt float64) {
+	o.angle = math.Mod(o.angle+o.spin*dt, 2*math.Pi)
+}
+
+// ends are the two ends of the line down the middle of the obstacle
+func (o *obstacle) ends() (pixel.Vec, pixel.Vec) {
+	half := pixel.V(o.length/2, 0).Rotated(o.angle)
+	return o.centre.Sub(half), o.centre.Add(half)
+}
+
+// closest is the point down the middle of the obstacle closest to v
+func (o *obstacle) closest(v pixel.Vec) pixel.Vec {
+	a, b := o.ends()
+	return closestOnSegment(v, a, b)
+}
+
+func closestOnSegment(v pixel.Vec, a pixel.Vec, b pixel.Vec) pixel.Vec {
+	ab := a.To(b)
+	if ab.Len() == 0 {
+		return a
+	}
+	t := math.Max(0, math.Min(1, a.To(v).Dot(ab)/ab.Dot(ab)))
+	return a.Add(ab.Scaled(t))
+}
+
+// segmentDistance is how close two line segments come to each other
+func segmentDistance(a1 pixel.Vec, a2 pixel.Vec, b1 pixel.Vec, b2 pixel.Vec) float64 {
+	d1, d2 := a1.To(a2), b1.To(b2)
+	denom := d1.Cross(d2)
+	if denom != 0 {
+		t := a1.To(b1).Cross(d2) / denom
+		u := a1.To(b1).Cross(d1) / denom
+		if t >= 0 && t <= 1 && u >= 0 && u <= 1 {
+			return 0
+		}
+	}
+	return math.Min(
+		math.Min(closestOnSegment(a1, b1, b2).To(a1).Len(), closestOnSegment(a2, b1, b2).To(a2).Len()),
+		math.Min(closestOnSegment(b1, a1, a2).To(b1).Len(), closestOnSegment(b2, a1, a2).To(b2).Len()),
+	)
+}
+
+// Overlap is which way, and how far, a circle has to move to get out of the obstacle
+func (o *obstacle) Overlap(v pixel.Vec, radius float64) (normal pixel.Vec, depth float64, hit bool) {
+	c := o.closest(v)
+	away := c.To(v)
+	depth = o.radius + radius - away.Len()
+	if depth <= 0 {
+		return pixel.ZV, 0, false
+	}
+	if away.Len() == 0 {
+		// dead centre, any way out will do
+		away = pixel.V(0, 1).Rotated(o.angle)
+	}
+	return away.Unit(), depth, true
+}
+
+// Outline goes around the obstacle, for drawing
+func (o *obstacle) Outline() []pixel.Vec {
+	a, b := o.ends()
+	points := make([]pixel.Vec, 0, obstacleCapSegments*2+2)
+	for i := 0; i <= obstacleCapSegments; i++ {
+		turn := math.Pi/2 + math.Pi*float64(i)/obstacleCapSegments
+		points = append(points, a.Add(pixel.V(o.radius, 0).Rotated(o.angle+turn)))
+	}
+	for i := 0; i <= obstacleCapSegments; i++ {
+		turn := -math.Pi/2 + math.Pi*float64(i)/obstacleCapSegments
+		points = append(points, b.Add(pixel.V(o.radius, 0).Rotated(o.angle+turn)))
+	}
+	return points
+}
+
+// Static is whether it stays put, so the grid can be pinned under it
+func (o *obstacle) Static() bool {
+	return o.spin == 0
+}
+
+// Fixed is whether v is under something that never moves: a static obstacle, or the hub a bar turns on
+func (a *Arena) Fixed(v pixel.Vec) bool {
+	for _, o := range a.obstacles {
+		if o.Static() {
+			if _, _, hit := o.Overlap(v, 0); hit {
+				return true
+			}
+		} else if o.centre.To(v).Len() < o.radius {
+			return true
+		}
+	}
+	return false
+}
+
+// Obstacles in the arena get turned by Update
+func (a *Arena) Update(dt float64) {
+	for _, o := range a.obstacles {
+		o.Update(dt)
+	}
+}
+
+// Obstacle is the first obstacle a circle overlaps, if any
+func (a *Arena) Obstacle(v pixel.Vec, radius float64) (*obstacle, pixel.Vec, float64) {
+	for _, o := range a.obstacles {
+		if normal, depth, hit := o.Overlap(v, radius); hit {
+			return o, normal, depth
+		}
+	}
+	return nil, pixel.ZV, 0
+}
+
+// sweep is how far along from -> to (0 to 1) a circle first touches the obstacle, if it does
+func (o *obstacle) sweep(from pixel.Vec, to pixel.Vec, radius float64) (float64, bool) {
+	a, b := o.ends()
+	reach := o.radius + radius
+	if segmentDistance(from, to, a, b) >= reach {
+		return 0, false
+	}
+	if closestOnSegment(from, a, b).To(from).Len() < reach {
+		return 0, true
+	}
+
+	move := from.To(to)
+	first := math.Inf(1)
+	// the flat sides
+	if a != b {
+		along := a.To(b).Unit()
+		side := along.Normal()
+		s, v := a.To(from).Dot(side), move.Dot(side)
+		if v != 0 {
+			for _, edge := range []float64{reach, -reach} {
+				t := (edge - s) / v
+				if p := from.Add(move.Scaled(t)); t >= 0 && t <= 1 {
+					if l := a.To(p).Dot(along); l >= 0 && l <= a.To(b).Len() {
+						first = math.Min(first, t)
+					}
+				}
+			}
+		}
+	}
+	// the rounded ends
+	for _, end := range []pixel.Vec{a, b} {
+		f := end.To(from)
+		qa, qb, qc := move.Dot(move), 2*f.Dot(move), f.Dot(f)-reach*reach
+		if disc := qb*qb - 4*qa*qc; qa > 0 && disc >= 0 {
+			if t := (-qb - math.Sqrt(disc)) / (2 * qa); t >= 0 && t <= 1 {
+				first = math.Min(first, t)
+			}
+		}
+	}
+	if math.IsInf(first, 1) {
+		return 0, false
+	}
+	return first, true
+}
+
+// Sweep is the first obstacle a circle going from -> to runs into, where it was when it touched, and
+// which way is out. Fast things check this rather than where they end up, which could be right through a wall.
+func (a *Arena) Sweep(from pixel.Vec, to pixel.Vec, radius float64) (*obstacle, pixel.Vec, pixel.Vec) {
+	var hit *obstacle
+	first := math.Inf(1)
+	for _, o := range a.obstacles {
+		if t, ok := o.sweep(from, to, radius); ok && t < first {
+			hit, first = o, t
+		}
+	}
+	if hit == nil {
+		return nil, to, pixel.ZV
+	}
+	at := pixel.Lerp(from, to, first)
+	normal := hit.closest(at).To(at)
+	if normal.Len() == 0 {
+		normal = from.To(to).Scaled(-1)
+	}
+	return hit, at, normal.Unit()
+}
+
+// Blocked is whether a circle there would be in an obstacle, or poking out of the arena
+func (a *Arena) Blocked(v pixel.Vec, radius float64) bool {
+	if a.Clamp(v, radius) != v {
+		return true
+	}
+	o, _, _ := a.Obstacle(v, radius)
+	return o != nil
+}
+
+// LineOfSight is whether something margin wide can go straight from one point to another without hitting an obstacle
+func (a *Arena) LineOfSight(from pixel.Vec, to pixel.Vec, margin float64) bool {
+	for _, o := range a.obstacles {
+		start, end := o.ends()
+		if segmentDistance(from, to, start, end) < o.radius+margin {
+			return false
+		}
+	}
+	return true
+}
+
+// Collide keeps a circle inside the arena and out of the obstacles. With bounce it comes off them
+// like a ball, otherwise it slides along them (the arena's edge just holds it in, like it always has).
+func (a *Arena) Collide(pos pixel.Vec, velocity pixel.Vec, radius float64, bounce bool) (pixel.Vec, pixel.Vec, bool) {
+	hit := false
+	if bounce {
+		pos, velocity, hit = a.Reflect(pos, velocity, radius)
+	} else if clamped := a.Clamp(pos, radius); clamped != pos {
+		pos, hit = clamped, true
+	}
+	pos, velocity, hitObstacle := a.Deflect(pos, velocity, radius, bounce)
+	return pos, velocity, hit || hitObstacle
+}
+
+// Deflect is Collide for just the obstacles
+func (a *Arena) Deflect(pos pixel.Vec, velocity pixel.Vec, radius float64, bounce bool) (pixel.Vec, pixel.Vec, bool) {
+	hit := false
+	for _, o := range a.obstacles {
+		normal, depth, overlapping := o.Overlap(pos, radius)
+		if !overlapping {
+			continue
+		}
+		hit = true
+		pos = pos.Add(normal.Scaled(depth))
+		if d := velocity.Dot(normal); d < 0 {
+			if bounce {
+				velocity = velocity.Sub(normal.Scaled(2 * d))
+			} else {
+				velocity = velocity.Sub(normal.Scaled(d))
+			}
+		}
+	}
+	return pos, velocity, hit
+}
+
+// bulletHitObstacle checks the way the bullet came this update for obstacles. Walls bounce it
+// back from where it hit, anything else stops it there.
+func (game *game) bulletHitObstacle(b *bullet) bool {
+	o, at, normal := game.data.arena.Sweep(b.from, b.data.origin, b.width/2)
+	if o == nil {
+		return false
+	}
+	b.data.origin = at
+	if !o.ricochet {
+		game.data.particles.Emit("bullet/edge", at, pixel.ZV, pixel.ToRGBA(colornames.Lightblue))
+		b.data.alive = false
+		return true
+	}
+	if _, depth, overlapping := o.Overlap(at, b.width/2); overlapping {
+		b.data.origin = at.Add(normal.Scaled(depth))
+	}
+	if d := b.velocity.Dot(normal); d < 0 {
+		b.velocity = b.velocity.Sub(normal.Scaled(2 * d))
+	}
+	b.data.orientation = b.velocity.Unit()
+	game.data.particles.Emit("bullet/ricochet", b.data.origin, normal, pixel.ToRGBA(colornames.Lightblue))
+	return true
+}
@@ -0,0 +1,98 @@
+package starshipkepler
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestObstacleSweep(t *testing.T) {
+	wall := NewWall(pixel.V(0, -100), pixel.V(0, 100), 32)
+	pillar := NewPillar(pixel.ZV, 50)
+	cases := []struct {
+		name     string
+		o        *obstacle
+		from, to pixel.Vec
+		hit      bool
+		t        float64
+	}{
+		{"straight through a wall", wall, pixel.V(-100, 0), pixel.V(100, 0), true, (100 - 16 - 4) / 200.0},
+		{"stopping short", wall, pixel.V(-100, 0), pixel.V(-30, 0), false, 0},
+		{"past the end", wall, pixel.V(-100, 150), pixel.V(100, 150), false, 0},
+		{"clipping the rounded end", wall, pixel.V(-100, 110), pixel.V(100, 110), true, (100 - math.Sqrt(20*20-10*10)) / 200},
+		{"starting inside", wall, pixel.V(5, 0), pixel.V(100, 0), true, 0},
+		{"through a pillar", pillar, pixel.V(0, -200), pixel.V(0, 200), true, (200 - 54) / 400.0},
+		{"missing a pillar", pillar, pixel.V(-200, 60), pixel.V(200, 60), false, 0},
+	}
+	for _, c := range cases {
+		got, hit := c.o.sweep(c.from, c.to, 4)
+		if hit != c.hit || (hit && math.Abs(got-c.t) > 1e-3) {
+			t.Errorf("%s: expected %v at %.4f, got %v at %.4f", c.name, c.hit, c.t, hit, got)
+		}
+	}
+}
+
+// A fast bullet at a low frame rate moves further than a wall is thick in one go. It should
+// still ricochet off it, and never turn up on the other side.
+func TestBulletsDontSkipThroughWalls(t *testing.T) {
+	game := newGoldenGame()
+	game.data.arena = NewArena("walls")
+	dt := 1.0 / 30
+
+	for _, y := range []float64{150, 270, 400} {
+		b := NewBullet(-200, y, 8, 20, 1600, pixel.V(1, 0), nil, 10, 1)
+		bounced := false
+		for step := 0; step < 30 && b.data.alive; step++ {
+			b.from = b.data.origin
+			b.data.origin = b.data.origin.Add(b.velocity.Scaled(dt))
+			if game.bulletHitObstacle(b) {
+				bounced = true
+			}
+			if b.data.origin.X > -16 {
+				t.Fatalf("y %.0f: the bullet got through the wall, it's at %v", y, b.data.origin)
+			}
+		}
+		if !bounced || b.velocity.X >= 0 {
+			t.Errorf("y %.0f: expected the bullet to ricochet back, its velocity is %v", y, b.velocity)
+		}
+	}
+}
+
+// Enemy shots stop at walls the same way
+func TestProjectilesDontSkipThroughWalls(t *testing.T) {
+	game := newGoldenGame()
+	game.data.arena = NewArena("walls")
+	game.data.player.origin = pixel.V(300, 270)
+	game.data.projectiles.Clear()
+
+	pool := game.data.projectiles
+	pool.spawn(projectile{origin: pixel.V(-200, 270), velocity: pixel.V(1600, 0), radius: 6, lifetime: 5})
+	for step := 0; step < 30; step++ {
+		game.updateProjectiles(1.0/30, &game.data.player)
+		for _, p := range pool.projectiles {
+			if p.alive && p.origin.X > -16 {
+				t.Fatalf("the shot got through the wall, it's at %v", p.origin)
+			}
+		}
+	}
+	if pool.count() != 0 {
+		t.Error("expected the shot to stop at the wall")
+	}
+	if !game.data.player.alive {
+		t.Error("the shot got to the player behind the wall")
+	}
+}
+
+func TestArenaRandomPointObstacles(t *testing.T) {
+	rand.Seed(1)
+	for _, name := range []string{"pillars", "walls", "windmill"} {
+		a := NewArena(name)
+		for i := 0; i < 500; i++ {
+			if v := a.RandomPoint(40); a.Blocked(v, 40) {
+				t.Fatalf("%s: %v is in an obstacle or too close to the edge", name, v)
+			}
+		}
+	}
+}
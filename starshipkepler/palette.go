@@ -0,0 +1,137 @@
+package starshipkepler
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/faiface/pixel"
+)
+
+// Element colours can be swapped for palettes that stay apart with colour blindness.
+// "standard" is the original elements map in config.go.
+var elementPalettes = map[string]map[string]color.RGBA{
+	"standard": elements,
+
+	// Red-green. Sticks to blues, oranges and yellows, and spreads them out by brightness
+	"deuteranopia": {
+		"water":     {0x00, 0x72, 0xb2, 0xff},
+		"chaos":     {0xcc, 0x79, 0xa7, 0xff},
+		"spirit":    {0xff, 0xff, 0xff, 0xff},
+		"fire":      {0xe6, 0x9f, 0x00, 0xff},
+		"lightning": {0xf0, 0xe4, 0x42, 0xff},
+		"wind":      {0x56, 0xb4, 0xe9, 0xff},
+		"life":      {0x00, 0x9e, 0x73, 0xff},
+	},
+	// Also red-green, but reds look darker, so chaos and fire are lifted
+	"protanopia": {
+		"water":     {0x00, 0x72, 0xb2, 0xff},
+		"chaos":     {0xff, 0x8c, 0xd0, 0xff},
+		"spirit":    {0xff, 0xff, 0xff, 0xff},
+		"fire":      {0xff, 0xb0, 0x00, 0xff},
+		"lightning": {0xf0, 0xf0, 0x80, 0xff},
+		"wind":      {0x56, 0xb4, 0xe9, 0xff},
+		"life":      {0x00, 0x9e, 0x73, 0xff},
+	},
+	// Blue-yellow. Sticks to reds, pinks and teals
+	"tritanopia": {
+		"water":     {0x00, 0x9c, 0xb0, 0xff},
+		"chaos":     {0xe0, 0x40, 0xa0, 0xff},
+		"spirit":    {0xff, 0xff, 0xff, 0xff},
+		"fire":      {0xe8, 0x10, 0x10, 0xff},
+		"lightning": {0xff, 0xc8, 0xd8, 0xff},
+		"wind":      {0x70, 0xe0, 0xd0, 0xff},
+		"life":      {0x3a, 0x7d, 0x44, 0xff},
+	},
+	// As far apart as colours get
+	"high-contrast": {
+		"water":     {0x00, 0x50, 0xff, 0xff},
+		"chaos":     {0xff, 0x00, 0xff, 0xff},
+		"spirit":    {0xff, 0xff, 0xff, 0xff},
+		"fire":      {0xff, 0x00, 0x00, 0xff},
+		"lightning": {0xff, 0xff, 0x00, 0xff},
+		"wind":      {0x00, 0xff, 0xff, 0xff},
+		"life":      {0x00, 0xff, 0x00, 0xff},
+	},
+}
+
+// The order the options menu cycles through them
+var elementPaletteNames = []string{"standard", "deuteranopia", "protanopia", "tritanopia", "high-contrast"}
+
+var elementPalette = "standard"
+
+// Glyphs are drawn over anything element coloured, so elements can be told apart by shape too
+var elementGlyphsOn = false
+
+// There aren't icons for every element, these are the closest
+var elementGlyphFiles = map[string]string{
+	"water":     "images/elements/water.png",
+	"chaos":     "images/elements/dark.png",
+	"spirit":    "images/elements/light.png",
+	"fire":      "images/elements/fire.png",
+	"lightning": "images/elements/lightning.png",
+	"wind":      "images/elements/cold.png",
+	"life":      "images/elements/earth.png",
+}
+
+// elementColour is the colour of an element in the current palette
+func elementColour(element string) color.RGBA {
+	if c, ok := elementPalettes[elementPalette][element]; ok {
+		return c
+	}
+	return elements[element]
+}
+
+// These are the colour of their element, so it's looked up each time they're drawn and follows the palette
+var elementColouredEntities = map[string]bool{
+	"essence":   true,
+	"blackhole": true,
+	"bubble":    true,
+	"turret":    true,
+	"sniper":    true,
+}
+
+// Colour is what the entity is drawn in right now
+func (e *entityData) Colour() color.Color {
+	if elementColouredEntities[e.entityType] && len(e.elements) > 0 {
+		return elementColour(e.elements[0])
+	}
+	return e.color
+}
+
+func SetElementPalette(name string) {
+	if _, ok := elementPalettes[name]; !ok {
+		fmt.Printf("[Palette] Unknown palette %s, keeping %s\n", name, elementPalette)
+		return
+	}
+	elementPalette = name
+}
+
+// cycleElementPalette steps through the palettes in menu order
+func cycleElementPalette(change int) {
+	for i, name := range elementPaletteNames {
+		if name == elementPalette {
+			n := len(elementPaletteNames)
+			SetElementPalette(elementPaletteNames[((i+change)%n+n)%n])
+			return
+		}
+	}
+	SetElementPalette("standard")
+}
+
+func loadElementGlyphs() map[string]pixel.Picture {
+	glyphs := map[string]pixel.Picture{}
+	for element, file := range elementGlyphFiles {
+		glyphs[element], _ = loadPicture(file)
+	}
+	return glyphs
+}
+
+// drawElementGlyph puts an element's icon size wide over pos, when glyphs are turned on
+func drawElementGlyph(r Renderer, art worldArt, element string, pos pixel.Vec, size float64) {
+	glyph, ok := art.glyphs[element]
+	if !elementGlyphsOn || !ok {
+		return
+	}
+	r.SetMatrix(pixel.IM.Scaled(pixel.ZV, size/glyph.Bounds().W()).Moved(pos))
+	r.Sprite(glyph, pixel.Alpha(0.9))
+}
@@ -0,0 +1,26 @@
+package starshipkepler
+
+import "testing"
+
+// Switching palettes should recolour enemies that are already out there, not just new ones
+func TestPaletteReachesLiveEntities(t *testing.T) {
+	defer SetElementPalette(elementPalette)
+	SetElementPalette("standard")
+
+	live := []*entityData{
+		NewBlackHole(0, 0), NewAngryBubble(0, 0), NewTurret(0, 0), NewSniper(0, 0),
+		NewEssence(0, 0, "wind", goldenEpoch),
+	}
+	SetElementPalette("high-contrast")
+	for _, e := range live {
+		want := elementPalettes["high-contrast"][e.elements[0]]
+		if got := e.Colour(); got != want {
+			t.Errorf("%s: expected %v, got %v", e.entityType, want, got)
+		}
+	}
+
+	// the rest keep their own colour
+	if f := NewFollower(0, 0); f.Colour() != f.color {
+		t.Errorf("follower: expected %v, got %v", f.color, f.Colour())
+	}
+}
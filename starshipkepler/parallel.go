@@ -0,0 +1,92 @@
+package starshipkepler
+
+import (
+	"runtime"
+	"sync"
+)
+
+// When set, particles and the grid are updated on the game loop instead of spread across cores
+var serialUpdates = false
+
+// SetSerialUpdates turns the worker pool off, for debugging or comparing against
+func SetSerialUpdates(serial bool) {
+	serialUpdates = serial
+}
+
+// Below this many items a job isn't worth handing out to the workers
+const minParallelItems = 256
+
+type workerJob struct {
+	fn   func(worker int, from int, to int)
+	id   int
+	from int
+	to   int
+	done *sync.WaitGroup
+}
+
+// workerPool keeps a goroutine per core (GOMAXPROCS) waiting for index ranges to work on
+type workerPool struct {
+	size int
+	jobs chan workerJob
+}
+
+var workers *workerPool
+
+func startWorkers() {
+	workers = &workerPool{
+		size: runtime.GOMAXPROCS(0),
+		jobs: make(chan workerJob, runtime.GOMAXPROCS(0)),
+	}
+	for i := 0; i < workers.size; i++ {
+		go func() {
+			for job := range workers.jobs {
+				job.fn(job.id, job.from, job.to)
+				job.done.Done()
+			}
+		}()
+	}
+}
+
+// parallelFor splits [0, n) into one range per worker and waits for them all to finish.
+// fn is told which range it's working on, so it can keep results separate without locking.
+func parallelFor(n int, fn func(worker int, from int, to int)) {
+	if serialUpdates || n < minParallelItems {
+		fn(0, 0, n)
+		return
+	}
+	if workers == nil {
+		startWorkers()
+	}
+	if workers.size == 1 {
+		fn(0, 0, n)
+		return
+	}
+
+	chunks := workers.size
+	size := (n + chunks - 1) / chunks
+	done := &sync.WaitGroup{}
+	for i := 0; i < chunks; i++ {
+		from := i * size
+		if from >= n {
+			break
+		}
+		to := from + size
+		if to > n {
+			to = n
+		}
+		done.Add(1)
+		workers.jobs <- workerJob{fn: fn, id: i, from: from, to: to, done: done}
+	}
+	done.Wait()
+}
+
+// parallelChunks is how many ranges parallelFor will use at most, for sizing per range results
+func parallelChunks() int {
+	if serialUpdates {
+		return 1
+	}
+	if workers == nil {
+		startWorkers()
+	}
+	return workers.size
+}
@@ -0,0 +1,231 @@
+package starshipkepler
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/faiface/pixel"
+)
+
+type particle struct {
+	origin      pixel.Vec
+	orientation float64
+	scale       pixel.Vec
+
+	colour      pixel.RGBA
+	duration    float64
+	percentLife float64
+
+	velocity         pixel.Vec
+	lengthMultiplier float64
+
+	alive bool
+}
+
+// particlePool is a fixed block of particles with a stack of the free slots,
+// so spawning and killing a particle never has to go looking for space.
+type particlePool struct {
+	particles []particle
+	free      []int
+
+	// particles that died this update, one list per worker
+	dead [][]int
+}
+
+func NewParticlePool(size int) *particlePool {
+	pool := &particlePool{
+		particles: make([]particle, size),
+		free:      make([]int, size),
+	}
+	// hand out the low slots first
+	for i := range pool.free {
+		pool.free[i] = size - 1 - i
+	}
+	return pool
+}
+
+// spawn takes a free slot for the particle. When the pool is full the particle is dropped.
+func (pool *particlePool) spawn(p particle) {
+	if len(pool.free) == 0 {
+		return
+	}
+	i := pool.free[len(pool.free)-1]
+	pool.free = pool.free[:len(pool.free)-1]
+
+	p.alive = true
+	pool.particles[i] = p
+}
+
+func (pool *particlePool) kill(i int) {
+	if !pool.particles[i].alive {
+		return
+	}
+	pool.particles[i] = particle{}
+	pool.free = append(pool.free, i)
+}
+
+func (pool *particlePool) count() int {
+	return len(pool.particles) - len(pool.free)
+}
+
+// Update moves every particle along by frames 60ths of a second, spread across the worker pool
+func (pool *particlePool) Update(frames float64, arena *Arena) {
+	if len(pool.dead) < parallelChunks() {
+		pool.dead = make([][]int, parallelChunks())
+	}
+	decay := math.Pow(0.97, frames)
+
+	parallelFor(len(pool.particles), func(worker int, from int, to int) {
+		dead := pool.dead[worker][:0]
+		for pID := from; pID < to; pID++ {
+			p := &pool.particles[pID]
+			if !p.alive {
+				continue
+			}
+			p.origin = p.origin.Add(p.velocity.Scaled(frames))
+
+			// bounce off the edges of the arena, and anything in it
+			p.origin, p.velocity, _ = arena.Collide(p.origin, p.velocity, 0, true)
+
+			p.orientation = p.velocity.Angle()
+
+			p.percentLife -= frames / p.duration
+
+			speed := p.velocity.Len()
+			alpha := math.Min(1, math.Min(p.percentLife*2, speed*1.0))
+			alpha *= alpha
+			p.colour.A = alpha
+			p.scale.X = p.lengthMultiplier * math.Min(math.Min(1.0, 0.2*speed+0.1), alpha)
+
+			if math.Abs(p.velocity.X)+math.Abs(p.velocity.Y) < 0.00000001 {
+				p.velocity = pixel.ZV
+			}
+
+			p.velocity = p.velocity.Scaled(decay)
+
+			if p.percentLife <= 0 {
+				dead = append(dead, pID)
+			}
+		}
+		pool.dead[worker] = dead
+	})
+
+	// the free list isn't safe to touch from the workers, so the dead are only returned to it here
+	for worker, dead := range pool.dead {
+		for _, pID := range dead {
+			pool.kill(pID)
+		}
+		pool.dead[worker] = dead[:0]
+	}
+}
+
+// particlePreset describes an effect, so gameplay code only has to say what and where.
+//
+// The shape decides which way the particles go: a burst goes in every direction, a ring is evenly
+// spaced around a circle at full speed, a spray fans out in a cone around the emit direction, and a
+// trail follows the emit direction, wobbling a little to the side.
+type particlePreset struct {
+	shape string
+	count int
+
+	// Speeds are in pixels per frame. For sprays and trails they're multiples of the emit direction instead.
+	minSpeed float64
+	maxSpeed float64
+	// 0 spreads speeds evenly between min and max, higher values bunch them up towards max
+	curve float64
+
+	spread float64 // cone angle for sprays, sideways wobble for trails
+
+	// When no colour is given the preset picks a random hue, and each particle varies from it by up to hueRange
+	hueRange   float64
+	saturation float64
+	glow       float64 // slower particles are washed out towards white by this much
+
+	lifetime float64 // in frames
+	scale    pixel.Vec
+	length   float64
+}
+
+var particlePresets = map[string]particlePreset{
+	// The generic shapes
+	"burst": {shape: "burst", count: 120, maxSpeed: 24, curve: 10, hueRange: 1.5, saturation: 0.5, lifetime: 64, scale: pixel.V(1.5, 1.5), length: 1.8},
+	"spray": {shape: "spray", count: 16, minSpeed: 0.5, maxSpeed: 1.5, spread: math.Pi / 8, saturation: 0.5, lifetime: 48, scale: pixel.V(1.0, 1.0), length: 1.0},
+	"trail": {shape: "trail", count: 1, minSpeed: 1, maxSpeed: 1, saturation: 0.7, lifetime: 32, scale: pixel.V(0.5, 1.0), length: 1.0},
+	"ring":  {shape: "ring", count: 64, minSpeed: 12, maxSpeed: 12, saturation: 0.5, lifetime: 48, scale: pixel.V(1.0, 1.0), length: 2.0},
+
+	// Explosions
+	"player/die":        {shape: "burst", count: 1200, maxSpeed: 24, curve: 32, lifetime: 100, scale: pixel.V(1.5, 1.5), length: 2.5},
+	"player/bomb":       {shape: "burst", count: 1000, maxSpeed: 48, curve: 32, lifetime: 100, scale: pixel.V(1.5, 1.5), length: 2.0},
+	"entity/die":        {shape: "burst", count: 120, maxSpeed: 24, curve: 10, hueRange: 1.5, saturation: 0.5, lifetime: 64, scale: pixel.V(1.5, 1.5), length: 1.8},
+	"blackhole/hit":     {shape: "burst", count: 64, maxSpeed: 32, curve: 10, hueRange: 1.5, saturation: 0.5, lifetime: 64, scale: pixel.V(1.0, 1.0), length: 3.0},
+	"blackhole/die":     {shape: "burst", count: 1024, maxSpeed: 32, curve: 10, glow: 3.0, lifetime: 64, scale: pixel.V(1.0, 1.0), length: 3.0},
+	"bullet/edge":       {shape: "ring", count: 30, minSpeed: 5, maxSpeed: 5, lifetime: 32, scale: pixel.V(1.0, 1.0), length: 1.0},
+	"bullet/ricochet":   {shape: "spray", count: 12, minSpeed: 3, maxSpeed: 6, spread: math.Pi / 2, lifetime: 24, scale: pixel.V(1.0, 1.0), length: 1.0},
+	"projectile/die":    {shape: "ring", count: 16, minSpeed: 3, maxSpeed: 3, lifetime: 24, scale: pixel.V(1.0, 1.0), length: 1.0},
+	"projectile/cancel": {shape: "burst", count: 48, maxSpeed: 12, curve: 8, glow: 1.5, lifetime: 40, scale: pixel.V(1.0, 1.0), length: 1.5},
+
+	// Streams
+	"blackhole/spray": {shape: "spray", count: 1, minSpeed: 6, maxSpeed: 18, lifetime: 128, scale: pixel.V(1.5, 1.5), length: 2.0},
+	"ship/exhaust":    {shape: "trail", count: 1, minSpeed: 1, maxSpeed: 1, lifetime: 32, scale: pixel.V(0.5, 1.0), length: 1.0},
+	"ship/wake":       {shape: "trail", count: 1, minSpeed: 1, maxSpeed: 1, lifetime: 24, scale: pixel.V(1.0, 1.0), length: 1.0},
+	"ship/boost":      {shape: "trail", count: 1, minSpeed: 1, maxSpeed: 1, lifetime: 32, scale: pixel.V(1.0, 1.0), length: 2.0},
+	"ship/target":     {shape: "burst", count: 1, minSpeed: 1, maxSpeed: 1, lifetime: 32, scale: pixel.V(0.5, 1.0), length: 1.0},
+	"enemy/wake":      {shape: "trail", count: 1, maxSpeed: 2, lifetime: 48, scale: pixel.V(0.5, 1.0), length: 1.0},
+}
+
+// Emit fires a preset at pos. dir aims sprays and trails, and is ignored by bursts and rings.
+// Each particle takes a random one of the colours, or a random hue if there aren't any.
+func (pool *particlePool) Emit(name string, pos pixel.Vec, dir pixel.Vec, colours ...pixel.RGBA) {
+	// config var
+	if !particlesOn {
+		return
+	}
+	preset, ok := particlePresets[name]
+	if !ok {
+		return
+	}
+
+	baseHue := rand.Float64() * 6.0
+	for i := 0; i < preset.count; i++ {
+		t := rand.Float64()
+		if preset.curve > 0 {
+			t = 1.0 - 1.0/(t*preset.curve+1.0)
+		}
+		speed := preset.minSpeed + (preset.maxSpeed-preset.minSpeed)*t
+
+		var velocity pixel.Vec
+		switch preset.shape {
+		case "ring":
+			velocity = pixel.V(speed, 0).Rotated(2.0 * math.Pi * float64(i) / float64(preset.count))
+		case "spray":
+			velocity = dir.Rotated((rand.Float64() - 0.5) * preset.spread).Scaled(speed)
+		case "trail":
+			velocity = dir.Scaled(speed)
+			if preset.spread > 0 {
+				velocity = velocity.Add(randomVector(preset.spread))
+			}
+		default:
+			velocity = randomVector(speed)
+		}
+
+		var colour pixel.RGBA
+		if len(colours) > 0 {
+			colour = colours[rand.Intn(len(colours))]
+		} else {
+			colour = HSVToColor(math.Mod(baseHue+rand.Float64()*preset.hueRange, 6.0), preset.saturation, 1.0)
+		}
+		if preset.glow > 0 && preset.maxSpeed > 0 {
+			colour = colour.Add(pixel.Alpha((1.0 - speed/preset.maxSpeed) * preset.glow))
+		}
+
+		pool.spawn(particle{
+			origin:           pos,
+			colour:           colour,
+			duration:         preset.lifetime,
+			percentLife:      1.0,
+			scale:            preset.scale,
+			velocity:         velocity,
+			lengthMultiplier: preset.length,
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package starshipkepler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/nathanKramer/starship-kepler/sliceextra"
+	"gopkg.in/yaml.v3"
+)
+
+// The user's music folder has a folder of tracks for each mode (menu, evolved, pacifism...),
+// which replaces that mode's music. An optional playlists.yml sets how each one plays:
+//
+//	evolved:
+//	  shuffle: true
+//	  repeat: true
+//	  volume: -0.3
+const playlistFile = "playlists.yml"
+
+type playlistConfig struct {
+	Shuffle bool    `yaml:"shuffle"`
+	Repeat  *bool   `yaml:"repeat"` // defaults to true
+	Volume  float64 `yaml:"volume"`
+}
+
+var musicFolder string
+
+// SetMusicFolder points the game at the user's own music. Call it before InitAudio.
+func SetMusicFolder(dir string) {
+	musicFolder = dir
+}
+
+func loadPlaylists(dir string, format beep.Format) {
+	if dir == "" {
+		return
+	}
+
+	folders, err := ioutil.ReadDir(dir)
+	if err != nil {
+		fmt.Printf("[Music] Couldn't read music folder: %s\n", err)
+		return
+	}
+
+	configs := map[string]playlistConfig{}
+	data, err := ioutil.ReadFile(filepath.Join(dir, playlistFile))
+	if err == nil {
+		err = yaml.Unmarshal(data, &configs)
+		if err != nil {
+			fmt.Printf("[Music] Couldn't read %s: %s\n", playlistFile, err)
+		}
+	}
+
+	for _, folder := range folders {
+		if !folder.IsDir() {
+			continue
+		}
+
+		name := folder.Name()
+		files := []string{}
+		entries, _ := ioutil.ReadDir(filepath.Join(dir, name))
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if !entry.IsDir() && sliceextra.Contains(audioExtensions, ext) {
+				files = append(files, filepath.Join(dir, name, entry.Name()))
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+		sort.Strings(files)
+
+		conf := configs[name]
+		repeat := conf.Repeat == nil || *conf.Repeat
+		p := newPlaylist(files, conf.Shuffle, repeat, format)
+
+		music.songs[name] = &song{
+			name: name,
+			layers: []*musicLayer{{
+				source:    p,
+				streamer:  p,
+				amplitude: math.Pow(10, conf.Volume),
+				fadeStep:  1.0,
+			}},
+			period:    format.SampleRate.N(time.Second / 2), // no tempo to go by, 120bpm is as good as any
+			levelStep: 1.0 / (music.crossfade * float64(format.SampleRate)),
+		}
+		fmt.Printf("[Music] %s: playing %d tracks from %s\n", name, len(files), filepath.Join(dir, name))
+	}
+}
+
+// playlist streams a list of files one after another. The next track is opened in the background
+// while the current one plays, so the audio thread never has to wait on the disk or a decoder.
+type playlist struct {
+	files   []string
+	shuffle bool
+	repeat  bool
+	format  beep.Format
+
+	order    []int
+	index    int
+	current  beep.StreamSeekCloser
+	streamer beep.Streamer
+	file     string
+	pending  chan *openedTrack // the next track, once it's opened. nil when there's nothing left to open
+	failures int               // tracks in a row that wouldn't open or played nothing
+	finished bool
+
+	analysisMu sync.Mutex
+	analysis   map[string]*trackAnalysis
+	trackPos   int // samples played of the current track
+}
+
+type openedTrack struct {
+	file     string
+	current  beep.StreamSeekCloser
+	streamer beep.Streamer
+}
+
+func newPlaylist(files []string, shuffle bool, repeat bool, format beep.Format) *playlist {
+	p := &playlist{
+		files:    files,
+		shuffle:  shuffle,
+		repeat:   repeat,
+		format:   format,
+		analysis: map[string]*trackAnalysis{},
+	}
+	p.Seek(0)
+	return p
+}
+
+func (p *playlist) reorder() {
+	p.order = make([]int, len(p.files))
+	for i := range p.order {
+		p.order[i] = i
+	}
+	if p.shuffle {
+		rand.Shuffle(len(p.order), func(i, j int) {
+			p.order[i], p.order[j] = p.order[j], p.order[i]
+		})
+	}
+	p.index = 0
+}
+
+// queue starts opening the next track in the order, leaving pending nil when there's nothing left
+func (p *playlist) queue() {
+	if p.index >= len(p.order) {
+		if !p.repeat {
+			return
+		}
+		p.reorder()
+	}
+
+	file := p.files[p.order[p.index]]
+	p.index++
+
+	ready := make(chan *openedTrack, 1)
+	p.pending = ready
+	go func() {
+		t := openTrack(file, p.format)
+		ready <- t
+		if t != nil {
+			p.analyse(file)
+		}
+	}()
+}
+
+// analyse works out a track's beat grid the first time it's opened. Decoding a whole track takes a while,
+// so it's done off the audio thread, and the track just has no beat grid until it's finished.
+func (p *playlist) analyse(file string) {
+	p.analysisMu.Lock()
+	_, started := p.analysis[file]
+	if !started {
+		p.analysis[file] = nil
+	}
+	p.analysisMu.Unlock()
+	if started {
+		return
+	}
+
+	t := analyseFile(file)
+	p.analysisMu.Lock()
+	p.analysis[file] = t
+	p.analysisMu.Unlock()
+}
+
+// openTrack opens and decodes a file, resampling it to the playlist's rate. It returns nil if the file won't play.
+func openTrack(file string, format beep.Format) *openedTrack {
+	f, err := os.Open(file)
+	if err != nil {
+		fmt.Printf("[Music] %s\n", err)
+		return nil
+	}
+	streamer, trackFormat, err := decodeAudio(file, f)
+	if err != nil {
+		fmt.Printf("[Music] Couldn't play %s: %s\n", file, err)
+		f.Close()
+		return nil
+	}
+
+	t := &openedTrack{file: file, current: streamer, streamer: streamer}
+	if trackFormat.SampleRate != format.SampleRate {
+		t.streamer = beep.Resample(4, trackFormat.SampleRate, format.SampleRate, streamer)
+	}
+	return t
+}
+
+// next swaps to the track that's been opened in the background, and starts opening the one after.
+// It returns false if that track isn't ready yet, or there's nothing left to play.
+func (p *playlist) next() bool {
+	for !p.finished {
+		if p.pending == nil {
+			p.finished = true
+			return false
+		}
+
+		var t *openedTrack
+		select {
+		case t = <-p.pending:
+		default:
+			return false
+		}
+		p.pending = nil
+		p.queue()
+
+		if t == nil {
+			p.failed()
+			continue
+		}
+		p.current = t.current
+		p.streamer = t.streamer
+		p.file = t.file
+		p.trackPos = 0
+		return true
+	}
+	return false
+}
+
+// failed counts a track that wouldn't play, giving up once none of them will
+func (p *playlist) failed() {
+	p.failures++
+	if p.failures >= len(p.files) {
+		p.finished = true
+	}
+}
+
+func (p *playlist) closeCurrent() {
+	if p.current != nil {
+		p.current.Close()
+		p.current = nil
+		p.streamer = nil
+		p.file = ""
+	}
+}
+
+// closePending throws away the track being opened, closing it whenever it turns up
+func (p *playlist) closePending() {
+	if p.pending == nil {
+		return
+	}
+	go func(pending chan *openedTrack) {
+		if t := <-pending; t != nil {
+			t.current.Close()
+		}
+	}(p.pending)
+	p.pending = nil
+}
+
+func (p *playlist) Stream(samples [][2]float64) (n int, ok bool) {
+	for n < len(samples) && !p.finished {
+		if p.current == nil && !p.next() {
+			if !p.finished {
+				// the next track is still opening, play silence rather than wait for it
+				for i := n; i < len(samples); i++ {
+					samples[i] = [2]float64{}
+				}
+				n = len(samples)
+			}
+			break
+		}
+		sn, sok := p.streamer.Stream(samples[n:])
+		n += sn
+		p.trackPos += sn
+		if sn > 0 {
+			p.failures = 0
+		}
+		if !sok || sn == 0 {
+			p.closeCurrent()
+		}
+
+		// don't spin forever on a folder of tracks that play nothing
+		if sn == 0 {
+			p.failed()
+		}
+	}
+	return n, n > 0
+}
+
+func (p *playlist) Err() error { return nil }
+
+func (p *playlist) beatPosition() (*trackAnalysis, float64) {
+	if p.current == nil {
+		return nil, 0
+	}
+	p.analysisMu.Lock()
+	t := p.analysis[p.file]
+	p.analysisMu.Unlock()
+	if t == nil {
+		return nil, 0
+	}
+	return t, float64(p.trackPos) / float64(p.format.SampleRate)
+}
+
+// Len is 0 as the length of a playlist isn't known up front
+func (p *playlist) Len() int { return 0 }
+
+func (p *playlist) Position() int { return 0 }
+
+// Seek can only go back to the start, which reshuffles
+func (p *playlist) Seek(pos int) error {
+	if pos != 0 {
+		return fmt.Errorf("playlists can only seek to the start")
+	}
+	p.closeCurrent()
+	p.closePending()
+	p.reorder()
+	p.failures = 0
+	p.finished = false
+	p.queue()
+	return nil
+}
+
+func (p *playlist) Close() error {
+	p.closeCurrent()
+	p.closePending()
+	return nil
+}
@@ -0,0 +1,123 @@
+package starshipkepler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/wav"
+)
+
+var testPlaylistFormat = beep.Format{SampleRate: 8000, NumChannels: 2, Precision: 2}
+
+// writeTestTrack writes a wav of n samples all at the same level
+func writeTestTrack(t *testing.T, path string, n int, level float64) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tone := beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		if n <= 0 {
+			return 0, false
+		}
+		count := len(samples)
+		if count > n {
+			count = n
+		}
+		for i := range samples[:count] {
+			samples[i] = [2]float64{level, level}
+		}
+		n -= count
+		return count, true
+	})
+	if err := wav.Encode(f, tone, testPlaylistFormat); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tracks open in the background, so streaming hands out silence until they're ready rather than waiting
+func TestPlaylistWaitsInSilence(t *testing.T) {
+	p := &playlist{files: []string{"never.wav"}, format: testPlaylistFormat, pending: make(chan *openedTrack)}
+	samples := make([][2]float64, 64)
+	for i := range samples {
+		samples[i] = [2]float64{1, 1}
+	}
+
+	n, ok := p.Stream(samples)
+	if n != len(samples) || !ok {
+		t.Fatalf("expected %d samples of silence, got %d, %v", len(samples), n, ok)
+	}
+	for i, s := range samples {
+		if s != [2]float64{} {
+			t.Fatalf("expected silence, sample %d is %v", i, s)
+		}
+	}
+}
+
+// Every track that opens gets played in full, one after another, and broken ones are skipped
+func TestPlaylistPlaysThrough(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTrack(t, filepath.Join(dir, "a.wav"), 300, 0.5)
+	if err := ioutil.WriteFile(filepath.Join(dir, "b.wav"), []byte("not a wav"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeTestTrack(t, filepath.Join(dir, "c.wav"), 500, 0.25)
+	files := []string{filepath.Join(dir, "a.wav"), filepath.Join(dir, "b.wav"), filepath.Join(dir, "c.wav")}
+
+	p := newPlaylist(files, false, false, testPlaylistFormat)
+	defer p.Close()
+
+	loud, quiet := 0, 0
+	samples := make([][2]float64, 64)
+	deadline := time.Now().Add(5 * time.Second)
+	for !p.finished {
+		if time.Now().After(deadline) {
+			t.Fatalf("playlist never finished, heard %d loud and %d quiet samples", loud, quiet)
+		}
+		n, _ := p.Stream(samples)
+		for _, s := range samples[:n] {
+			// the decoder doesn't give back quite the level that was written, but a is still the louder one
+			if s[0] > 0.18 {
+				loud++
+			} else if s[0] > 0 {
+				quiet++
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if loud != 300 || quiet != 500 {
+		t.Errorf("expected 300 samples of a and 500 of c, got %d and %d", loud, quiet)
+	}
+}
+
+// Tracks aren't analysed up front. Once one's opened its beat grid turns up, and gets cached next to it.
+func TestPlaylistAnalysesInBackground(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.wav")
+	writeTestTrack(t, file, 8000, 0.5)
+
+	p := newPlaylist([]string{file}, false, true, testPlaylistFormat)
+	defer p.Close()
+
+	samples := make([][2]float64, 64)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if time.Now().After(deadline) {
+			t.Fatal("the track was never analysed")
+		}
+		p.Stream(samples)
+		if track, _ := p.beatPosition(); track != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := os.Stat(file + analysisSuffix); err != nil {
+		t.Errorf("expected the analysis to be cached: %s", err)
+	}
+}
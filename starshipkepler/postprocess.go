@@ -0,0 +1,251 @@
+package starshipkepler
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/faiface/glhf"
+	"github.com/faiface/mainthread"
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/pixelgl"
+	"golang.org/x/image/colornames"
+	"gopkg.in/yaml.v3"
+)
+
+const postProcessingFile = "shaders/postprocessing.yml"
+
+// How often to look for changed shaders
+const postProcessingReloadInterval = 500 * time.Millisecond
+
+// postPassConfig is one entry in postprocessing.yml, see there for what each field does
+type postPassConfig struct {
+	Name      string             `yaml:"name"`
+	Shader    string             `yaml:"shader"`
+	Inputs    []string           `yaml:"inputs"`
+	Blend     string             `yaml:"blend"`
+	Uniforms  map[string]float64 `yaml:"uniforms"`
+	Downscale float64            `yaml:"downscale"`
+	Fallback  string             `yaml:"fallback"`
+	Enabled   *bool              `yaml:"enabled"`
+}
+
+type postProcessingConfig struct {
+	Passes []postPassConfig `yaml:"passes"`
+}
+
+type postPass struct {
+	config postPassConfig
+	canvas *pixelgl.Canvas
+
+	// The shader has to be given pointers to its uniforms, these stay put while the pass does
+	uniforms map[string]*float32
+
+	shaderTime time.Time // when the shader file last changed, if it's in the -assets directory
+	shaded     bool      // whether the canvas has the pass's shader, or is just copying
+}
+
+// postProcessor runs the scene through the chain of passes in postprocessing.yml
+type postProcessor struct {
+	bounds pixel.Rect
+	passes []*postPass
+
+	configTime time.Time
+	lastCheck  time.Time
+}
+
+func NewPostProcessor(bounds pixel.Rect) *postProcessor {
+	pp := &postProcessor{bounds: bounds}
+	pp.load()
+	return pp
+}
+
+func (pp *postProcessor) load() {
+	pp.passes = nil
+	pp.configTime = assets.ModTime(postProcessingFile)
+
+	data, err := assets.ReadFile(postProcessingFile)
+	if err != nil {
+		// Without any passes the scene goes straight to the screen
+		assets.Placeholder(postProcessingFile, err)
+		return
+	}
+	config := postProcessingConfig{}
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		assets.Placeholder(postProcessingFile, err)
+		return
+	}
+
+	previous := "scene"
+	for _, passConfig := range config.Passes {
+		if passConfig.Enabled != nil && !*passConfig.Enabled {
+			continue
+		}
+		if len(passConfig.Inputs) == 0 {
+			passConfig.Inputs = []string{previous}
+		}
+		if passConfig.Downscale < 1 {
+			passConfig.Downscale = 1
+		}
+		previous = passConfig.Name
+
+		pass := &postPass{
+			config:   passConfig,
+			canvas:   pixelgl.NewCanvas(pp.passBounds(passConfig)),
+			uniforms: map[string]*float32{},
+		}
+		pass.canvas.SetSmooth(passConfig.Downscale > 1)
+		for name, value := range passConfig.Uniforms {
+			v := float32(value)
+			pass.uniforms[name] = &v
+			pass.canvas.SetUniform(uniformName(name), pass.uniforms[name])
+		}
+		pass.loadShader()
+		pp.passes = append(pp.passes, pass)
+	}
+	fmt.Printf("[PostFX] %d passes\n", len(pp.passes))
+}
+
+// threshold is handed to the shader as uThreshold
+func uniformName(name string) string {
+	if name == "" {
+		return name
+	}
+	return "u" + strings.ToUpper(name[:1]) + name[1:]
+}
+
+func (pp *postProcessor) passBounds(config postPassConfig) pixel.Rect {
+	w := math.Max(1, math.Round(pp.bounds.W()/config.Downscale))
+	h := math.Max(1, math.Round(pp.bounds.H()/config.Downscale))
+	return pixel.R(-w/2, -h/2, w/2, h/2)
+}
+
+// loadShader compiles the pass's shader onto its canvas. If it won't load or compile,
+// whatever the canvas had before (the last good version, or nothing) is kept.
+func (pass *postPass) loadShader() {
+	if pass.config.Shader == "" {
+		return
+	}
+	pass.shaderTime = assets.ModTime(pass.config.Shader)
+
+	src, err := loadFileToString(pass.config.Shader)
+	if err != nil {
+		assets.Placeholder(pass.config.Shader, err)
+		return
+	}
+	err = checkShader(src)
+	if err != nil {
+		fmt.Printf("[PostFX] %s: %s won't compile, keeping the last one that did: %v\n", pass.config.Name, pass.config.Shader, err)
+		return
+	}
+	pass.canvas.SetFragmentShader(src)
+	pass.shaded = true
+}
+
+// The vertex shader pixel gives every canvas, which fragment shaders are linked against
+const canvasVertexShader = `
+#version 330 core
+
+in vec2  aPosition;
+in vec4  aColor;
+in vec2  aTexCoords;
+in float aIntensity;
+
+out vec4  vColor;
+out vec2  vTexCoords;
+out float vIntensity;
+out vec2  vPosition;
+
+uniform mat3 uTransform;
+uniform vec4 uBounds;
+
+void main() {
+	vec2 transPos = (uTransform * vec3(aPosition, 1.0)).xy;
+	vec2 normPos = (transPos - uBounds.xy) / uBounds.zw * 2 - vec2(1, 1);
+	gl_Position = vec4(normPos, 0.0, 1.0);
+	vColor = aColor;
+	vPosition = aPosition;
+	vTexCoords = aTexCoords;
+	vIntensity = aIntensity;
+}
+`
+
+var canvasVertexFormat = glhf.AttrFormat{
+	{Name: "aPosition", Type: glhf.Vec2},
+	{Name: "aColor", Type: glhf.Vec4},
+	{Name: "aTexCoords", Type: glhf.Vec2},
+	{Name: "aIntensity", Type: glhf.Float},
+}
+
+// checkShader compiles a fragment shader on its own first. Pixel panics on the main thread
+// when a canvas's shader doesn't compile, and there's no recovering from that.
+func checkShader(src string) error {
+	return mainthread.CallErr(func() error {
+		_, err := glhf.NewShader(canvasVertexFormat, glhf.AttrFormat{}, canvasVertexShader, src)
+		return err
+	})
+}
+
+// Update picks up any shaders (or the config) saved since it last looked
+func (pp *postProcessor) Update() {
+	if time.Since(pp.lastCheck) < postProcessingReloadInterval {
+		return
+	}
+	pp.lastCheck = time.Now()
+
+	if !assets.ModTime(postProcessingFile).Equal(pp.configTime) {
+		fmt.Printf("[PostFX] Reloading %s\n", postProcessingFile)
+		pp.load()
+		return
+	}
+	for _, pass := range pp.passes {
+		if pass.config.Shader != "" && !assets.ModTime(pass.config.Shader).Equal(pass.shaderTime) {
+			fmt.Printf("[PostFX] Reloading %s\n", pass.config.Shader)
+			pass.loadShader()
+		}
+	}
+}
+
+// Resize keeps the passes the same size as the screen, without recompiling anything
+func (pp *postProcessor) Resize(bounds pixel.Rect) {
+	pp.bounds = bounds
+	for _, pass := range pp.passes {
+		pass.canvas.SetBounds(pp.passBounds(pass.config))
+	}
+}
+
+// drawStretched draws a canvas over the whole of a target that's bounds big
+func drawStretched(c *pixelgl.Canvas, target pixel.Target, bounds pixel.Rect) {
+	c.Draw(target, pixel.IM.ScaledXY(pixel.ZV, pixel.V(
+		bounds.W()/c.Bounds().W(),
+		bounds.H()/c.Bounds().H(),
+	)).Moved(bounds.Center()))
+}
+
+// Apply runs the scene through every pass, and returns the canvas the last one drew to
+func (pp *postProcessor) Apply(scene *pixelgl.Canvas) *pixelgl.Canvas {
+	outputs := map[string]*pixelgl.Canvas{"scene": scene}
+	result := scene
+
+	for _, pass := range pp.passes {
+		pass.canvas.Clear(colornames.Black)
+		outputs[pass.config.Name] = pass.canvas
+		result = pass.canvas
+		if !pass.shaded && pass.config.Shader != "" && pass.config.Fallback == "blank" {
+			continue
+		}
+
+		pass.canvas.SetComposeMethod(pixel.ComposeOver)
+		if pass.config.Blend == "add" {
+			pass.canvas.SetComposeMethod(pixel.ComposePlus)
+		}
+		for _, input := range pass.config.Inputs {
+			if c, ok := outputs[input]; ok && c != pass.canvas {
+				drawStretched(c, pass.canvas, pass.canvas.Bounds())
+			}
+		}
+	}
+	return result
+}
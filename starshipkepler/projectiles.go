@@ -0,0 +1,239 @@
+package starshipkepler
+
+import (
+	"math"
+
+	"github.com/faiface/pixel"
+	"golang.org/x/image/colornames"
+)
+
+// ENEMY PROJECTILES
+
+// The player's bullets are entities with a weapon behind them. Enemy shots are simpler, they go in a
+// straight line until they hit something, so they get a pool of their own like the particles do.
+
+type projectile struct {
+	origin   pixel.Vec
+	velocity pixel.Vec // pixels per second
+	radius   float64
+	shape    string // orb, needle or star
+	element  string // a ward of the same element soaks it up, "" for none
+	angle    float64
+	spin     float64 // radians per second, for the shapes that turn
+	age      float64
+	lifetime float64 // seconds
+
+	alive bool
+}
+
+type projectilePool struct {
+	projectiles []projectile
+	free        []int
+}
+
+func NewProjectilePool(size int) *projectilePool {
+	pool := &projectilePool{
+		projectiles: make([]projectile, size),
+		free:        make([]int, size),
+	}
+	for i := range pool.free {
+		pool.free[i] = size - 1 - i
+	}
+	return pool
+}
+
+// spawn takes a free slot for the projectile. When the pool is full the shot just doesn't happen.
+func (pool *projectilePool) spawn(p projectile) {
+	if len(pool.free) == 0 {
+		return
+	}
+	i := pool.free[len(pool.free)-1]
+	pool.free = pool.free[:len(pool.free)-1]
+
+	p.alive = true
+	pool.projectiles[i] = p
+}
+
+func (pool *projectilePool) kill(i int) {
+	if !pool.projectiles[i].alive {
+		return
+	}
+	pool.projectiles[i] = projectile{}
+	pool.free = append(pool.free, i)
+}
+
+func (pool *projectilePool) count() int {
+	return len(pool.projectiles) - len(pool.free)
+}
+
+// Clear gets rid of every projectile, e.g. when the player dies
+func (pool *projectilePool) Clear() {
+	for i := range pool.projectiles {
+		pool.kill(i)
+	}
+}
+
+// projectilePreset is how a particular enemy's shot looks and behaves
+type projectilePreset struct {
+	shape    string
+	speed    float64 // pixels per second
+	radius   float64
+	lifetime float64 // seconds
+	count    int     // fired at once, fanned out across spread
+	spread   float64 // radians, a full circle spaces them evenly all the way round
+	spin     float64
+}
+
+var projectilePresets = map[string]projectilePreset{
+	"turret/shot": {shape: "orb", speed: 300, radius: 10, lifetime: 6, count: 3, spread: math.Pi / 8},
+	"sniper/shot": {shape: "needle", speed: 950, radius: 6, lifetime: 3, count: 1},
+	"boss/volley": {shape: "star", speed: 240, radius: 14, lifetime: 8, count: 16, spread: 2 * math.Pi, spin: 4},
+}
+
+// Fire lets off a preset's worth of projectiles from pos, aimed along dir
+func (pool *projectilePool) Fire(name string, pos pixel.Vec, dir pixel.Vec, element string) {
+	preset, ok := projectilePresets[name]
+	if !ok {
+		return
+	}
+	for i := 0; i < preset.count; i++ {
+		offset := 0.0
+		if preset.spread >= 2*math.Pi {
+			offset = 2 * math.Pi * float64(i) / float64(preset.count)
+		} else if preset.count > 1 {
+			offset = preset.spread * (float64(i)/float64(preset.count-1) - 0.5)
+		}
+		velocity := dir.Unit().Rotated(offset).Scaled(preset.speed)
+		pool.spawn(projectile{
+			origin:   pos,
+			velocity: velocity,
+			radius:   preset.radius,
+			shape:    preset.shape,
+			element:  element,
+			angle:    velocity.Angle(),
+			spin:     preset.spin,
+			lifetime: preset.lifetime,
+		})
+	}
+}
+
+// Shooters: seconds between shots, how far out snipers like to sit, and how long they take aim
+const turretFireRate = 1.8
+const sniperFireRate = 2.6
+const sniperRange = 450.0
+const sniperAimTime = 0.6
+
+// Elements that cancel each other out when a bullet meets a projectile
+var opposingElements = [][2]string{
+	{"water", "fire"},
+	{"spirit", "chaos"},
+	{"life", "chaos"},
+	{"wind", "lightning"},
+}
+
+func opposed(a string, b string) bool {
+	for _, pair := range opposingElements {
+		if (pair[0] == a && pair[1] == b) || (pair[0] == b && pair[1] == a) {
+			return true
+		}
+	}
+	return false
+}
+
+func projectileColour(p *projectile) pixel.RGBA {
+	if p.element == "" {
+		return pixel.ToRGBA(colornames.White)
+	}
+	return pixel.ToRGBA(elementColour(p.element))
+}
+
+// enemyFire is an enemy shooting at dir, carrying its own element
+func (game *game) enemyFire(e *entityData, name string, dir pixel.Vec) {
+	element := ""
+	if len(e.elements) > 0 {
+		element = e.elements[0]
+	}
+	game.data.projectiles.Fire(name, e.origin.Add(dir.Unit().Scaled(e.radius)), dir, element)
+	PlaySoundAt("enemy/shoot", e.origin)
+}
+
+func (game *game) updateProjectiles(dt float64, player *entityData) {
+	pool := game.data.projectiles
+	for i := range pool.projectiles {
+		p := &pool.projectiles[i]
+		if !p.alive {
+			continue
+		}
+		p.age += dt
+		if p.age >= p.lifetime {
+			pool.kill(i)
+			continue
+		}
+		from := p.origin
+		p.origin = p.origin.Add(p.velocity.Scaled(dt))
+		p.angle += p.spin * dt
+
+		// a lighter ripple than the player's bullets, so they read as someone else's
+		game.grid.ApplyExplosiveForce(p.velocity.Scaled(dt).Len()*0.4, Vector3{p.origin.X, p.origin.Y, 0.0}, 40.0)
+
+		if o, at, _ := game.data.arena.Sweep(from, p.origin, p.radius); o != nil {
+			p.origin = at
+			game.data.particles.Emit("projectile/die", p.origin, pixel.ZV, projectileColour(p))
+			pool.kill(i)
+			continue
+		}
+		if !game.data.arena.Contains(p.origin) {
+			game.data.particles.Emit("projectile/die", p.origin, pixel.ZV, projectileColour(p))
+			pool.kill(i)
+			continue
+		}
+
+		if game.cancelProjectile(p) {
+			pool.kill(i)
+			continue
+		}
+
+		if player.alive && p.origin.To(player.origin).Len() < p.radius+player.radius {
+			game.projectileHitPlayer(p, player)
+			pool.kill(i)
+		}
+	}
+}
+
+// cancelProjectile is whether a bullet carrying the opposing element ran into it, taking the bullet out too
+func (game *game) cancelProjectile(p *projectile) bool {
+	if p.element == "" {
+		return false
+	}
+	for bID, b := range game.data.bullets {
+		if !b.data.alive || b.data.origin.To(p.origin).Len() > p.radius+b.width/2+b.length/2 {
+			continue
+		}
+		for _, el := range b.data.elements {
+			if opposed(el, p.element) {
+				b.data.alive = false
+				game.data.bullets[bID] = b
+				PlaySoundAt("projectile/cancel", p.origin)
+				game.data.particles.Emit("projectile/cancel", p.origin, pixel.ZV, projectileColour(p), pixel.ToRGBA(elementColour(el)))
+				game.grid.ApplyExplosiveForce(40, Vector3{p.origin.X, p.origin.Y, 0.0}, 80.0)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// projectileHitPlayer works like running into an enemy: a ward of the same element soaks it up, otherwise it's fatal
+func (game *game) projectileHitPlayer(p *projectile, player *entityData) {
+	for i, el := range player.elements {
+		if el == p.element {
+			player.elements = append(player.elements[:i], player.elements[i+1:]...)
+			PlaySound("ward/die")
+			game.data.particles.Emit("projectile/die", p.origin, pixel.ZV, projectileColour(p))
+			return
+		}
+	}
+	if !g_debug {
+		game.killPlayer(player, game.lastFrame)
+	}
+}
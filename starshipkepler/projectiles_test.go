@@ -0,0 +1,69 @@
+package starshipkepler
+
+import (
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestOpposed(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"water", "fire", true},
+		{"fire", "water", true},
+		{"spirit", "chaos", true},
+		{"chaos", "life", true},
+		{"lightning", "wind", true},
+		{"fire", "fire", false},
+		{"spirit", "life", false},
+		{"water", "lightning", false},
+		{"fire", "", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		if got := opposed(c.a, c.b); got != c.want {
+			t.Errorf("opposed(%q, %q) = %v, expected %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+// A ward of the same element soaks the shot up, anything else and the player's dead
+func TestProjectileHitPlayer(t *testing.T) {
+	cases := []struct {
+		name    string
+		wards   []string
+		element string
+		alive   bool
+		left    []string
+	}{
+		{"matching ward", []string{"water", "fire"}, "fire", true, []string{"water"}},
+		{"first of two", []string{"fire", "fire"}, "fire", true, []string{"fire"}},
+		{"other ward", []string{"water"}, "fire", false, []string{"water"}},
+		{"no wards", nil, "fire", false, nil},
+		{"no element", []string{"fire"}, "", false, []string{"fire"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			game := newGoldenGame()
+			player := &game.data.player
+			player.elements = append([]string(nil), c.wards...)
+
+			p := &projectile{origin: player.origin, velocity: pixel.V(300, 0), radius: 10, element: c.element, alive: true}
+			game.projectileHitPlayer(p, player)
+
+			if player.alive != c.alive {
+				t.Errorf("expected alive to be %v", c.alive)
+			}
+			if len(player.elements) != len(c.left) {
+				t.Fatalf("expected wards %v, got %v", c.left, player.elements)
+			}
+			for i := range c.left {
+				if player.elements[i] != c.left[i] {
+					t.Errorf("expected wards %v, got %v", c.left, player.elements)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package starshipkepler
+
+import (
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// projection is the 3D camera the grid is seen through. It looks at target from a distance that keeps the
+// flat, resting grid at its normal size in the middle of the view, so only the tilt and the grid's Z change things.
+type projection struct {
+	mode string  // top-down, floor or dynamic
+	fov  float64 // vertical field of view, in radians
+	tilt float64 // how far the camera leans back from looking straight down, in radians
+	yaw  float64 // which way the camera leans, 0 is from below the arena looking up it
+
+	target pixel.Vec
+	lean   pixel.Vec // for dynamic mode, eases towards the player's velocity
+}
+
+// How far the dynamic camera leans at full speed
+const maxDynamicTilt = 0.35
+
+func NewProjection(mode string) projection {
+	p := projection{mode: mode, fov: 30 * math.Pi / 180}
+	switch mode {
+	case "floor":
+		p.fov = 50 * math.Pi / 180
+		p.tilt = 35 * math.Pi / 180
+	case "dynamic":
+		p.fov = 45 * math.Pi / 180
+	}
+	return p
+}
+
+// Update follows the camera, and for dynamic mode leans in the direction the player is going
+func (p *projection) Update(target pixel.Vec, playerVelocity pixel.Vec, playerSpeed float64, dt float64) {
+	p.target = target
+	if p.mode != "dynamic" {
+		return
+	}
+
+	lean := pixel.ZV
+	if playerSpeed > 0 {
+		lean = playerVelocity.Scaled(1.0 / playerSpeed)
+		if lean.Len() > 1.0 {
+			lean = lean.Unit()
+		}
+	}
+	p.lean = pixel.Lerp(p.lean, lean, 1-math.Pow(1.0/16, dt))
+	p.tilt = p.lean.Len() * maxDynamicTilt
+	if p.lean.Len() > 0.0001 {
+		p.yaw = p.lean.Angle() - math.Pi/2
+	}
+}
+
+// distance from the camera to the target, so that a view worldHeight tall fits the field of view
+func (p projection) distance() float64 {
+	return (worldHeight / 2) / math.Tan(p.fov/2)
+}
+
+// Project takes a point on (or bulging off) the grid to where it appears on the arena
+func (p projection) Project(v Vector3) pixel.Vec {
+	d := p.distance()
+
+	// into the camera's frame, with the lean along Y
+	q := pixel.V(v.X, v.Y).Sub(p.target).Rotated(-p.yaw)
+	sin, cos := math.Sin(p.tilt), math.Cos(p.tilt)
+
+	depth := d + q.Y*sin - v.Z*cos
+	// don't let anything come round behind the camera
+	depth = math.Max(depth, d*0.05)
+
+	screen := pixel.V(q.X, q.Y*cos+v.Z*sin).Scaled(d / depth)
+	return screen.Rotated(p.yaw).Add(p.target)
+}
@@ -0,0 +1,142 @@
+package starshipkepler
+
+import (
+	"image/color"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"github.com/faiface/pixel/pixelgl"
+	"github.com/faiface/pixel/text"
+)
+
+// Renderer is what the world is drawn through, so it can go to the window or to an image.
+//
+// Shapes are given in world space, and go through the matrix set with SetMatrix, then the camera.
+// Their colour is multiplied by the colour mask. A thickness of 0 fills the shape in.
+type Renderer interface {
+	Clear(colour color.Color)
+	SetCamera(m pixel.Matrix)
+	SetMatrix(m pixel.Matrix)
+	SetColorMask(mask color.Color)
+	SetComposeMethod(method pixel.ComposeMethod)
+
+	// Line joins the points up in order
+	Line(colour color.Color, thickness float64, points ...pixel.Vec)
+	// Polygon is a closed Line, or filled when thickness is 0
+	Polygon(colour color.Color, thickness float64, points ...pixel.Vec)
+	Rectangle(colour color.Color, thickness float64, min pixel.Vec, max pixel.Vec)
+	Circle(colour color.Color, thickness float64, centre pixel.Vec, radius float64)
+	// CircleArc goes from the low angle to the high angle, clockwise if high is less than low
+	CircleArc(colour color.Color, thickness float64, centre pixel.Vec, radius float64, low float64, high float64)
+	// Text is centred on pos, with pos on the baseline
+	Text(colour color.Color, pos pixel.Vec, scale float64, s string)
+	// Sprite draws the whole picture centred on the origin, tinted by colour
+	Sprite(pic pixel.Picture, colour color.Color)
+
+	// Flush finishes drawing anything still batched up
+	Flush()
+}
+
+// canvasRenderer batches shapes into an IMDraw, and draws them onto the canvas whenever
+// something (text, sprites, the camera or compose method) has to go straight to the canvas.
+type canvasRenderer struct {
+	canvas *pixelgl.Canvas
+	imd    *imdraw.IMDraw
+	txt    *text.Text
+
+	sprites map[pixel.Picture]*pixel.Sprite
+	matrix  pixel.Matrix
+	mask    pixel.RGBA
+}
+
+func NewCanvasRenderer(canvas *pixelgl.Canvas, font *text.Atlas) *canvasRenderer {
+	return &canvasRenderer{
+		canvas:  canvas,
+		imd:     imdraw.New(nil),
+		txt:     text.New(pixel.ZV, font),
+		sprites: map[pixel.Picture]*pixel.Sprite{},
+		matrix:  pixel.IM,
+		mask:    pixel.Alpha(1),
+	}
+}
+
+func (r *canvasRenderer) Clear(colour color.Color) {
+	r.imd.Clear()
+	r.canvas.Clear(colour)
+}
+
+func (r *canvasRenderer) SetCamera(m pixel.Matrix) {
+	r.Flush()
+	r.canvas.SetMatrix(m)
+}
+
+func (r *canvasRenderer) SetMatrix(m pixel.Matrix) {
+	r.matrix = m
+	r.imd.SetMatrix(m)
+}
+
+func (r *canvasRenderer) SetColorMask(mask color.Color) {
+	r.mask = pixel.ToRGBA(mask)
+	r.imd.SetColorMask(mask)
+}
+
+func (r *canvasRenderer) SetComposeMethod(method pixel.ComposeMethod) {
+	r.Flush()
+	r.canvas.SetComposeMethod(method)
+}
+
+func (r *canvasRenderer) Line(colour color.Color, thickness float64, points ...pixel.Vec) {
+	r.imd.Color = colour
+	r.imd.Push(points...)
+	r.imd.Line(thickness)
+}
+
+func (r *canvasRenderer) Polygon(colour color.Color, thickness float64, points ...pixel.Vec) {
+	r.imd.Color = colour
+	r.imd.Push(points...)
+	r.imd.Polygon(thickness)
+}
+
+func (r *canvasRenderer) Rectangle(colour color.Color, thickness float64, min pixel.Vec, max pixel.Vec) {
+	r.imd.Color = colour
+	r.imd.Push(min, max)
+	r.imd.Rectangle(thickness)
+}
+
+func (r *canvasRenderer) Circle(colour color.Color, thickness float64, centre pixel.Vec, radius float64) {
+	r.imd.Color = colour
+	r.imd.Push(centre)
+	r.imd.Circle(radius, thickness)
+}
+
+func (r *canvasRenderer) CircleArc(colour color.Color, thickness float64, centre pixel.Vec, radius float64, low float64, high float64) {
+	r.imd.Color = colour
+	r.imd.Push(centre)
+	r.imd.CircleArc(radius, low, high, thickness)
+}
+
+func (r *canvasRenderer) Text(colour color.Color, pos pixel.Vec, scale float64, s string) {
+	r.Flush()
+	r.txt.Clear()
+	r.txt.Orig = pos
+	r.txt.Dot = pos
+	r.txt.Dot.X -= r.txt.BoundsOf(s).W() / 2
+	r.txt.Color = colour
+	r.txt.WriteString(s)
+	r.txt.DrawColorMask(r.canvas, pixel.IM.Scaled(pos, scale).Chained(r.matrix), r.mask)
+}
+
+func (r *canvasRenderer) Sprite(pic pixel.Picture, colour color.Color) {
+	r.Flush()
+	sprite, ok := r.sprites[pic]
+	if !ok {
+		sprite = pixel.NewSprite(pic, pic.Bounds())
+		r.sprites[pic] = sprite
+	}
+	sprite.DrawColorMask(r.canvas, r.matrix, pixel.ToRGBA(colour).Mul(r.mask))
+}
+
+func (r *canvasRenderer) Flush() {
+	r.imd.Draw(r.canvas)
+	r.imd.Clear()
+}
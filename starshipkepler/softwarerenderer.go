@@ -0,0 +1,286 @@
+package starshipkepler
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/faiface/pixel"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// softwareRenderer draws into an image without a GPU, so frames can be checked on machines without one.
+// It doesn't anti-alias or bloom, and text is always the built in bitmap font, so it won't match the
+// window exactly, just closely enough to tell when something's changed.
+type softwareRenderer struct {
+	img *image.RGBA
+
+	camera  pixel.Matrix
+	matrix  pixel.Matrix
+	mask    pixel.RGBA
+	compose pixel.ComposeMethod
+
+	// world space -> camera -> pixels, kept up to date by SetCamera and SetMatrix
+	transform pixel.Matrix
+	pictures  map[pixel.Picture]*pixel.PictureData
+	crossings []float64
+}
+
+// NewSoftwareRenderer makes a width x height image with the origin in the middle, like the canvases
+func NewSoftwareRenderer(width int, height int) *softwareRenderer {
+	r := &softwareRenderer{
+		img:      image.NewRGBA(image.Rect(0, 0, width, height)),
+		camera:   pixel.IM,
+		matrix:   pixel.IM,
+		mask:     pixel.Alpha(1),
+		compose:  pixel.ComposeOver,
+		pictures: map[pixel.Picture]*pixel.PictureData{},
+	}
+	r.updateTransform()
+	return r
+}
+
+func (r *softwareRenderer) Image() *image.RGBA {
+	return r.img
+}
+
+func (r *softwareRenderer) updateTransform() {
+	// images go down from the top left, the world goes up from the middle
+	w, h := float64(r.img.Bounds().Dx()), float64(r.img.Bounds().Dy())
+	screen := pixel.IM.ScaledXY(pixel.ZV, pixel.V(1, -1)).Moved(pixel.V(w/2, h/2))
+	r.transform = r.matrix.Chained(r.camera).Chained(screen)
+}
+
+// scale is roughly how much the transform grows lengths by, for thicknesses and radiuses
+func (r *softwareRenderer) scale() float64 {
+	return r.transform.Project(pixel.V(1, 0)).Sub(r.transform.Project(pixel.ZV)).Len()
+}
+
+func (r *softwareRenderer) Clear(colour color.Color) {
+	c := color.RGBAModel.Convert(colour).(color.RGBA)
+	for i := 0; i < len(r.img.Pix); i += 4 {
+		r.img.Pix[i], r.img.Pix[i+1], r.img.Pix[i+2], r.img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+}
+
+func (r *softwareRenderer) SetCamera(m pixel.Matrix) {
+	r.camera = m
+	r.updateTransform()
+}
+
+func (r *softwareRenderer) SetMatrix(m pixel.Matrix) {
+	r.matrix = m
+	r.updateTransform()
+}
+
+func (r *softwareRenderer) SetColorMask(mask color.Color) {
+	r.mask = pixel.ToRGBA(mask)
+}
+
+func (r *softwareRenderer) SetComposeMethod(method pixel.ComposeMethod) {
+	r.compose = method
+}
+
+func (r *softwareRenderer) Flush() {}
+
+// blend mixes one pixel in, colours are alpha premultiplied like pixel's
+func (r *softwareRenderer) blend(x int, y int, c pixel.RGBA) {
+	if !(image.Point{x, y}.In(r.img.Bounds())) {
+		return
+	}
+	i := r.img.PixOffset(x, y)
+	dst := r.img.Pix[i : i+4 : i+4]
+	keep := 1 - c.A
+	if r.compose == pixel.ComposePlus {
+		keep = 1
+	}
+	for j, v := range [4]float64{c.R, c.G, c.B, c.A} {
+		out := v*255 + float64(dst[j])*keep
+		dst[j] = uint8(math.Round(math.Max(0, math.Min(255, out))))
+	}
+}
+
+func (r *softwareRenderer) colour(colour color.Color) pixel.RGBA {
+	return pixel.ToRGBA(colour).Mul(r.mask)
+}
+
+// fill scanline fills a polygon already in image space, taking each pixel whose centre is inside
+func (r *softwareRenderer) fill(points []pixel.Vec, c pixel.RGBA) {
+	if len(points) < 3 {
+		return
+	}
+	minY, maxY := points[0].Y, points[0].Y
+	for _, p := range points {
+		minY = math.Min(minY, p.Y)
+		maxY = math.Max(maxY, p.Y)
+	}
+	from := int(math.Max(0, math.Ceil(minY-0.5)))
+	to := int(math.Min(float64(r.img.Bounds().Dy()-1), math.Ceil(maxY-0.5)-1))
+
+	for y := from; y <= to; y++ {
+		cy := float64(y) + 0.5
+		r.crossings = r.crossings[:0]
+		for i, a := range points {
+			b := points[(i+1)%len(points)]
+			if (a.Y <= cy) != (b.Y <= cy) {
+				r.crossings = append(r.crossings, a.X+(cy-a.Y)/(b.Y-a.Y)*(b.X-a.X))
+			}
+		}
+		sort.Float64s(r.crossings)
+		for i := 0; i+1 < len(r.crossings); i += 2 {
+			left := int(math.Max(0, math.Ceil(r.crossings[i]-0.5)))
+			right := int(math.Min(float64(r.img.Bounds().Dx()-1), math.Ceil(r.crossings[i+1]-0.5)-1))
+			for x := left; x <= right; x++ {
+				r.blend(x, y, c)
+			}
+		}
+	}
+}
+
+// segment is a thick line between two points already in image space
+func (r *softwareRenderer) segment(a pixel.Vec, b pixel.Vec, thickness float64, c pixel.RGBA) {
+	along := b.Sub(a)
+	if along.Len() == 0 {
+		return
+	}
+	side := along.Unit().Normal().Scaled(thickness / 2)
+	r.fill([]pixel.Vec{a.Add(side), b.Add(side), b.Sub(side), a.Sub(side)}, c)
+}
+
+func (r *softwareRenderer) polyline(c pixel.RGBA, thickness float64, closed bool, points []pixel.Vec) {
+	projected := make([]pixel.Vec, len(points))
+	for i, p := range points {
+		projected[i] = r.transform.Project(p)
+	}
+	if thickness == 0 {
+		r.fill(projected, c)
+		return
+	}
+	thickness *= r.scale()
+	for i := 0; i+1 < len(projected); i++ {
+		r.segment(projected[i], projected[i+1], thickness, c)
+	}
+	if closed && len(projected) > 2 {
+		r.segment(projected[len(projected)-1], projected[0], thickness, c)
+	}
+}
+
+func (r *softwareRenderer) Line(colour color.Color, thickness float64, points ...pixel.Vec) {
+	r.polyline(r.colour(colour), thickness, false, points)
+}
+
+func (r *softwareRenderer) Polygon(colour color.Color, thickness float64, points ...pixel.Vec) {
+	r.polyline(r.colour(colour), thickness, true, points)
+}
+
+func (r *softwareRenderer) Rectangle(colour color.Color, thickness float64, min pixel.Vec, max pixel.Vec) {
+	r.polyline(r.colour(colour), thickness, true, []pixel.Vec{min, pixel.V(min.X, max.Y), max, pixel.V(max.X, min.Y)})
+}
+
+func (r *softwareRenderer) Circle(colour color.Color, thickness float64, centre pixel.Vec, radius float64) {
+	r.arc(r.colour(colour), thickness, centre, radius, 0, 2*math.Pi)
+}
+
+func (r *softwareRenderer) CircleArc(colour color.Color, thickness float64, centre pixel.Vec, radius float64, low float64, high float64) {
+	r.arc(r.colour(colour), thickness, centre, radius, low, high)
+}
+
+// arc takes every pixel within the ring (or disc, for thickness 0) and between the angles
+func (r *softwareRenderer) arc(c pixel.RGBA, thickness float64, centre pixel.Vec, radius float64, low float64, high float64) {
+	scale := r.scale()
+	mid := r.transform.Project(centre)
+	inner, outer := 0.0, radius*scale
+	if thickness > 0 {
+		inner = (radius - thickness/2) * scale
+		outer = (radius + thickness/2) * scale
+	}
+
+	// angles are measured in world space, so undo the image being upside down
+	rotation := r.matrix.Project(pixel.V(1, 0)).Sub(r.matrix.Project(pixel.ZV)).Angle()
+	span := high - low
+	full := math.Abs(span) >= 2*math.Pi
+
+	for y := int(math.Floor(mid.Y - outer)); y <= int(math.Ceil(mid.Y+outer)); y++ {
+		for x := int(math.Floor(mid.X - outer)); x <= int(math.Ceil(mid.X+outer)); x++ {
+			d := pixel.V(float64(x)+0.5-mid.X, mid.Y-(float64(y)+0.5))
+			dist := d.Len()
+			if dist > outer || dist < inner {
+				continue
+			}
+			if !full {
+				angle := d.Angle() - rotation - low
+				if span < 0 {
+					angle = -angle
+				}
+				if math.Mod(angle+4*math.Pi, 2*math.Pi) > math.Abs(span) {
+					continue
+				}
+			}
+			r.blend(x, y, c)
+		}
+	}
+}
+
+// sample covers the area of bounds (in world space, before the matrix) with colours from at
+func (r *softwareRenderer) sample(bounds pixel.Rect, at func(pixel.Vec) (pixel.RGBA, bool)) {
+	corners := bounds.Vertices()
+	area := pixel.R(math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1))
+	for _, corner := range corners {
+		p := r.transform.Project(corner)
+		area.Min = pixel.V(math.Min(area.Min.X, p.X), math.Min(area.Min.Y, p.Y))
+		area.Max = pixel.V(math.Max(area.Max.X, p.X), math.Max(area.Max.Y, p.Y))
+	}
+
+	for y := int(math.Floor(area.Min.Y)); y <= int(math.Ceil(area.Max.Y)); y++ {
+		for x := int(math.Floor(area.Min.X)); x <= int(math.Ceil(area.Max.X)); x++ {
+			p := r.transform.Unproject(pixel.V(float64(x)+0.5, float64(y)+0.5))
+			if !bounds.Contains(p) {
+				continue
+			}
+			if c, ok := at(p); ok {
+				r.blend(x, y, c)
+			}
+		}
+	}
+}
+
+func (r *softwareRenderer) Text(colour color.Color, pos pixel.Vec, scale float64, s string) {
+	face := basicfont.Face7x13
+	width := font.MeasureString(face, s).Ceil()
+	ascent, descent := face.Metrics().Ascent.Ceil(), face.Metrics().Descent.Ceil()
+	if width == 0 {
+		return
+	}
+
+	glyphs := image.NewAlpha(image.Rect(0, 0, width, ascent+descent))
+	drawer := font.Drawer{Dst: glyphs, Src: image.Opaque, Face: face, Dot: fixed.P(0, ascent)}
+	drawer.DrawString(s)
+
+	c := r.colour(colour)
+	matrix := r.matrix
+	r.SetMatrix(pixel.IM.Scaled(pos, scale).Chained(matrix))
+	left := pos.X - float64(width)/2
+	r.sample(pixel.R(left, pos.Y-float64(descent), left+float64(width), pos.Y+float64(ascent)), func(p pixel.Vec) (pixel.RGBA, bool) {
+		a := glyphs.AlphaAt(int(p.X-left), ascent-int(math.Ceil(p.Y-pos.Y))).A
+		return c.Scaled(float64(a) / 255), a > 0
+	})
+	r.SetMatrix(matrix)
+}
+
+func (r *softwareRenderer) Sprite(pic pixel.Picture, colour color.Color) {
+	data, ok := r.pictures[pic]
+	if !ok {
+		data = pixel.PictureDataFromPicture(pic)
+		r.pictures[pic] = data
+	}
+
+	c := r.colour(colour)
+	centre := data.Bounds().Center()
+	r.sample(data.Bounds().Moved(centre.Scaled(-1)), func(p pixel.Vec) (pixel.RGBA, bool) {
+		texel := data.Color(p.Add(centre))
+		return texel.Mul(c), texel.A > 0
+	})
+}
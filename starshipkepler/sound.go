@@ -2,98 +2,115 @@ package starshipkepler
 
 import (
 	"fmt"
-	"os"
+	"io"
+	"math"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/faiface/beep"
 	"github.com/faiface/beep/effects"
+	"github.com/faiface/beep/flac"
 	"github.com/faiface/beep/mp3"
-	"github.com/faiface/beep/speaker"
+	"github.com/faiface/beep/vorbis"
 	"github.com/faiface/beep/wav"
+	"github.com/faiface/pixel"
 )
 
-var soundFormat *beep.Format
-var shotSoundFormat *beep.Format
-var shotBuffer *beep.Buffer
-var shotBuffer2 *beep.Buffer
-var shotBuffer3 *beep.Buffer
-var shotBuffer4 *beep.Buffer
-var spawnBuffer *beep.Buffer
-var spawnBuffer2 *beep.Buffer
-var spawnBuffer3 *beep.Buffer
-var spawnBuffer4 *beep.Buffer
-var spawnBuffer5 *beep.Buffer
-var pinkSquareSpawnBuffer *beep.Buffer
-var snakeSpawnBuffer *beep.Buffer
-var blackholeHitBuffer *beep.Buffer
-var blackholeDieBuffer *beep.Buffer
-var lifeBuffer *beep.Buffer
-var multiplierBuffer *beep.Buffer
-var multiplierBuffer2 *beep.Buffer
-var multiplierBuffer3 *beep.Buffer
-var multiplierBuffer4 *beep.Buffer
-var multiplierBuffer5 *beep.Buffer
-var multiplierBuffer6 *beep.Buffer
-var multiplierBuffer7 *beep.Buffer
-var multiplierBuffer8 *beep.Buffer
-var multiplierBuffer9 *beep.Buffer
-var multiplierBuffer10 *beep.Buffer
-
-var multiplierSounds map[int]*beep.Buffer
-
-var bombBuffer *beep.Buffer
-var musicStreamer *beep.StreamSeekCloser
-var pacifismMusicStreamer *beep.StreamSeekCloser
-var menuMusicStreamer *beep.StreamSeekCloser
-var introStreamer *beep.StreamSeekCloser
-var musicVolume float64
-
-type soundEffect struct {
-	buffer *beep.Buffer
-	volume float64
+// Used whenever a sound can't be loaded, so we can still initialise the speaker
+var defaultSoundFormat = beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+
+// Everything is mixed at this rate. Music that isn't gets resampled.
+var soundFormat = defaultSoundFormat
+
+func silence(format beep.Format) *beep.Buffer {
+	buffer := beep.NewBuffer(format)
+	buffer.Append(beep.Silence(format.SampleRate.N(time.Second / 10)))
+	return buffer
+}
+
+// Stands in for a missing song. It's long so that looping it doesn't keep restarting the music.
+type silentStreamer struct {
+	pos int
+	len int
+}
+
+func newSilentStreamer(format beep.Format) *silentStreamer {
+	return &silentStreamer{len: format.SampleRate.N(time.Minute)}
+}
+
+func (s *silentStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	if s.pos >= s.len {
+		return 0, false
+	}
+	n = len(samples)
+	if s.len-s.pos < n {
+		n = s.len - s.pos
+	}
+	for i := 0; i < n; i++ {
+		samples[i] = [2]float64{}
+	}
+	s.pos += n
+	return n, true
 }
 
-var musicStreamers = map[string]beep.StreamSeekCloser{}
-var soundEffects = map[string]*soundEffect{}
+func (s *silentStreamer) Err() error       { return nil }
+func (s *silentStreamer) Len() int         { return s.len }
+func (s *silentStreamer) Position() int    { return s.pos }
+func (s *silentStreamer) Seek(p int) error { s.pos = p; return nil }
+func (s *silentStreamer) Close() error     { return nil }
 
 func prepareStreamer(file string) (*beep.StreamSeekCloser, *beep.Format) {
-	sound, err := os.Open(file)
+	var streamer beep.StreamSeekCloser
+	sound, err := assets.Open(file)
 	if err != nil {
-		panic(err)
+		assets.Placeholder(file, err)
+		streamer = newSilentStreamer(defaultSoundFormat)
+		return &streamer, &defaultSoundFormat
 	}
 
-	streamer, format, err := mp3.Decode(sound)
+	streamer, format, err := decodeAudio(file, sound)
 	if err != nil {
-		panic(err)
+		assets.Placeholder(file, err)
+		streamer = newSilentStreamer(defaultSoundFormat)
+		return &streamer, &defaultSoundFormat
 	}
 
 	return &streamer, &format
 }
 
-func prepareBuffer(file string) (*beep.Buffer, *beep.Format) {
-	sound, err := os.Open(file)
-	if err != nil {
-		panic(err)
-	}
-
-	ext := strings.Split(file, ".")[1]
-
-	var streamer beep.StreamSeekCloser
-	var format beep.Format
+// audioExtensions are the file types decodeAudio understands
+var audioExtensions = []string{".mp3", ".wav", ".ogg", ".flac"}
 
+// decodeAudio picks a decoder from the file's extension
+func decodeAudio(file string, r io.ReadCloser) (beep.StreamSeekCloser, beep.Format, error) {
+	ext := strings.ToLower(filepath.Ext(file))
 	switch ext {
-	case "mp3":
-		streamer, format, err = mp3.Decode(sound)
-	case "wav":
-		streamer, format, err = wav.Decode(sound)
+	case ".mp3":
+		return mp3.Decode(r)
+	case ".wav":
+		return wav.Decode(r)
+	case ".ogg":
+		return vorbis.Decode(r)
+	case ".flac":
+		return flac.Decode(r)
 	default:
-		errorString := fmt.Sprintf("Unsupported file extension: %s", ext)
-		panic(errorString)
+		r.Close()
+		return nil, beep.Format{}, fmt.Errorf("Unsupported file extension: %s", ext)
+	}
+}
+
+func prepareBuffer(file string) (*beep.Buffer, *beep.Format) {
+	sound, err := assets.Open(file)
+	if err != nil {
+		assets.Placeholder(file, err)
+		return silence(defaultSoundFormat), &defaultSoundFormat
 	}
 
+	streamer, format, err := decodeAudio(file, sound)
 	if err != nil {
-		panic(err)
+		assets.Placeholder(file, err)
+		return silence(defaultSoundFormat), &defaultSoundFormat
 	}
 	buffer := beep.NewBuffer(format)
 	buffer.Append(streamer)
@@ -102,191 +119,105 @@ func prepareBuffer(file string) (*beep.Buffer, *beep.Format) {
 	return buffer, &format
 }
 
-func init() {
-	// TODO:
-	// Unify how sounds are played, and make them driven by configuration
-
-	spawnBuffer2, _ = prepareBuffer("sound/spawn2.mp3")
-	spawnBuffer3, _ = prepareBuffer("sound/spawn3.mp3")
-	spawnBuffer4, _ = prepareBuffer("sound/spawn4.mp3")
-	spawnBuffer5, _ = prepareBuffer("sound/spawn5.mp3")
-	snakeSpawnBuffer, _ = prepareBuffer("sound/snake-spawn.mp3")
-
-	pinkSquareSpawnBuffer, _ = prepareBuffer("sound/snake-spawn.mp3")
-	blackholeHitBuffer, _ = prepareBuffer("sound/blackhole-hit.mp3")
-	blackholeDieBuffer, _ = prepareBuffer("sound/blackhole-die.mp3")
-
-	lifeBuffer, _ = prepareBuffer("sound/player-life.mp3")
-	multiplierBuffer, _ = prepareBuffer("sound/multiplierbonus.mp3")
-	multiplierBuffer2, _ = prepareBuffer("sound/multiplierbonus2.mp3")
-	multiplierBuffer3, _ = prepareBuffer("sound/multiplierbonus3.mp3")
-	multiplierBuffer4, _ = prepareBuffer("sound/multiplierbonus4.mp3")
-	multiplierBuffer5, _ = prepareBuffer("sound/multiplierbonus5.mp3")
-	multiplierBuffer6, _ = prepareBuffer("sound/multiplierbonus6.mp3")
-	multiplierBuffer7, _ = prepareBuffer("sound/multiplierbonus7.mp3")
-	multiplierBuffer8, _ = prepareBuffer("sound/multiplierbonus8.mp3")
-	multiplierBuffer9, _ = prepareBuffer("sound/multiplierbonus9.mp3")
-	multiplierBuffer10, _ = prepareBuffer("sound/multiplierbonus10.mp3")
-	multiplierSounds = map[int]*beep.Buffer{}
-	multiplierSounds[2] = multiplierBuffer2
-	multiplierSounds[3] = multiplierBuffer3
-	multiplierSounds[4] = multiplierBuffer4
-	multiplierSounds[5] = multiplierBuffer5
-	multiplierSounds[6] = multiplierBuffer6
-	multiplierSounds[7] = multiplierBuffer7
-	multiplierSounds[8] = multiplierBuffer8
-	multiplierSounds[9] = multiplierBuffer9
-	multiplierSounds[10] = multiplierBuffer10
-
-	bombBuffer, _ = prepareBuffer("sound/player-bomb.mp3")
-
-	initSounds()
-	initMusic()
-
-	speaker.Init(soundFormat.SampleRate, soundFormat.SampleRate.N(time.Second/10))
-}
-
-func initSounds() {
-	shotBuffer, shotSoundFormat = prepareBuffer("sound/shoot.mp3")
-	soundEffects["sound/shoot.mp3"] = &soundEffect{
-		buffer: shotBuffer,
-		volume: -1.1,
-	}
-
-	shotBuffer2, shotSoundFormat = prepareBuffer("sound/shoot2.mp3")
-	soundEffects["sound/shoot2.mp3"] = &soundEffect{
-		buffer: shotBuffer2,
-		volume: -0.7,
-	}
-
-	shotBuffer3, shotSoundFormat = prepareBuffer("sound/shoot3.mp3")
-	shotBuffer3.Streamer(0, shotBuffer3.Len())
-	soundEffects["sound/shoot3.mp3"] = &soundEffect{
-		buffer: shotBuffer3,
-		volume: -1.3,
-	}
+// InitAudio loads every sound and starts playing through the backend. Call it once, after InitAssets.
+// Until it's called (e.g. in tests) sounds go nowhere.
+func InitAudio(backend AudioBackend) {
+	loadSoundBank(soundBankFile)
+	loadMusic(musicFile, soundFormat)
+	loadPlaylists(musicFolder, soundFormat)
 
-	shotBuffer4, shotSoundFormat = prepareBuffer("sound/shoot4.mp3")
-	soundEffects["sound/shoot-mixed.mp3"] = &soundEffect{
-		buffer: shotBuffer4,
-		volume: -1.1,
-	}
-
-	spawnBuffer, _ = prepareBuffer("sound/menu-step.wav")
-	soundEffects["menu/step"] = &soundEffect{
-		buffer: spawnBuffer,
-		volume: -0.9,
-	}
-
-	spawnBuffer, _ = prepareBuffer("sound/menu-confirm.wav")
-	soundEffects["menu/confirm"] = &soundEffect{
-		buffer: spawnBuffer,
-		volume: -0.9,
+	err := backend.Init(soundFormat)
+	if err != nil {
+		fmt.Printf("[Audio] Couldn't start audio, continuing without it: %s\n", err)
+		backend = NewNullBackend()
+		backend.Init(soundFormat)
 	}
+	audio.backend = backend
+	backend.Play(audio.Streamer())
+	audio.Play(musicBus, music)
+}
 
-	buffer, _ := prepareBuffer("sound/player-die.wav")
-	soundEffects["player/die"] = &soundEffect{
-		buffer: buffer,
-		volume: -0.5,
+// CloseAudio shuts down the backend, which is when a capture gets written out
+func CloseAudio() {
+	err := audio.backend.Close()
+	if err != nil {
+		fmt.Printf("[Audio] %s\n", err)
 	}
+}
 
-	buffer, _ = prepareBuffer("sound/game-over.wav")
-	soundEffects["game/over"] = &soundEffect{
-		buffer: buffer,
-		volume: -1.0,
+// CapturedSounds lists the sounds played so far, when running with a null or capture backend
+func CapturedSounds() []CapturedSound {
+	if o, ok := audio.backend.(*offlineBackend); ok {
+		return o.Sounds()
 	}
+	return nil
+}
 
-	buffer, _ = prepareBuffer("sound/ward-spawn.wav")
-	soundEffects["ward/spawn"] = &soundEffect{
-		buffer: buffer,
-		volume: -0.6,
-	}
+// Positional sounds pan with their horizontal distance from the listener, all the way over at the
+// edge of the arena, and get quieter past listenerNear, down to listenerMinGain so offscreen threats are still heard
+const listenerMaxPan = 0.8
+const listenerNear = 400.0
+const listenerRolloff = 600.0
+const listenerMinGain = 0.2
 
-	buffer, _ = prepareBuffer("sound/ward-die.wav")
-	soundEffects["ward/die"] = &soundEffect{
-		buffer: buffer,
-		volume: -0.7,
-	}
+// Where the player is hearing from, updated every frame from the camera, and how far to the side
+// a sound has to be to pan fully, which is half the width of the arena
+var listenerPos pixel.Vec
+var listenerPanRange = worldWidth / 2
 
-	buffer, _ = prepareBuffer("sound/ward-die.wav")
-	soundEffects["bomb/empty"] = &soundEffect{
-		buffer: buffer,
-		volume: -0.7,
+func SetListener(pos pixel.Vec, arena pixel.Rect) {
+	listenerPos = pos
+	if arena.W() > 0 {
+		listenerPanRange = arena.W() / 2
 	}
+}
 
-	buffer, _ = prepareBuffer("sound/entity-die.wav")
-	soundEffects["entity/die"] = &soundEffect{
-		buffer: buffer,
-		volume: -1.2,
-	}
+// listenerMix is how far to pan a sound coming from pos, and how loud it should be
+func listenerMix(pos pixel.Vec) (float64, float64) {
+	offset := pos.Sub(listenerPos)
+	pan := math.Max(-1.0, math.Min(1.0, offset.X/listenerPanRange)) * listenerMaxPan
 
-	spawnBuffer, _ = prepareBuffer("sound/spawn.mp3")
-	soundEffects["sound/spawn.mp3"] = &soundEffect{
-		buffer: spawnBuffer,
-		volume: -1.2,
+	gain := 1.0
+	if dist := offset.Len(); dist > listenerNear {
+		gain = math.Max(listenerMinGain, 1.0/(1.0+(dist-listenerNear)/listenerRolloff))
 	}
+	return pan, gain
 }
 
-func initMusic() {
-	musicVolume = -0.3
-
-	musicStreamer, _ := prepareStreamer("sound/music-evolved.mp3")
-	musicStreamers["evolved"] = *musicStreamer
-
-	musicStreamer, _ = prepareStreamer("sound/music-pacifism.mp3")
-	musicStreamers["pacifism"] = *musicStreamer
-
-	musicStreamer, _ = prepareStreamer("sound/music-menu.mp3")
-	musicStreamers["menu"] = *musicStreamer
-
-	musicStreamer, soundFormat = prepareStreamer("sound/music-intro.mp3")
-	musicStreamers["intro"] = *musicStreamer
+// PlaySound plays a sound from the sound bank by name
+func PlaySound(soundName string) {
+	playSound(soundName, false, pixel.ZV)
 }
 
-func updateMusic(songName string) {
-	if musicStreamers[songName].Position() == musicStreamers[songName].Len() {
-		PlaySong(songName)
-	}
+// PlaySoundAt plays a sound as if it came from a point in the world
+func PlaySoundAt(soundName string, pos pixel.Vec) {
+	playSound(soundName, true, pos)
 }
 
-func PlaySong(songName string) {
-	speaker.Clear()
-	s, ok := musicStreamers[songName]
+func playSound(soundName string, positional bool, pos pixel.Vec) {
+	soundEffect, ok := soundEffects[soundName]
 	if !ok {
-		// errorString := fmt.Sprintf("Unknown sound: %s", songName)
-		// panic(errorString)
-		fmt.Printf("Unknown sound: %s", songName)
+		fmt.Printf("[SoundPlayer] Unknown sound: %s\n", soundName)
 		return
 	}
 
-	s.Seek(0)
-
-	volume := &effects.Volume{
-		Streamer: s,
-		Base:     10,
-		Volume:   musicVolume,
-		Silent:   false,
-	}
-
-	speaker.Play(volume)
-}
-
-func PlaySound(soundName string) {
-	soundEffect, ok := soundEffects[soundName]
-	if !ok {
-		errorString := fmt.Sprintf("Unknown sound: %s", soundName)
-		panic(errorString)
+	now := time.Now()
+	if !soundEffect.ready(now) || !voices.allocate(soundEffect) {
+		return
 	}
+	volume := soundEffect.streamer(now)
 
-	sound := soundEffect.buffer.Streamer(0, soundEffect.buffer.Len())
+	var sound beep.Streamer = volume
+	if positional {
+		pan, gain := listenerMix(pos)
+		volume.Volume += math.Log10(gain)
 
-	volume := &effects.Volume{
-		Streamer: sound,
-		Base:     10,
-		Volume:   soundEffect.volume,
-		Silent:   false,
+		sound = &effects.Pan{Streamer: volume, Pan: pan}
 	}
 
 	// fmt.Printf("[SoundPlayer] %s\n", soundName)
-	speaker.Play(volume)
+	audio.Play(soundEffect.bus, voices.start(soundEffect, sound))
+	if o, ok := audio.backend.(*offlineBackend); ok {
+		o.logSound(soundName)
+	}
 }
@@ -0,0 +1,54 @@
+package starshipkepler
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/faiface/pixel"
+)
+
+// A kill and then a death, two updates apart, should be captured by name in the frames they happened in
+func TestCapturedSounds(t *testing.T) {
+	InitAssets("..", nil)
+	InitAudio(NewNullBackend())
+	defer CloseAudio()
+	start := len(CapturedSounds())
+
+	PlaySound("entity/die")
+	audio.Update()
+	audio.Update()
+	PlaySound("player/die")
+
+	sounds := CapturedSounds()[start:]
+	if len(sounds) != 2 {
+		t.Fatalf("expected 2 sounds, got %v", sounds)
+	}
+	if sounds[0].Name != "entity/die" || sounds[1].Name != "player/die" {
+		t.Errorf("expected entity/die then player/die, got %s then %s", sounds[0].Name, sounds[1].Name)
+	}
+	if frames := sounds[1].Frame - sounds[0].Frame; frames != 2 {
+		t.Errorf("expected the sounds 2 frames apart, got %d", frames)
+	}
+	if gap := sounds[1].Time - sounds[0].Time; gap != 2*time.Second/offlineFrameRate {
+		t.Errorf("expected the sounds 2 frames of time apart, got %s", gap)
+	}
+}
+
+// Sounds at the edge of the arena should pan all the way, however wide the arena is
+func TestListenerPanFollowsArena(t *testing.T) {
+	defer SetListener(listenerPos, pixel.R(0, 0, listenerPanRange*2, 0))
+
+	for _, name := range []string{"small", "large", "circle"} {
+		bounds := NewArena(name).Bounds()
+		SetListener(bounds.Center(), bounds)
+		right := pixel.V(bounds.Max.X, bounds.Center().Y)
+		if pan, _ := listenerMix(right); pan != listenerMaxPan {
+			t.Errorf("%s: expected the right edge to pan by %v, got %v", name, listenerMaxPan, pan)
+		}
+		halfway := pixel.V(bounds.Center().X-bounds.W()/4, bounds.Center().Y)
+		if pan, _ := listenerMix(halfway); math.Abs(pan+listenerMaxPan/2) > 1e-9 {
+			t.Errorf("%s: expected halfway to the left edge to pan by %v, got %v", name, -listenerMaxPan/2, pan)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package starshipkepler
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/effects"
+	"gopkg.in/yaml.v3"
+)
+
+const soundBankFile = "sound/sounds.yml"
+
+// soundConfig is one entry in sounds.yml
+type soundConfig struct {
+	File     string   `yaml:"file"`
+	Files    []string `yaml:"files"`
+	Volume   float64  `yaml:"volume"`
+	Pitch    float64  `yaml:"pitch"`
+	Voices   int      `yaml:"voices"`
+	Cooldown float64  `yaml:"cooldown"`
+	Priority int      `yaml:"priority"`
+	Bus      string   `yaml:"bus"`
+
+	// Synth is used instead of the file when the file is missing, or with SetSynthOnly
+	Synth *synthConfig `yaml:"synth"`
+}
+
+type soundBankConfig struct {
+	Sounds map[string]soundConfig `yaml:"sounds"`
+}
+
+type soundEffect struct {
+	name     string
+	buffers  []*beep.Buffer
+	volume   float64
+	pitch    float64
+	voices   int
+	cooldown time.Duration
+	priority int
+	bus      string
+
+	lastPlayed time.Time
+	rapid      int // how many times in a row it's been retriggered quickly
+}
+
+// A sound retriggered within rapidRetrigger of the last one gets quieter each time, down to rapidMinGain,
+// so that twenty kills in a frame sound like a crunch rather than clipping
+const rapidRetrigger = 30 * time.Millisecond
+const rapidFalloff = 0.8
+const rapidMinGain = 0.3
+
+var soundEffects = map[string]*soundEffect{}
+
+func loadSoundBank(file string) {
+	data, err := assets.ReadFile(file)
+	if err != nil {
+		assets.Placeholder(file, err)
+		return
+	}
+
+	bank := soundBankConfig{}
+	err = yaml.Unmarshal(data, &bank)
+	if err != nil {
+		assets.Placeholder(file, err)
+		return
+	}
+
+	// several sounds share a sample, only decode each file once
+	buffers := map[string]*beep.Buffer{}
+	load := func(file string) *beep.Buffer {
+		if buffer, ok := buffers[file]; ok {
+			return buffer
+		}
+		buffer, _ := prepareBuffer(file)
+		buffers[file] = buffer
+		return buffer
+	}
+
+	for name, conf := range bank.Sounds {
+		files := conf.Files
+		if conf.File != "" {
+			files = append([]string{conf.File}, files...)
+		}
+		if len(files) == 0 && conf.Synth == nil {
+			fmt.Printf("[SoundBank] %s has no file\n", name)
+			continue
+		}
+
+		bus := conf.Bus
+		if bus == "" {
+			bus = sfxBus
+		}
+
+		effect := &soundEffect{
+			name:     name,
+			volume:   conf.Volume,
+			pitch:    conf.Pitch,
+			voices:   conf.Voices,
+			cooldown: time.Duration(conf.Cooldown * float64(time.Second)),
+			priority: conf.Priority,
+			bus:      bus,
+		}
+		if conf.Synth != nil && (synthOnly || !allExist(files)) {
+			effect.buffers = []*beep.Buffer{renderSynth(*conf.Synth, soundFormat)}
+		} else {
+			for _, f := range files {
+				effect.buffers = append(effect.buffers, load(f))
+			}
+		}
+		soundEffects[name] = effect
+	}
+}
+
+func allExist(files []string) bool {
+	if len(files) == 0 {
+		return false
+	}
+	for _, f := range files {
+		if !assets.Exists(f) {
+			return false
+		}
+	}
+	return true
+}
+
+// ready is whether the sound is past its cooldown
+func (s *soundEffect) ready(now time.Time) bool {
+	return s.cooldown <= 0 || now.Sub(s.lastPlayed) >= s.cooldown
+}
+
+// streamer builds a new voice for the sound
+func (s *soundEffect) streamer(now time.Time) *effects.Volume {
+	if now.Sub(s.lastPlayed) < rapidRetrigger {
+		s.rapid++
+	} else {
+		s.rapid = 0
+	}
+	s.lastPlayed = now
+
+	buffer := s.buffers[rand.Intn(len(s.buffers))]
+	var sound beep.Streamer = buffer.Streamer(0, buffer.Len())
+
+	// samples recorded at a different rate to the mix need resampling anyway
+	ratio := float64(buffer.Format().SampleRate) / float64(soundFormat.SampleRate)
+	if s.pitch > 0 {
+		ratio *= 1.0 + (rand.Float64()*2.0-1.0)*s.pitch
+	}
+	if ratio != 1.0 {
+		sound = beep.ResampleRatio(3, math.Max(ratio, 0.01), sound)
+	}
+
+	gain := math.Max(rapidMinGain, math.Pow(rapidFalloff, float64(s.rapid)))
+
+	return &effects.Volume{
+		Streamer: sound,
+		Base:     10,
+		Volume:   s.volume + math.Log10(gain),
+		Silent:   false,
+	}
+}
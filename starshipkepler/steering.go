@@ -0,0 +1,346 @@
+package starshipkepler
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/faiface/pixel"
+	"github.com/nathanKramer/starship-kepler/sliceextra"
+)
+
+// STEERING
+
+// Enemies decide which way to go by blending a few simple behaviours together, each one a direction
+// with a weight. What an enemy does is just which behaviours it has, and how much it cares about each.
+
+type steeringBehaviour func(s *steeringContext) pixel.Vec
+
+type steeringWeight struct {
+	behaviour string
+	weight    float64
+}
+
+// steeringContext is everything a behaviour gets to look at
+type steeringContext struct {
+	game   *game
+	e      *entityData
+	id     int // where it is in game.data.entities
+	player *entityData
+	dt     float64
+}
+
+// How far enemies look for others of their kind to flock with
+const steeringNeighbourRadius = 120.0
+
+// How far ahead enemies look for obstacles, in multiples of their radius
+const steeringFeelerLength = 3.0
+
+// Wanderers steer towards a point on a circle out in front of them, which jitters around
+const wanderDistance = 80.0
+const wanderRadius = 40.0
+const wanderJitter = 6.0 // radians per second, at most
+
+// How far ahead pursuers lead the player, at most
+const pursueLookahead = 1.0
+
+var steeringBehaviours = map[string]steeringBehaviour{
+	"seek":     steerSeek,
+	"flee":     steerFlee,
+	"arrive":   steerArrive,
+	"wander":   steerWander,
+	"pursue":   steerPursue,
+	"evade":    steerEvade,
+	"separate": steerSeparate,
+	"align":    steerAlign,
+	"cohere":   steerCohere,
+	"avoid":    steerAvoid,
+
+	// the odd ones particular enemies have always done
+	"roam":    steerRoam,
+	"dodge":   steerDodge,
+	"slither": steerSlither,
+	"orbit":   steerOrbit,
+}
+
+// steeringBlends is how each type of enemy gets about. Anything not in here doesn't move itself.
+var steeringBlends = map[string][]steeringWeight{
+	"follower":   {{"seek", 1}, {"separate", 1}},
+	"wanderer":   {{"roam", 1}, {"separate", 1}},
+	"dodger":     {{"seek", 1}, {"dodge", 1}, {"separate", 1}},
+	"pink":       {{"seek", 1}, {"separate", 1}},
+	"pinkpleb":   {{"seek", 1}},
+	"snek":       {{"slither", 1}},
+	"bubble":     {{"seek", 1}, {"separate", 1}},
+	"replicator": {{"seek", 1}, {"separate", 1}},
+	"gate":       {{"roam", 1}},
+	"sniper":     {{"orbit", 1}, {"separate", 1}, {"avoid", 1}},
+	"starling":   {{"pursue", 1}, {"separate", 1.5}, {"align", 0.8}, {"cohere", 0.6}, {"wander", 0.3}, {"avoid", 2}},
+}
+
+// steer is which way an enemy wants to go this update
+func (game *game) steer(e *entityData, id int, player *entityData, dt float64) pixel.Vec {
+	s := &steeringContext{game: game, e: e, id: id, player: player, dt: dt}
+	dir := pixel.ZV
+	for _, w := range steeringBlends[e.entityType] {
+		dir = dir.Add(steeringBehaviours[w.behaviour](s).Scaled(w.weight))
+	}
+	return dir
+}
+
+// seek heads for the player, around any obstacles rather than straight at them
+func steerSeek(s *steeringContext) pixel.Vec {
+	if !s.player.alive {
+		return pixel.ZV
+	}
+	return s.game.data.flow.Direction(s.e.origin, s.player.origin)
+}
+
+func steerFlee(s *steeringContext) pixel.Vec {
+	if !s.player.alive {
+		return pixel.ZV
+	}
+	return s.player.origin.To(s.e.origin).Unit()
+}
+
+// arrive heads for the entity's target, easing off as it gets close
+func steerArrive(s *steeringContext) pixel.Vec {
+	toTarget := s.e.origin.To(s.e.target)
+	if toTarget.Len() < 1 {
+		return pixel.ZV
+	}
+	return toTarget.Unit().Scaled(math.Min(1, toTarget.Len()/200.0))
+}
+
+func steerWander(s *steeringContext) pixel.Vec {
+	s.e.wanderAngle += (rand.Float64()*2 - 1) * wanderJitter * s.dt
+	heading := s.e.velocity.Unit()
+	if s.e.velocity.Len() == 0 {
+		heading = s.e.orientation.Unit()
+	}
+	point := heading.Scaled(wanderDistance).Add(pixel.V(wanderRadius, 0).Rotated(s.e.wanderAngle))
+	return point.Unit()
+}
+
+// predicted is where the player will be by the time the entity gets there, roughly
+func (s *steeringContext) predicted() pixel.Vec {
+	lookahead := pursueLookahead
+	if s.e.speed > 0 {
+		lookahead = math.Min(lookahead, s.e.origin.To(s.player.origin).Len()/s.e.speed)
+	}
+	return s.player.origin.Add(s.player.velocity.Scaled(lookahead))
+}
+
+func steerPursue(s *steeringContext) pixel.Vec {
+	if !s.player.alive {
+		return pixel.ZV
+	}
+	return s.game.data.flow.Direction(s.e.origin, s.predicted())
+}
+
+func steerEvade(s *steeringContext) pixel.Vec {
+	if !s.player.alive {
+		return pixel.ZV
+	}
+	return s.predicted().To(s.e.origin).Unit()
+}
+
+// separate pushes apart enemies of the same type that are overlapping, harder the more they overlap
+func steerSeparate(s *steeringContext) pixel.Vec {
+	push := pixel.ZV
+	s.game.data.neighbours.each(s.id, s.e, s.e.movementColliderRadius*2, func(n *entityData) {
+		away := n.origin.To(s.e.origin)
+		reach := s.e.movementColliderRadius + n.movementColliderRadius
+		if away.Len() >= reach {
+			return
+		}
+		if away.Len() == 0 {
+			away = randomVector(1)
+		}
+		push = push.Add(away.Unit().Scaled(1 - away.Len()/reach))
+	})
+	return push
+}
+
+// align turns towards the way the rest of the flock is going
+func steerAlign(s *steeringContext) pixel.Vec {
+	heading := pixel.ZV
+	s.game.data.neighbours.each(s.id, s.e, steeringNeighbourRadius, func(n *entityData) {
+		heading = heading.Add(n.velocity.Unit())
+	})
+	if heading.Len() == 0 {
+		return pixel.ZV
+	}
+	return heading.Unit()
+}
+
+// cohere heads for the middle of the flock
+func steerCohere(s *steeringContext) pixel.Vec {
+	centre, count := pixel.ZV, 0
+	s.game.data.neighbours.each(s.id, s.e, steeringNeighbourRadius, func(n *entityData) {
+		centre = centre.Add(n.origin)
+		count++
+	})
+	if count == 0 {
+		return pixel.ZV
+	}
+	return s.e.origin.To(centre.Scaled(1 / float64(count))).Unit()
+}
+
+// avoid feels ahead for obstacles and the edge of the arena, and steers off them
+func steerAvoid(s *steeringContext) pixel.Vec {
+	if s.e.velocity.Len() == 0 {
+		return pixel.ZV
+	}
+	ahead := s.e.origin.Add(s.e.velocity.Unit().Scaled(s.e.radius * steeringFeelerLength))
+	if o, normal, _ := s.game.data.arena.Obstacle(ahead, s.e.radius); o != nil {
+		return normal
+	}
+	if inside := s.game.data.arena.Clamp(ahead, s.e.radius); inside != ahead {
+		return ahead.To(inside).Unit()
+	}
+	return pixel.ZV
+}
+
+// roam wanders between random points of interest, ignoring the player
+func steerRoam(s *steeringContext) pixel.Vec {
+	e := s.e
+	if e.target.Len() == 0 || e.origin.To(e.target).Len() < 5.0 {
+		poi := s.game.data.arena.RandomPoint(0)
+		e.target = e.origin.Sub(poi).Unit().Scaled(rand.Float64() * 400)
+	}
+	return e.origin.To(e.target).Unit()
+}
+
+// dodge gets out of the way of the closest bullet about to hit, unless it's carrying wind
+func steerDodge(s *steeringContext) pixel.Vec {
+	// https://gamedev.stackexchange.com/questions/109513/how-to-find-if-an-object-is-facing-another-object-given-position-and-direction-a
+	e, game := s.e, s.game
+	dir := pixel.ZV
+	currentlyDodgingDist := -1.0
+	for _, b := range game.data.bullets {
+		if (len(b.data.elements) > 0 && b.data.elements[0] == "wind") || (len(b.data.elements) > 1 && b.data.elements[1] == "wind") {
+			continue
+		}
+		if !b.data.alive {
+			continue
+		}
+		entToBullet := e.origin.Sub(b.data.origin)
+		if entToBullet.Len() > 200 {
+			continue
+		}
+		entToBullet = entToBullet.Unit()
+		facing := entToBullet.Dot(b.data.orientation.Unit())
+
+		isClosest := (currentlyDodgingDist == -1.0 || entToBullet.Len() < currentlyDodgingDist)
+		if facing > 0.0 && facing > 0.7 && facing < 0.95 && isClosest { // if it's basically dead on, they'll die.
+			currentlyDodgingDist = entToBullet.Len()
+
+			if g_debug {
+				game.debugInfos = append(game.debugInfos, debugInfo{p1: e.origin, p2: b.data.origin})
+			}
+
+			baseVelocity := entToBullet.Unit().Scaled(-4)
+
+			e.EmitWake(game, baseVelocity)
+
+			// far stronger than anything else it's blended with, dodging comes first
+			dir = e.origin.Sub(b.data.origin).Scaled(4)
+		}
+	}
+	return dir
+}
+
+// slither seeks the player, swinging from side to side across a cone that changes every couple of seconds
+func steerSlither(s *steeringContext) pixel.Vec {
+	e := s.e
+	t := math.Mod(s.game.lastFrame.Sub(e.born).Seconds(), 2.0)
+	deg := (math.Sin(t*math.Pi) * e.cone) * math.Pi / 180.0
+	if t > 1.9 {
+		e.cone = 60.0 + (rand.Float64() * 90.0)
+	}
+	return steerSeek(s).Rotated(deg)
+}
+
+// orbit circles round the player, drifting in or out to keep at sniperRange
+func steerOrbit(s *steeringContext) pixel.Vec {
+	if !s.player.alive {
+		return pixel.ZV
+	}
+	toPlayer := s.e.origin.To(s.player.origin)
+	drift := (toPlayer.Len() - sniperRange) / sniperRange
+	return toPlayer.Unit().Rotated(s.e.orbit * math.Pi / 2).Add(toPlayer.Unit().Scaled(drift * 2)).Unit()
+}
+
+// These are meant to bunch up, so they don't get pushed apart
+var unseparatedEnemies = []string{"pinkpleb", "snek", "gate"}
+
+// separateEnemies pushes overlapping enemies of the same type apart, after they've moved. Steering
+// them apart isn't enough on its own, nothing stops a crowd that's all seeking the same point from piling up.
+func (game *game) separateEnemies(dt float64) {
+	game.data.neighbours.Rebuild(game.data.entities)
+	for id := range game.data.entities {
+		a := &game.data.entities[id]
+		if !a.alive || sliceextra.Contains(unseparatedEnemies, a.entityType) {
+			continue
+		}
+		game.data.neighbours.each(id, a, a.movementColliderRadius*2, func(b *entityData) {
+			intersection := a.MovementCollisionCircle().Intersect(b.MovementCollisionCircle())
+			if intersection.Radius > 0 {
+				a.origin = a.origin.Add(b.origin.To(a.origin).Unit().Scaled(intersection.Radius * dt))
+			}
+		})
+	}
+}
+
+// NEIGHBOURS
+
+// neighbourhood buckets the living enemies by where they are, so flocking only has to look at
+// the ones nearby rather than every other enemy in the arena
+type neighbourhood struct {
+	entities []entityData
+	cells    map[[2]int][]int
+}
+
+const neighbourhoodCellSize = 128.0
+
+func NewNeighbourhood() *neighbourhood {
+	return &neighbourhood{cells: map[[2]int][]int{}}
+}
+
+func neighbourhoodCell(v pixel.Vec) [2]int {
+	return [2]int{int(math.Floor(v.X / neighbourhoodCellSize)), int(math.Floor(v.Y / neighbourhoodCellSize))}
+}
+
+// Rebuild sorts the entities into cells, keeping hold of the cells from last time
+func (n *neighbourhood) Rebuild(entities []entityData) {
+	n.entities = entities
+	for key, cell := range n.cells {
+		n.cells[key] = cell[:0]
+	}
+	for i, e := range entities {
+		if !e.alive || e.spawning {
+			continue
+		}
+		key := neighbourhoodCell(e.origin)
+		n.cells[key] = append(n.cells[key], i)
+	}
+}
+
+// each calls fn for every other living enemy of the same type within radius of e, which is entities[id]
+func (n *neighbourhood) each(id int, e *entityData, radius float64, fn func(n *entityData)) {
+	min := neighbourhoodCell(e.origin.Sub(pixel.V(radius, radius)))
+	max := neighbourhoodCell(e.origin.Add(pixel.V(radius, radius)))
+	for x := min[0]; x <= max[0]; x++ {
+		for y := min[1]; y <= max[1]; y++ {
+			for _, i := range n.cells[[2]int{x, y}] {
+				other := &n.entities[i]
+				if i == id || other.entityType != e.entityType {
+					continue
+				}
+				if other.origin.To(e.origin).Len() <= radius {
+					fn(other)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package starshipkepler
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/faiface/pixel"
+)
+
+// steeringGame is a game with the player at playerPos and these enemies in it, all done spawning
+func steeringGame(playerPos pixel.Vec, enemies ...*entityData) *game {
+	game := newGoldenGame()
+	game.data.player.origin = playerPos
+	for _, e := range enemies {
+		goldenSettle(e)
+		game.data.entities = append(game.data.entities, *e)
+	}
+	game.data.neighbours.Rebuild(game.data.entities)
+	return game
+}
+
+// steerWith runs one behaviour for entities[id]
+func steerWith(game *game, behaviour string, id int) pixel.Vec {
+	s := &steeringContext{game: game, e: &game.data.entities[id], id: id, player: &game.data.player, dt: 1.0 / 60}
+	return steeringBehaviours[behaviour](s)
+}
+
+func closeTo(a pixel.Vec, b pixel.Vec) bool {
+	return a.To(b).Len() < 1e-9
+}
+
+func TestSteeringBehaviours(t *testing.T) {
+	cases := []struct {
+		name      string
+		behaviour string
+		setup     func() *game
+		want      pixel.Vec
+	}{
+		{"seek heads for the player", "seek", func() *game {
+			return steeringGame(pixel.V(100, 0), NewFollower(0, 0))
+		}, pixel.V(1, 0)},
+		{"seek stops when the player's dead", "seek", func() *game {
+			game := steeringGame(pixel.V(100, 0), NewFollower(0, 0))
+			game.data.player.alive = false
+			return game
+		}, pixel.ZV},
+		{"flee runs from the player", "flee", func() *game {
+			return steeringGame(pixel.V(0, 100), NewFollower(0, 0))
+		}, pixel.V(0, -1)},
+		{"arrive goes flat out when far away", "arrive", func() *game {
+			game := steeringGame(pixel.ZV, NewFollower(0, 0))
+			game.data.entities[0].target = pixel.V(0, 400)
+			return game
+		}, pixel.V(0, 1)},
+		{"arrive eases off when close", "arrive", func() *game {
+			game := steeringGame(pixel.ZV, NewFollower(0, 0))
+			game.data.entities[0].target = pixel.V(100, 0)
+			return game
+		}, pixel.V(0.5, 0)},
+		{"arrive stops on the target", "arrive", func() *game {
+			game := steeringGame(pixel.ZV, NewFollower(50, 50))
+			game.data.entities[0].target = pixel.V(50, 50)
+			return game
+		}, pixel.ZV},
+		{"pursue leads the player", "pursue", func() *game {
+			// a second away at its speed, so it aims a second ahead
+			game := steeringGame(pixel.V(340, 0), NewStarling(0, 0))
+			game.data.player.velocity = pixel.V(0, 340)
+			return game
+		}, pixel.V(1, 1).Unit()},
+		{"pursue doesn't look further ahead than it has to", "pursue", func() *game {
+			game := steeringGame(pixel.V(170, 0), NewStarling(0, 0))
+			game.data.player.velocity = pixel.V(0, 340)
+			return game
+		}, pixel.V(1, 1).Unit()},
+		{"separate pushes off an overlapping neighbour", "separate", func() *game {
+			return steeringGame(pixel.ZV, NewFollower(0, 0), NewFollower(12, 0))
+		}, pixel.V(-0.75, 0)},
+		{"separate ignores neighbours that aren't touching", "separate", func() *game {
+			return steeringGame(pixel.ZV, NewFollower(0, 0), NewFollower(60, 0))
+		}, pixel.ZV},
+		{"separate ignores other types", "separate", func() *game {
+			return steeringGame(pixel.ZV, NewFollower(0, 0), NewDodger(12, 0))
+		}, pixel.ZV},
+		{"cohere heads for the middle of the flock", "cohere", func() *game {
+			return steeringGame(pixel.ZV, NewStarling(0, 0), NewStarling(60, 60), NewStarling(60, -60), NewStarling(-500, 0))
+		}, pixel.V(1, 0)},
+		{"cohere on its own stays put", "cohere", func() *game {
+			return steeringGame(pixel.ZV, NewStarling(0, 0))
+		}, pixel.ZV},
+		{"align follows the flock's heading", "align", func() *game {
+			game := steeringGame(pixel.ZV, NewStarling(0, 0), NewStarling(40, 0), NewStarling(0, 40))
+			game.data.entities[1].velocity = pixel.V(0, 50)
+			game.data.entities[2].velocity = pixel.V(0, 200)
+			return game
+		}, pixel.V(0, 1)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := steerWith(c.setup(), c.behaviour, 0); !closeTo(got, c.want) {
+				t.Errorf("expected %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+// A blend is each behaviour scaled by its weight, added up
+func TestSteerBlends(t *testing.T) {
+	blends := steeringBlends
+	defer func() { steeringBlends = blends }()
+	steeringBlends = map[string][]steeringWeight{
+		"follower": {{"seek", 2}, {"flee", 0.5}},
+	}
+
+	game := steeringGame(pixel.V(0, 100), NewFollower(0, 0), NewDodger(0, 0))
+	if got := game.steer(&game.data.entities[0], 0, &game.data.player, 1.0/60); !closeTo(got, pixel.V(0, 1.5)) {
+		t.Errorf("expected seek*2 + flee*0.5, got %v", got)
+	}
+	if got := game.steer(&game.data.entities[1], 1, &game.data.player, 1.0/60); got != pixel.ZV {
+		t.Errorf("expected types without a blend to stay put, got %v", got)
+	}
+}
+
+func TestNeighbourhoodEach(t *testing.T) {
+	spawning := NewFollower(0, 30)
+	dead := NewFollower(30, 0)
+	dead.alive = false
+
+	n := NewNeighbourhood()
+	entities := []entityData{
+		*NewFollower(0, 0),
+		*NewFollower(neighbourhoodCellSize+10, 0), // the next cell over, in range
+		*NewFollower(-50, -50),                    // diagonally across a cell boundary, in range
+		*NewFollower(200, 0),                      // too far
+		*NewDodger(10, 10),                        // not the same type
+		*spawning,
+		*dead,
+	}
+	for i := range entities[:5] {
+		goldenSettle(&entities[i])
+	}
+	n.Rebuild(entities)
+
+	var found []pixel.Vec
+	n.each(0, &entities[0], 150, func(other *entityData) {
+		found = append(found, other.origin)
+	})
+	want := map[pixel.Vec]bool{entities[1].origin: true, entities[2].origin: true}
+	if len(found) != len(want) {
+		t.Fatalf("expected %d neighbours, got %v", len(want), found)
+	}
+	for _, pos := range found {
+		if !want[pos] {
+			t.Errorf("didn't expect a neighbour at %v", pos)
+		}
+	}
+
+	// rebuilding keeps up with them moving
+	entities[1].origin = pixel.V(1000, 1000)
+	n.Rebuild(entities)
+	count := 0
+	n.each(0, &entities[0], 150, func(other *entityData) { count++ })
+	if count != 1 {
+		t.Errorf("expected 1 neighbour after moving one away, got %d", count)
+	}
+}
+
+// stepEnemies moves the enemies along the same way the game does
+func stepEnemies(game *game, dt float64) {
+	player := &game.data.player
+	game.lastFrame = game.lastFrame.Add(time.Duration(dt * float64(time.Second)))
+	game.data.neighbours.Rebuild(game.data.entities)
+	for i, e := range game.data.entities {
+		e.Propel(game.steer(&e, i, player, dt), dt)
+		game.data.entities[i] = e
+	}
+	for i, e := range game.data.entities {
+		e.Update(dt, game.totalTime, game.lastFrame, game.data.arena)
+		game.data.entities[i] = e
+	}
+	game.separateEnemies(dt)
+}
+
+// A flock chasing the player should hang together, without collapsing into one point
+func TestStarlingFlockCohesion(t *testing.T) {
+	rand.Seed(1)
+	var flock []*entityData
+	for i := 0; i < 12; i++ {
+		flock = append(flock, NewStarling(-600+float64(i%4)*40, float64(i/4)*40))
+	}
+	game := steeringGame(pixel.V(600, 0), flock...)
+
+	start := game.data.entities[0].origin
+	for step := 0; step < 300; step++ {
+		stepEnemies(game, 1.0/60)
+
+		centre := pixel.ZV
+		for _, e := range game.data.entities {
+			centre = centre.Add(e.origin)
+		}
+		centre = centre.Scaled(1 / float64(len(game.data.entities)))
+
+		for i, a := range game.data.entities {
+			if spread := a.origin.To(centre).Len(); spread > 250 {
+				t.Fatalf("step %d: starling %d strayed %.0f from the flock", step, i, spread)
+			}
+			for _, b := range game.data.entities[i+1:] {
+				if gap := a.origin.To(b.origin).Len(); gap < 8 {
+					t.Fatalf("step %d: starlings %.1f apart, the flock's collapsed", step, gap)
+				}
+			}
+		}
+	}
+	if moved := start.To(game.data.entities[0].origin).Len(); moved < 300 {
+		t.Errorf("expected the flock to go after the player, it only moved %.0f", moved)
+	}
+}
+
+// Overlapping enemies of the same type get pushed apart, whether they steer or not, except the ones meant to bunch up
+func TestSeparateEnemies(t *testing.T) {
+	cases := []struct {
+		name  string
+		spawn func(x float64, y float64) *entityData
+		moved bool
+	}{
+		{"followers", NewFollower, true},
+		{"black holes", NewBlackHole, true},
+		{"turrets", NewTurret, true},
+		{"essences", func(x float64, y float64) *entityData { return NewEssence(x, y, "fire", goldenEpoch.Add(time.Minute)) }, true},
+		{"sneks", NewSnek, false},
+		{"gates", NewGate, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			game := steeringGame(pixel.ZV, c.spawn(0, 0), c.spawn(10, 0))
+			game.separateEnemies(1.0 / 60)
+			a, b := game.data.entities[0].origin, game.data.entities[1].origin
+			if moved := a != pixel.V(0, 0) || b != pixel.V(10, 0); moved != c.moved {
+				t.Errorf("expected moved to be %v, they're at %v and %v", c.moved, a, b)
+			}
+			if c.moved && (a.X >= 0 || b.X <= 10) {
+				t.Errorf("expected them pushed away from each other, they're at %v and %v", a, b)
+			}
+		})
+	}
+}
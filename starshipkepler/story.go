@@ -1,16 +1,20 @@
 package starshipkepler
 
-import "time"
-
 type page struct {
-	startTime time.Time
-	lines     []string
+	lines []string
 }
 
 type chapter struct {
 	pages []page
+	boss  string // every chapter ends with a boss fight, once the last page has been up for a while
 }
 
+// How long each page stays up before the next one
+const storyPageDuration = 4.0
+
+// How long after the last page goes up the chapter's boss turns up
+const chapterBossDelay = 5.0
+
 var chapter1 = chapter{
 	pages: []page{
 		{lines: []string{"It's been so long..."}},
@@ -25,4 +29,34 @@ var chapter1 = chapter{
 			"Beautiful and terrifying in equal measure",
 		}},
 	},
+	boss: "warden",
+}
+
+// storyGameModeUpdate turns the chapter's pages, then brings in its boss at the end of it
+func (game *game) storyGameModeUpdate(c *chapter) {
+	data := &game.data
+	if data.storyPageStart.IsZero() {
+		data.storyPageStart = game.lastFrame
+	}
+	up := game.lastFrame.Sub(data.storyPageStart).Seconds()
+
+	if data.storyPage < len(c.pages)-1 {
+		if up >= storyPageDuration {
+			data.storyPage++
+			data.storyPageStart = game.lastFrame
+		}
+		return
+	}
+	if c.boss != "" && !data.chapterBossFought && up >= chapterBossDelay {
+		game.spawnBoss(c.boss)
+		data.chapterBossFought = true
+	}
+}
+
+// storyPageLines is what's on the page that's up, if there's one
+func (game *game) storyPageLines(c *chapter) []string {
+	if game.data.mode != "story" || game.data.storyPageStart.IsZero() || game.data.storyPage >= len(c.pages) {
+		return nil
+	}
+	return c.pages[game.data.storyPage].lines
 }
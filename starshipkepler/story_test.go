@@ -0,0 +1,42 @@
+package starshipkepler
+
+import (
+	"testing"
+	"time"
+)
+
+// Stepping through a chapter should turn every page, then bring in its boss a while after the last one
+func TestStoryChapterBoss(t *testing.T) {
+	game := newGoldenGame()
+	game.data = *NewStoryGame()
+
+	dt := 1.0 / 60
+	last := len(chapter1.pages) - 1
+	bossAt := float64(last)*storyPageDuration + chapterBossDelay
+	for elapsed := 0.0; elapsed < bossAt+1; elapsed += dt {
+		game.lastFrame = game.lastFrame.Add(time.Duration(dt * float64(time.Second)))
+		game.storyGameModeUpdate(&chapter1)
+
+		if elapsed < bossAt-dt && game.data.boss != nil {
+			t.Fatalf("the boss turned up early, %.2fs in", elapsed)
+		}
+	}
+
+	if game.data.storyPage != last {
+		t.Errorf("expected to be on the last page, got page %d", game.data.storyPage)
+	}
+	if lines := game.storyPageLines(&chapter1); len(lines) == 0 || lines[0] != chapter1.pages[last].lines[0] {
+		t.Errorf("expected the last page's lines, got %v", lines)
+	}
+	if game.data.boss == nil || game.data.boss.name != chapter1.boss {
+		t.Fatalf("expected the %s after %.0fs, got %v", chapter1.boss, bossAt, game.data.boss)
+	}
+
+	// and only the once
+	game.data.boss = nil
+	game.lastFrame = game.lastFrame.Add(time.Minute)
+	game.storyGameModeUpdate(&chapter1)
+	if game.data.boss != nil {
+		t.Error("expected the chapter's boss to only turn up once")
+	}
+}
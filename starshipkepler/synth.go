@@ -0,0 +1,149 @@
+package starshipkepler
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/faiface/beep"
+)
+
+// synthConfig describes a sound built from scratch instead of loaded from a sample.
+// Layers are mixed together, so e.g. an explosion can be noise over a falling sine.
+type synthConfig struct {
+	Wave     string   `yaml:"wave"` // sine, square, saw, triangle or noise
+	Freq     float64  `yaml:"freq"`
+	Sweep    float64  `yaml:"sweep"` // the frequency to slide to by the end, for a pitch sweep
+	Duration float64  `yaml:"duration"`
+	Gain     *float64 `yaml:"gain"` // defaults to 0.5, to leave some headroom
+
+	// ADSR envelope, in seconds (sustain is a level)
+	Attack  float64  `yaml:"attack"`
+	Decay   float64  `yaml:"decay"`
+	Sustain *float64 `yaml:"sustain"` // defaults to 1
+	Release float64  `yaml:"release"`
+
+	Layers []synthConfig `yaml:"layers"`
+}
+
+// Used when a synth doesn't say how long it is
+const defaultSynthDuration = 0.2
+
+// When set, every sound with a synth is synthesised even if its sample exists
+var synthOnly = false
+
+// SetSynthOnly switches sound effects over to their synthesised versions, for running without any samples.
+// Call it before InitAudio.
+func SetSynthOnly(only bool) {
+	synthOnly = only
+}
+
+// oscillator plays a wave, sliding exponentially from one frequency to another over duration
+func oscillator(sr beep.SampleRate, wave string, from float64, to float64, duration float64, seed int64) beep.Streamer {
+	if to <= 0 {
+		to = from
+	}
+	total := math.Max(1, float64(sr.N(time.Duration(duration*float64(time.Second)))))
+	noise := rand.New(rand.NewSource(seed))
+
+	phase := 0.0
+	i := 0
+	return beep.StreamerFunc(func(samples [][2]float64) (n int, ok bool) {
+		for j := range samples {
+			t := math.Min(float64(i)/total, 1.0)
+			freq := from * math.Pow(to/from, t)
+
+			var v float64
+			switch wave {
+			case "square":
+				v = 1.0
+				if phase >= 0.5 {
+					v = -1.0
+				}
+			case "saw":
+				v = 2.0*phase - 1.0
+			case "triangle":
+				v = 4.0*math.Abs(phase-0.5) - 1.0
+			case "noise":
+				v = noise.Float64()*2.0 - 1.0
+			default:
+				v = math.Sin(2.0 * math.Pi * phase)
+			}
+			samples[j] = [2]float64{v, v}
+
+			phase = math.Mod(phase+freq/float64(sr), 1.0)
+			i++
+		}
+		return len(samples), true
+	})
+}
+
+// envelope shapes the volume of a streamer, releasing so that it's silent at duration
+func envelope(sr beep.SampleRate, s beep.Streamer, conf synthConfig, duration float64) beep.Streamer {
+	sustain := 1.0
+	if conf.Sustain != nil {
+		sustain = *conf.Sustain
+	}
+	rate := float64(sr)
+	i := 0
+	return beep.StreamerFunc(func(samples [][2]float64) (n int, ok bool) {
+		n, ok = s.Stream(samples)
+		for j := 0; j < n; j++ {
+			t := float64(i) / rate
+			level := sustain
+			switch {
+			case t < conf.Attack:
+				level = t / conf.Attack
+			case t < conf.Attack+conf.Decay:
+				level = 1.0 - (1.0-sustain)*(t-conf.Attack)/conf.Decay
+			}
+			if release := duration - t; release < conf.Release {
+				level *= math.Max(0, release/conf.Release)
+			}
+			samples[j][0] *= level
+			samples[j][1] *= level
+			i++
+		}
+		return n, ok
+	})
+}
+
+func synthStreamer(sr beep.SampleRate, conf synthConfig, duration float64, seed int64) beep.Streamer {
+	if conf.Duration > 0 {
+		duration = conf.Duration
+	}
+	gain := 0.5
+	if conf.Gain != nil {
+		gain = *conf.Gain
+	}
+
+	parts := []beep.Streamer{}
+	if conf.Wave != "" {
+		osc := oscillator(sr, conf.Wave, conf.Freq, conf.Sweep, duration, seed)
+		parts = append(parts, envelope(sr, osc, conf, duration))
+	}
+	for i, layer := range conf.Layers {
+		parts = append(parts, synthStreamer(sr, layer, duration, seed+int64(i)+1))
+	}
+
+	mixed := beep.Take(sr.N(time.Duration(duration*float64(time.Second))), beep.Mix(parts...))
+	return beep.StreamerFunc(func(samples [][2]float64) (n int, ok bool) {
+		n, ok = mixed.Stream(samples)
+		for j := 0; j < n; j++ {
+			samples[j][0] *= gain
+			samples[j][1] *= gain
+		}
+		return n, ok
+	})
+}
+
+// renderSynth synthesises a sound up front, so it plays like any other sample
+func renderSynth(conf synthConfig, format beep.Format) *beep.Buffer {
+	duration := conf.Duration
+	if duration <= 0 {
+		duration = defaultSynthDuration
+	}
+	buffer := beep.NewBuffer(format)
+	buffer.Append(synthStreamer(format.SampleRate, conf, duration, 1))
+	return buffer
+}
@@ -51,6 +51,29 @@ func uiDown(win *pixelgl.Window, gamePadDir pixel.Vec) bool {
 	return (win.JustPressed(pixelgl.KeyDown) || gamePadDir.Y < -uiJoyThreshold)
 }
 
+func uiLeft(win *pixelgl.Window, gamePadDir pixel.Vec) bool {
+	return win.JustPressed(pixelgl.KeyLeft) || gamePadDir.X < -uiJoyThreshold
+}
+
+func uiRight(win *pixelgl.Window, gamePadDir pixel.Vec) bool {
+	return win.JustPressed(pixelgl.KeyRight) || gamePadDir.X > uiJoyThreshold
+}
+
+// For menu items with a value, like volume sliders
+func uiChangeValue(win *pixelgl.Window, gamePadDir pixel.Vec, last time.Time, lastUiAction time.Time) int {
+	uiChange := 0
+
+	if last.Sub(lastUiAction).Seconds() > uiClickWait {
+		if uiLeft(win, gamePadDir) {
+			uiChange = -1
+		} else if uiRight(win, gamePadDir) {
+			uiChange = 1
+		}
+	}
+
+	return uiChange
+}
+
 func uiChangeSelection(win *pixelgl.Window, gamePadDir pixel.Vec, last time.Time, lastUiAction time.Time) int {
 	uiChange := 0
 
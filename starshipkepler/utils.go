@@ -3,9 +3,7 @@ package starshipkepler
 import (
 	"fmt"
 	"image"
-	"io/ioutil"
 	"math"
-	"os"
 	"runtime"
 
 	"github.com/faiface/pixel"
@@ -36,22 +34,25 @@ func HSVToColor(h float64, s float64, v float64) pixel.RGBA {
 }
 
 func loadFileToString(filename string) (string, error) {
-	b, err := ioutil.ReadFile(filename)
+	b, err := assets.ReadFile(filename)
 	if err != nil {
 		return "", err
 	}
 	return string(b), nil
 }
 
+// loadPicture always returns something drawable, falling back to a placeholder if the image is unavailable
 func loadPicture(path string) (pixel.Picture, error) {
-	file, err := os.Open(path)
+	file, err := assets.Open(path)
 	if err != nil {
-		return nil, err
+		assets.Placeholder(path, err)
+		return placeholderPicture(), err
 	}
 	defer file.Close()
 	img, _, err := image.Decode(file)
 	if err != nil {
-		return nil, err
+		assets.Placeholder(path, err)
+		return placeholderPicture(), err
 	}
 	return pixel.PictureDataFromImage(img), nil
 }
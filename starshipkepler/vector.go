@@ -44,10 +44,3 @@ func (a Vector3) Len() float64 {
 func (a Vector3) LengthSquared() float64 {
 	return a.X*a.X + a.Y*a.Y + a.Z*a.Z
 }
-
-func (a Vector3) ToVec2(screenSize pixel.Rect) pixel.Vec {
-	// hard-coded perspective projection
-	factor := (a.Z + 2000) / 2000
-	return pixel.V(a.X, a.Y).Sub(screenSize.Max.Scaled(0.5)).Scaled(factor).Add(screenSize.Max.Scaled(0.5))
-	// return pixel.V(a.X, a.Y)
-}
@@ -0,0 +1,109 @@
+package starshipkepler
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/faiface/beep"
+)
+
+// The most sound effects that can play at once. Past this, the least important sound gets cut off.
+const maxVoices = 32
+
+// voice is one sound effect that's currently playing
+type voice struct {
+	effect  *soundEffect
+	started time.Time
+	ctrl    *beep.Ctrl
+	done    int32 // set from the audio goroutine when the sound finishes
+}
+
+func (v *voice) finished() bool {
+	return atomic.LoadInt32(&v.done) == 1
+}
+
+// voiceManager keeps track of what's playing so a burst of kills can't stack up hundreds of sounds.
+// Only touched from the game loop.
+type voiceManager struct {
+	voices []*voice
+}
+
+var voices = &voiceManager{}
+
+func (m *voiceManager) prune() {
+	playing := m.voices[:0]
+	for _, v := range m.voices {
+		if !v.finished() {
+			playing = append(playing, v)
+		}
+	}
+	for i := len(playing); i < len(m.voices); i++ {
+		m.voices[i] = nil
+	}
+	m.voices = playing
+}
+
+func (m *voiceManager) count(effect *soundEffect) int {
+	n := 0
+	for _, v := range m.voices {
+		if v.effect == effect {
+			n++
+		}
+	}
+	return n
+}
+
+// allocate makes room for a new voice of the effect, returning false if it isn't important enough to play.
+// A sound at its own limit steals from its oldest voice, otherwise the lowest priority voice is stolen.
+func (m *voiceManager) allocate(effect *soundEffect) bool {
+	m.prune()
+
+	if effect.voices > 0 && m.count(effect) >= effect.voices {
+		var oldest *voice
+		for _, v := range m.voices {
+			if v.effect == effect && (oldest == nil || v.started.Before(oldest.started)) {
+				oldest = v
+			}
+		}
+		m.stop(oldest)
+	}
+
+	if len(m.voices) >= maxVoices {
+		var victim *voice
+		for _, v := range m.voices {
+			if victim == nil ||
+				v.effect.priority < victim.effect.priority ||
+				(v.effect.priority == victim.effect.priority && v.started.Before(victim.started)) {
+				victim = v
+			}
+		}
+		if victim.effect.priority > effect.priority {
+			return false
+		}
+		m.stop(victim)
+	}
+
+	return true
+}
+
+// start tracks a new voice, returning the streamer to hand to the mixer
+func (m *voiceManager) start(effect *soundEffect, s beep.Streamer) beep.Streamer {
+	v := &voice{effect: effect, started: time.Now()}
+	v.ctrl = &beep.Ctrl{Streamer: beep.Seq(s, beep.Callback(func() {
+		atomic.StoreInt32(&v.done, 1)
+	}))}
+	m.voices = append(m.voices, v)
+	return v.ctrl
+}
+
+// stop cuts a voice off. The mixer drops it the next time it streams.
+func (m *voiceManager) stop(v *voice) {
+	if v == nil {
+		return
+	}
+	audio.backend.Lock()
+	v.ctrl.Streamer = nil
+	audio.backend.Unlock()
+	atomic.StoreInt32(&v.done, 1)
+	m.prune()
+}